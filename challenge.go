@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/Cmolloy36/Chirpy/internal/database"
+	"github.com/Cmolloy36/Chirpy/internal/pow"
+)
+
+var (
+	errChallengeRequired = errors.New("a solved proof-of-work challenge is required; get one from POST /api/challenge")
+	errChallengeReused   = errors.New("proof-of-work challenge has already been used")
+)
+
+type ProofOfWorkChallenge struct {
+	Challenge  string    `json:"challenge"`
+	Algorithm  string    `json:"algorithm"`
+	Difficulty int       `json:"difficulty"`
+	ExpiresAt  time.Time `json:"expires_at"`
+}
+
+// handlerPostChallenge issues a proof-of-work challenge for signup or
+// login. Nothing is stored; the more challenges are being requested, by
+// everyone or by this client, the harder they get.
+func (apiCfg *apiConfig) handlerPostChallenge(w http.ResponseWriter, r *http.Request) {
+	now := time.Now()
+	difficulty := apiCfg.powDifficulty.Next(clientIP(r, apiCfg.trustProxyHeaders), now)
+
+	challenge, err := apiCfg.powIssuer.Issue(difficulty, now)
+	if err != nil {
+		errorMessage := err.Error()
+
+		respondWithError(w, http.StatusInternalServerError, errorMessage)
+		return
+	}
+
+	retChallenge := ProofOfWorkChallenge{
+		Challenge:  challenge.Token,
+		Algorithm:  pow.Algorithm,
+		Difficulty: challenge.Difficulty,
+		ExpiresAt:  challenge.ExpiresAt,
+	}
+
+	respondwithJSON(w, http.StatusCreated, retChallenge)
+}
+
+// spendChallenge checks a solved challenge and marks it used, so each one
+// pays for a single signup or login attempt.
+func (apiCfg *apiConfig) spendChallenge(ctx context.Context, token, solution string) error {
+	if token == "" || solution == "" {
+		return errChallengeRequired
+	}
+
+	challenge, err := apiCfg.powIssuer.Verify(token, solution, time.Now())
+	if err != nil {
+		return err
+	}
+
+	spendChallengeParams := database.SpendChallengeParams{
+		Nonce:     challenge.Nonce,
+		ExpiresAt: challenge.ExpiresAt,
+	}
+
+	rows, err := apiCfg.dbQueries.SpendChallenge(ctx, spendChallengeParams)
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return errChallengeReused
+	}
+
+	return nil
+}
+
+// respondWithChallengeError answers 403 when the challenge was missing or
+// not properly solved, and 500 for anything else.
+func respondWithChallengeError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, errChallengeRequired),
+		errors.Is(err, errChallengeReused),
+		errors.Is(err, pow.ErrInvalidChallenge),
+		errors.Is(err, pow.ErrInvalidSolution):
+		respondWithError(w, http.StatusForbidden, err.Error())
+	default:
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+	}
+}
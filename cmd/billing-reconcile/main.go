@@ -0,0 +1,69 @@
+// Command billing-reconcile compares a Polka billing export with Chirpy's
+// subscriptions and prints every mismatch. With -repair it also fixes
+// them, recording each change in subscription_audit_log.
+//
+//	go run ./cmd/billing-reconcile -export polka-export.csv -repair
+package main
+
+import (
+	"context"
+	"database/sql"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/Cmolloy36/Chirpy/internal/billing"
+	"github.com/Cmolloy36/Chirpy/internal/database"
+	"github.com/joho/godotenv"
+	_ "github.com/lib/pq"
+)
+
+func main() {
+	godotenv.Load()
+
+	source := flag.String("export", os.Getenv("BILLING_EXPORT"), "billing export file or URL (CSV or JSON)")
+	repair := flag.Bool("repair", false, "fix mismatches instead of only reporting them")
+	flag.Parse()
+
+	if *source == "" {
+		log.Fatal("no billing export given; pass -export or set BILLING_EXPORT")
+	}
+
+	policy, err := billing.PolicyFromEnv()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	db, err := sql.Open("postgres", os.Getenv("DB_URL"))
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer db.Close()
+
+	reconciler := billing.NewReconciler(db, database.New(db), policy, *source)
+
+	report, err := reconciler.Reconcile(context.Background(), *repair)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	for _, mismatch := range report.Mismatches {
+		fmt.Println(mismatch)
+	}
+
+	fmt.Printf("%d users checked, %d mismatches", report.Checked, len(report.Mismatches))
+	if *repair {
+		fmt.Printf(", %d repaired, %d skipped", report.Repaired, report.Skipped)
+	}
+	fmt.Println()
+
+	if report.RepairRefused != "" {
+		fmt.Println("Not repairing:", report.RepairRefused)
+		os.Exit(1)
+	}
+
+	if !*repair && len(report.Mismatches) > 0 {
+		os.Exit(1)
+	}
+}
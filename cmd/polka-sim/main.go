@@ -0,0 +1,99 @@
+// Command polka-sim sends Polka-style webhooks to a running Chirpy. It
+// reads POLKA_WEBHOOK_SECRETS and POLKA_KEY from the environment or .env,
+// like the server does.
+//
+//	go run ./cmd/polka-sim -user <uuid> -events user.upgraded,payment.failed,subscription.renewed -duplicates 0.3 -shuffle
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+
+	"github.com/Cmolloy36/Chirpy/internal/polkasim"
+	"github.com/google/uuid"
+	"github.com/joho/godotenv"
+)
+
+func main() {
+	godotenv.Load()
+
+	url := flag.String("url", "http://localhost:8080/api/polka/webhooks", "Chirpy's webhook endpoint")
+	secrets := flag.String("secrets", os.Getenv("POLKA_WEBHOOK_SECRETS"), "comma-separated signing secrets; empty sends the legacy API key")
+	apiKey := flag.String("api-key", os.Getenv("POLKA_KEY"), "API key sent when there are no signing secrets")
+	user := flag.String("user", "", "user ID the events are about (required)")
+	events := flag.String("events", "user.upgraded", "comma-separated event types, sent in this order unless -shuffle is set")
+	plan := flag.String("plan", "", "plan to send in each event's data")
+	periodEnd := flag.String("period-end", "", "current_period_end to send, in RFC 3339 format")
+	attempts := flag.Int("attempts", polkasim.DefaultMaxAttempts, "delivery attempts per event")
+	backoff := flag.Duration("backoff", polkasim.DefaultRetryBackoff, "wait before the first retry; doubles after each one")
+	duplicates := flag.Float64("duplicates", 0, "chance (0-1) of delivering each event a second time")
+	shuffle := flag.Bool("shuffle", false, "deliver events out of order")
+	seed := flag.Uint64("seed", 0, "random seed for -duplicates and -shuffle; 0 picks one")
+	flag.Parse()
+
+	userID, err := uuid.Parse(*user)
+	if err != nil {
+		log.Fatalf("invalid -user %q: %s", *user, err)
+	}
+
+	data := polkasim.Data{UserID: userID, Plan: *plan}
+
+	if *periodEnd != "" {
+		end, err := time.Parse(time.RFC3339, *periodEnd)
+		if err != nil {
+			log.Fatalf("invalid -period-end %q: %s", *periodEnd, err)
+		}
+		data.CurrentPeriodEnd = &end
+	}
+
+	var eventList []polkasim.Event
+	for _, eventType := range strings.Split(*events, ",") {
+		if eventType = strings.TrimSpace(eventType); eventType == "" {
+			continue
+		}
+
+		event := polkasim.NewEvent(eventType, userID)
+		event.Data = data
+		eventList = append(eventList, event)
+	}
+
+	config := polkasim.Config{
+		URL:           *url,
+		APIKey:        *apiKey,
+		MaxAttempts:   *attempts,
+		RetryBackoff:  *backoff,
+		DuplicateRate: *duplicates,
+		OutOfOrder:    *shuffle,
+		Seed:          *seed,
+	}
+
+	for _, secret := range strings.Split(*secrets, ",") {
+		if secret = strings.TrimSpace(secret); secret != "" {
+			config.Secrets = append(config.Secrets, secret)
+		}
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	delivered := map[string]bool{}
+	for _, attempt := range polkasim.New(config).Send(ctx, eventList...) {
+		fmt.Println(attempt)
+
+		if attempt.Succeeded() {
+			delivered[attempt.Event.ID] = true
+		}
+	}
+
+	for _, event := range eventList {
+		if !delivered[event.ID] {
+			log.Fatalf("event %s (%s) was not delivered", event.ID, event.Event)
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Cmolloy36/Chirpy/internal/billing"
+	"github.com/Cmolloy36/Chirpy/internal/entitlements"
+	"github.com/google/uuid"
+)
+
+type Entitlements struct {
+	Plan         string              `json:"plan"`
+	Capabilities []string            `json:"capabilities"`
+	Limits       entitlements.Limits `json:"limits"`
+}
+
+// planForUser is the entitlements plan a user is on: their subscription's
+// plan while it is paid up or in its grace period, otherwise the default.
+func (apiCfg *apiConfig) planForUser(ctx context.Context, userID uuid.UUID) (string, error) {
+	dbSubscription, err := apiCfg.dbQueries.GetSubscriptionForUser(ctx, userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return apiCfg.entitlements.DefaultPlan(), nil
+	} else if err != nil {
+		return "", err
+	}
+
+	sub := billing.FromDatabase(dbSubscription)
+
+	if !sub.Entitled(time.Now()) {
+		return apiCfg.entitlements.DefaultPlan(), nil
+	}
+
+	// Polka may bill under plan names we haven't configured; they still
+	// paid for Chirpy Red.
+	if !apiCfg.entitlements.HasPlan(sub.Plan) {
+		return billing.PlanChirpyRed, nil
+	}
+
+	return sub.Plan, nil
+}
+
+// respondWithEntitlementError answers with the denial's status, plus
+// Retry-After for an exhausted quota, and 500 for anything else.
+func respondWithEntitlementError(w http.ResponseWriter, err error) {
+	if denial, ok := entitlements.AsDenial(err); ok {
+		if !denial.ResetsAt.IsZero() {
+			retryAfter := int(math.Ceil(time.Until(denial.ResetsAt).Seconds()))
+			w.Header().Set("Retry-After", strconv.Itoa(max(retryAfter, 1)))
+		}
+
+		respondWithError(w, denial.Status(), denial.Error())
+		return
+	}
+
+	respondWithError(w, http.StatusInternalServerError, err.Error())
+}
+
+func (apiCfg *apiConfig) handlerGetEntitlements(w http.ResponseWriter, r *http.Request) {
+	userID, err := userIDFromContext(r.Context())
+	if err != nil {
+		errorMessage := err.Error()
+
+		respondWithError(w, http.StatusUnauthorized, errorMessage)
+		return
+	}
+
+	planName, err := apiCfg.planForUser(r.Context(), userID)
+	if err != nil {
+		errorMessage := err.Error()
+
+		respondWithError(w, http.StatusBadRequest, errorMessage)
+		return
+	}
+
+	plan := apiCfg.entitlements.Plan(planName)
+
+	retEntitlements := Entitlements{
+		Plan:         plan.Name,
+		Capabilities: plan.Capabilities,
+		Limits:       plan.Limits,
+	}
+
+	respondwithJSON(w, http.StatusOK, retEntitlements)
+}
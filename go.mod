@@ -13,6 +13,8 @@ require golang.org/x/crypto v0.37.0
 
 require github.com/golang-jwt/jwt/v5 v5.2.2
 
+require golang.org/x/sys v0.32.0 // indirect
+
 require (
 	github.com/davecgh/go-spew v1.1.1 // indirect
 	github.com/pmezard/go-difflib v1.0.0 // indirect
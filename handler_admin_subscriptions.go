@@ -0,0 +1,59 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type SubscriptionAuditEntry struct {
+	ID        uuid.UUID       `json:"id"`
+	CreatedAt time.Time       `json:"created_at"`
+	Source    string          `json:"source"`
+	Action    string          `json:"action"`
+	Detail    string          `json:"detail"`
+	Before    json.RawMessage `json:"before"`
+	After     json.RawMessage `json:"after"`
+}
+
+// handlerGetSubscriptionAudit lists every recorded change to a user's
+// subscription, newest first, whether it came from a webhook or from
+// reconciliation.
+func (apiCfg *apiConfig) handlerGetSubscriptionAudit(w http.ResponseWriter, r *http.Request) {
+	userID, err := uuid.Parse(r.PathValue("userID"))
+	if err != nil {
+		errorMessage := "Error parsing user ID"
+
+		respondWithError(w, http.StatusBadRequest, errorMessage)
+		return
+	}
+
+	dbEntries, err := apiCfg.dbQueries.GetSubscriptionAuditEntriesForUser(r.Context(), userID)
+	if err != nil {
+		errorMessage := err.Error()
+
+		respondWithError(w, http.StatusBadRequest, errorMessage)
+		return
+	}
+
+	retSlc := make([]SubscriptionAuditEntry, len(dbEntries))
+	for i, dbEntry := range dbEntries {
+		retSlc[i] = SubscriptionAuditEntry{
+			ID:        dbEntry.ID,
+			CreatedAt: dbEntry.CreatedAt,
+			Source:    dbEntry.Source,
+			Action:    dbEntry.Action,
+			Detail:    dbEntry.Detail,
+			Before:    json.RawMessage("null"),
+			After:     json.RawMessage(dbEntry.After),
+		}
+
+		if dbEntry.Before.Valid {
+			retSlc[i].Before = json.RawMessage(dbEntry.Before.String)
+		}
+	}
+
+	respondwithJSON(w, http.StatusOK, retSlc)
+}
@@ -0,0 +1,250 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Cmolloy36/Chirpy/internal/auth"
+	"github.com/Cmolloy36/Chirpy/internal/database"
+	"github.com/Cmolloy36/Chirpy/internal/mailer"
+	"github.com/google/uuid"
+)
+
+const (
+	waitlistStatusPending           = "pending"
+	waitlistStatusApproved          = "approved"
+	waitlistStatusAlreadyRegistered = "already_registered"
+)
+
+type WaitlistEntry struct {
+	ID        uuid.UUID  `json:"id"`
+	CreatedAt time.Time  `json:"created_at"`
+	Email     string     `json:"email"`
+	Status    string     `json:"status"`
+	UserID    *uuid.UUID `json:"user_id"`
+	DecidedAt *time.Time `json:"decided_at"`
+}
+
+// WaitlistSignup is what POST /api/users answers with in waitlist mode.
+type WaitlistSignup struct {
+	Email  string `json:"email"`
+	Status string `json:"status"`
+}
+
+func waitlistEntryFromDB(dbEntry database.WaitlistEntry) WaitlistEntry {
+	entry := WaitlistEntry{
+		ID:        dbEntry.ID,
+		CreatedAt: dbEntry.CreatedAt,
+		Email:     dbEntry.Email,
+		Status:    dbEntry.Status,
+	}
+
+	if dbEntry.UserID.Valid {
+		entry.UserID = &dbEntry.UserID.UUID
+	}
+
+	if dbEntry.DecidedAt.Valid {
+		entry.DecidedAt = &dbEntry.DecidedAt.Time
+	}
+
+	return entry
+}
+
+// handlerGetWaitlist lists waitlisted signups, oldest first. ?status=
+// filters by status and ?limit= caps the count.
+func (apiCfg *apiConfig) handlerGetWaitlist(w http.ResponseWriter, r *http.Request) {
+	limit := 50
+	if val := r.URL.Query().Get("limit"); val != "" {
+		parsed, err := strconv.Atoi(val)
+		if err != nil || parsed <= 0 {
+			errorMessage := "limit must be a positive integer"
+
+			respondWithError(w, http.StatusBadRequest, errorMessage)
+			return
+		}
+		limit = min(parsed, 500)
+	}
+
+	listWaitlistEntriesParams := database.ListWaitlistEntriesParams{
+		Status:   r.URL.Query().Get("status"),
+		RowLimit: int32(limit),
+	}
+
+	dbEntries, err := apiCfg.dbQueries.ListWaitlistEntries(r.Context(), listWaitlistEntriesParams)
+	if err != nil {
+		errorMessage := err.Error()
+
+		respondWithError(w, http.StatusBadRequest, errorMessage)
+		return
+	}
+
+	retSlc := make([]WaitlistEntry, len(dbEntries))
+	for i, dbEntry := range dbEntries {
+		retSlc[i] = waitlistEntryFromDB(dbEntry)
+	}
+
+	respondwithJSON(w, http.StatusOK, retSlc)
+}
+
+// handlerApproveWaitlist approves a batch of pending signups, either the
+// oldest "count" of them or the ones listed in "ids". Each approved signup
+// becomes an account with the password given when joining the waitlist,
+// and is emailed. Addresses that registered some other way in the meantime
+// are marked already_registered.
+func (apiCfg *apiConfig) handlerApproveWaitlist(w http.ResponseWriter, r *http.Request) {
+	type inputJSON struct {
+		Count int         `json:"count"`
+		IDs   []uuid.UUID `json:"ids"`
+	}
+
+	var inputData inputJSON
+
+	decoder := json.NewDecoder(r.Body)
+
+	defer r.Body.Close()
+
+	if err := decoder.Decode(&inputData); err != nil {
+		errorMessage := err.Error()
+
+		respondWithError(w, http.StatusBadRequest, errorMessage)
+		return
+	}
+
+	if (inputData.Count > 0) == (len(inputData.IDs) > 0) {
+		errorMessage := "give either a positive count or a list of ids"
+
+		respondWithError(w, http.StatusBadRequest, errorMessage)
+		return
+	}
+
+	tx, err := apiCfg.db.BeginTx(r.Context(), nil)
+	if err != nil {
+		errorMessage := err.Error()
+
+		respondWithError(w, http.StatusInternalServerError, errorMessage)
+		return
+	}
+	defer tx.Rollback()
+
+	qtx := apiCfg.dbQueries.WithTx(tx)
+
+	var dbEntries []database.WaitlistEntry
+	if inputData.Count > 0 {
+		dbEntries, err = qtx.GetPendingWaitlistEntries(r.Context(), int32(min(inputData.Count, 500)))
+		if err != nil {
+			errorMessage := err.Error()
+
+			respondWithError(w, http.StatusBadRequest, errorMessage)
+			return
+		}
+	}
+
+	// IDs that aren't pending any more are skipped, and repeated IDs are
+	// only approved once.
+	seen := map[uuid.UUID]bool{}
+	for _, id := range inputData.IDs {
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+
+		dbEntry, err := qtx.GetPendingWaitlistEntry(r.Context(), id)
+		if errors.Is(err, sql.ErrNoRows) {
+			continue
+		} else if err != nil {
+			errorMessage := err.Error()
+
+			respondWithError(w, http.StatusBadRequest, errorMessage)
+			return
+		}
+
+		dbEntries = append(dbEntries, dbEntry)
+	}
+
+	var approved []database.User
+	retSlc := make([]WaitlistEntry, len(dbEntries))
+	for i, dbEntry := range dbEntries {
+		resolveWaitlistEntryParams := database.ResolveWaitlistEntryParams{
+			ID:     dbEntry.ID,
+			Status: waitlistStatusAlreadyRegistered,
+		}
+
+		_, err := qtx.GetUser(r.Context(), dbEntry.Email)
+		if errors.Is(err, sql.ErrNoRows) {
+			createUserParams := database.CreateUserParams{
+				Email:          dbEntry.Email,
+				HashedPassword: dbEntry.HashedPassword,
+			}
+
+			dbUser, err := qtx.CreateUser(r.Context(), createUserParams)
+			if err != nil {
+				errorMessage := err.Error()
+
+				respondWithError(w, http.StatusBadRequest, errorMessage)
+				return
+			}
+
+			resolveWaitlistEntryParams.Status = waitlistStatusApproved
+			resolveWaitlistEntryParams.UserID = uuid.NullUUID{UUID: dbUser.ID, Valid: true}
+			approved = append(approved, dbUser)
+		} else if err != nil {
+			errorMessage := err.Error()
+
+			respondWithError(w, http.StatusBadRequest, errorMessage)
+			return
+		}
+
+		if err := qtx.ResolveWaitlistEntry(r.Context(), resolveWaitlistEntryParams); err != nil {
+			errorMessage := err.Error()
+
+			respondWithError(w, http.StatusBadRequest, errorMessage)
+			return
+		}
+
+		dbEntry.Status = resolveWaitlistEntryParams.Status
+		dbEntry.UserID = resolveWaitlistEntryParams.UserID
+		dbEntry.DecidedAt = sql.NullTime{Time: time.Now(), Valid: true}
+		retSlc[i] = waitlistEntryFromDB(dbEntry)
+	}
+
+	if err := tx.Commit(); err != nil {
+		errorMessage := err.Error()
+
+		respondWithError(w, http.StatusInternalServerError, errorMessage)
+		return
+	}
+
+	// The accounts exist either way; the user can ask for a new link.
+	for _, dbUser := range approved {
+		if err := apiCfg.sendWaitlistApprovalEmail(r.Context(), dbUser); err != nil {
+			log.Printf("Error sending waitlist approval email: %s", err)
+		}
+	}
+
+	respondwithJSON(w, http.StatusOK, retSlc)
+}
+
+// sendWaitlistApprovalEmail tells a user their account is ready. It doubles
+// as the verification email, since they have not had one yet.
+func (apiCfg *apiConfig) sendWaitlistApprovalEmail(ctx context.Context, dbUser database.User) error {
+	token, err := apiCfg.createEmailToken(ctx, dbUser.ID, auth.PurposeVerifyEmail, dbUser.Email, verifyEmailTTL)
+	if err != nil {
+		return err
+	}
+
+	msg := mailer.Message{
+		To:      dbUser.Email,
+		Subject: "You're off the Chirpy waitlist",
+		Body: fmt.Sprintf("Your Chirpy account is ready. Log in with the email address and password you signed up with.\n\nPlease also confirm your email address by opening this link:\n\n%s/app/verify-email?token=%s\n\nThe link expires in 24 hours.\n",
+			apiCfg.publicBaseURL, token),
+	}
+
+	return apiCfg.mailer.Send(ctx, msg)
+}
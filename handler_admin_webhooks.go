@@ -0,0 +1,121 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Cmolloy36/Chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+type WebhookEvent struct {
+	ID          uuid.UUID       `json:"id"`
+	CreatedAt   time.Time       `json:"created_at"`
+	Source      string          `json:"source"`
+	EventID     string          `json:"event_id"`
+	EventType   string          `json:"event_type"`
+	Payload     json.RawMessage `json:"payload"`
+	Status      string          `json:"status"`
+	Error       string          `json:"error,omitempty"`
+	Attempts    int32           `json:"attempts"`
+	ProcessedAt *time.Time      `json:"processed_at"`
+}
+
+func webhookEventFromDB(dbEvent database.WebhookEvent) WebhookEvent {
+	webhookEvent := WebhookEvent{
+		ID:        dbEvent.ID,
+		CreatedAt: dbEvent.CreatedAt,
+		Source:    dbEvent.Source,
+		EventID:   dbEvent.EventID,
+		EventType: dbEvent.EventType,
+		Payload:   json.RawMessage(dbEvent.Payload),
+		Status:    dbEvent.Status,
+		Error:     dbEvent.Error.String,
+		Attempts:  dbEvent.Attempts,
+	}
+
+	if dbEvent.ProcessedAt.Valid {
+		webhookEvent.ProcessedAt = &dbEvent.ProcessedAt.Time
+	}
+
+	return webhookEvent
+}
+
+// handlerGetWebhookEvents lists stored webhook deliveries, newest first.
+// ?status= filters by processing status and ?limit= caps the count.
+func (apiCfg *apiConfig) handlerGetWebhookEvents(w http.ResponseWriter, r *http.Request) {
+	limit := 50
+	if val := r.URL.Query().Get("limit"); val != "" {
+		parsed, err := strconv.Atoi(val)
+		if err != nil || parsed <= 0 {
+			errorMessage := "limit must be a positive integer"
+
+			respondWithError(w, http.StatusBadRequest, errorMessage)
+			return
+		}
+
+		limit = min(parsed, 500)
+	}
+
+	listWebhookEventsParams := database.ListWebhookEventsParams{
+		Status:   r.URL.Query().Get("status"),
+		RowLimit: int32(limit),
+	}
+
+	dbEvents, err := apiCfg.dbQueries.ListWebhookEvents(r.Context(), listWebhookEventsParams)
+	if err != nil {
+		errorMessage := err.Error()
+
+		respondWithError(w, http.StatusBadRequest, errorMessage)
+		return
+	}
+
+	retSlc := make([]WebhookEvent, len(dbEvents))
+	for i, dbEvent := range dbEvents {
+		retSlc[i] = webhookEventFromDB(dbEvent)
+	}
+
+	respondwithJSON(w, http.StatusOK, retSlc)
+}
+
+// handlerReplayWebhookEvent processes a failed event again, e.g. after the
+// bug that made it fail has been fixed. The response shows the new outcome.
+func (apiCfg *apiConfig) handlerReplayWebhookEvent(w http.ResponseWriter, r *http.Request) {
+	eventID, err := uuid.Parse(r.PathValue("eventID"))
+	if err != nil {
+		errorMessage := "Error parsing event ID"
+
+		respondWithError(w, http.StatusBadRequest, errorMessage)
+		return
+	}
+
+	dbEvent, err := apiCfg.dbQueries.GetWebhookEvent(r.Context(), eventID)
+	if err != nil {
+		errorMessage := "webhook event not found"
+
+		respondWithError(w, http.StatusNotFound, errorMessage)
+		return
+	}
+
+	if dbEvent.Status != webhookStatusFailed {
+		errorMessage := "only failed events can be replayed"
+
+		respondWithError(w, http.StatusConflict, errorMessage)
+		return
+	}
+
+	// A failed replay is recorded on the event, which is what the caller
+	// needs to see, so it isn't an error response.
+	dbEvent, err = apiCfg.processWebhookEvent(r.Context(), dbEvent)
+	if errors.Is(err, errWebhookInProgress) {
+		errorMessage := err.Error()
+
+		respondWithError(w, http.StatusConflict, errorMessage)
+		return
+	}
+
+	respondwithJSON(w, http.StatusOK, webhookEventFromDB(dbEvent))
+}
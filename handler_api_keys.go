@@ -0,0 +1,310 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Cmolloy36/Chirpy/internal/auth"
+	"github.com/Cmolloy36/Chirpy/internal/database"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+var errInvalidAPIKey = errors.New("invalid API key")
+
+type APIKey struct {
+	ID         uuid.UUID  `json:"id"`
+	CreatedAt  time.Time  `json:"created_at"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Scopes     []string   `json:"scopes"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	Key        string     `json:"key,omitempty"`
+}
+
+func apiKeyFromDB(dbKey database.ApiKey) APIKey {
+	apiKey := APIKey{
+		ID:        dbKey.ID,
+		CreatedAt: dbKey.CreatedAt,
+		Name:      dbKey.Name,
+		Prefix:    dbKey.KeyPrefix,
+		Scopes:    strings.Fields(dbKey.Scope),
+	}
+
+	if dbKey.ExpiresAt.Valid {
+		apiKey.ExpiresAt = &dbKey.ExpiresAt.Time
+	}
+
+	if dbKey.LastUsedAt.Valid {
+		apiKey.LastUsedAt = &dbKey.LastUsedAt.Time
+	}
+
+	return apiKey
+}
+
+// claimsFromAPIKey authenticates an "Authorization: ApiKey ..." header and
+// returns claims equivalent to an access token with the key's scopes.
+func (apiCfg *apiConfig) claimsFromAPIKey(ctx context.Context, headers http.Header) (auth.Claims, error) {
+	key, err := auth.GetAPIKey(headers)
+	if err != nil {
+		return auth.Claims{}, err
+	}
+
+	dbKey, err := apiCfg.dbQueries.GetAPIKeyByHash(ctx, auth.HashAPIKey(key))
+	if err != nil {
+		return auth.Claims{}, errInvalidAPIKey
+	}
+
+	if dbKey.RevokedAt.Valid || (dbKey.ExpiresAt.Valid && time.Now().After(dbKey.ExpiresAt.Time)) {
+		return auth.Claims{}, errInvalidAPIKey
+	}
+
+	// Recording every use would mean a write per request; a minute's
+	// precision is plenty for "last used".
+	if !dbKey.LastUsedAt.Valid || time.Since(dbKey.LastUsedAt.Time) > time.Minute {
+		if err := apiCfg.dbQueries.TouchAPIKey(ctx, dbKey.ID); err != nil {
+			log.Printf("Error recording API key use: %s", err)
+		}
+	}
+
+	claims := auth.Claims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:  dbKey.UserID.String(),
+			IssuedAt: jwt.NewNumericDate(dbKey.CreatedAt),
+		},
+		Scope:    dbKey.Scope,
+		APIKeyID: dbKey.ID.String(),
+	}
+
+	if dbKey.ExpiresAt.Valid {
+		claims.ExpiresAt = jwt.NewNumericDate(dbKey.ExpiresAt.Time)
+	}
+
+	return claims, nil
+}
+
+// handlerPostAPIKey creates a personal API key. The key itself is returned
+// only in this response; Chirpy keeps just its hash.
+func (apiCfg *apiConfig) handlerPostAPIKey(w http.ResponseWriter, r *http.Request) {
+	type inputJSON struct {
+		Name      string     `json:"name"`
+		Scopes    []string   `json:"scopes"`
+		ExpiresAt *time.Time `json:"expires_at"`
+	}
+
+	var inputData inputJSON
+
+	decoder := json.NewDecoder(r.Body)
+
+	defer r.Body.Close()
+
+	if err := decoder.Decode(&inputData); err != nil {
+		errorMessage := err.Error()
+
+		respondWithError(w, http.StatusBadRequest, errorMessage)
+		return
+	}
+
+	userID, err := userIDFromContext(r.Context())
+	if err != nil {
+		errorMessage := err.Error()
+
+		respondWithError(w, http.StatusUnauthorized, errorMessage)
+		return
+	}
+
+	fieldErrors := map[string][]string{}
+
+	if strings.TrimSpace(inputData.Name) == "" {
+		fieldErrors["name"] = []string{"is required"}
+	}
+
+	if len(inputData.Scopes) == 0 {
+		fieldErrors["scopes"] = []string{"at least one is required"}
+	}
+
+	for _, scope := range inputData.Scopes {
+		if !auth.IsValidScope(scope) {
+			fieldErrors["scopes"] = append(fieldErrors["scopes"], "unknown scope "+scope)
+		}
+	}
+
+	var expiresAt sql.NullTime
+
+	if inputData.ExpiresAt != nil {
+		if !inputData.ExpiresAt.After(time.Now()) {
+			fieldErrors["expires_at"] = []string{"must be in the future"}
+		}
+
+		expiresAt = sql.NullTime{Time: *inputData.ExpiresAt, Valid: true}
+	}
+
+	if len(fieldErrors) > 0 {
+		respondWithFieldErrors(w, http.StatusBadRequest, fieldErrors)
+		return
+	}
+
+	key, err := auth.MakeAPIKey()
+	if err != nil {
+		errorMessage := err.Error()
+
+		respondWithError(w, http.StatusInternalServerError, errorMessage)
+		return
+	}
+
+	createAPIKeyParams := database.CreateAPIKeyParams{
+		UserID:    userID,
+		Name:      strings.TrimSpace(inputData.Name),
+		KeyPrefix: auth.APIKeyDisplayPrefix(key),
+		KeyHash:   auth.HashAPIKey(key),
+		Scope:     strings.Join(inputData.Scopes, " "),
+		ExpiresAt: expiresAt,
+	}
+
+	dbKey, err := apiCfg.dbQueries.CreateAPIKey(r.Context(), createAPIKeyParams)
+	if err != nil {
+		errorMessage := err.Error()
+
+		respondWithError(w, http.StatusBadRequest, errorMessage)
+		return
+	}
+
+	apiKey := apiKeyFromDB(dbKey)
+	apiKey.Key = key
+
+	respondwithJSON(w, http.StatusCreated, apiKey)
+}
+
+func (apiCfg *apiConfig) handlerGetAPIKeys(w http.ResponseWriter, r *http.Request) {
+	userID, err := userIDFromContext(r.Context())
+	if err != nil {
+		errorMessage := err.Error()
+
+		respondWithError(w, http.StatusUnauthorized, errorMessage)
+		return
+	}
+
+	dbKeys, err := apiCfg.dbQueries.GetAPIKeysForUser(r.Context(), userID)
+	if err != nil {
+		errorMessage := err.Error()
+
+		respondWithError(w, http.StatusBadRequest, errorMessage)
+		return
+	}
+
+	retSlc := make([]APIKey, len(dbKeys))
+	for i, dbKey := range dbKeys {
+		retSlc[i] = apiKeyFromDB(dbKey)
+	}
+
+	respondwithJSON(w, http.StatusOK, retSlc)
+}
+
+func (apiCfg *apiConfig) handlerPatchAPIKey(w http.ResponseWriter, r *http.Request) {
+	keyID, err := uuid.Parse(r.PathValue("keyID"))
+	if err != nil {
+		errorMessage := "Error parsing key ID"
+
+		respondWithError(w, http.StatusBadRequest, errorMessage)
+		return
+	}
+
+	type inputJSON struct {
+		Name string `json:"name"`
+	}
+
+	var inputData inputJSON
+
+	decoder := json.NewDecoder(r.Body)
+
+	defer r.Body.Close()
+
+	if err := decoder.Decode(&inputData); err != nil {
+		errorMessage := err.Error()
+
+		respondWithError(w, http.StatusBadRequest, errorMessage)
+		return
+	}
+
+	userID, err := userIDFromContext(r.Context())
+	if err != nil {
+		errorMessage := err.Error()
+
+		respondWithError(w, http.StatusUnauthorized, errorMessage)
+		return
+	}
+
+	if strings.TrimSpace(inputData.Name) == "" {
+		respondWithFieldErrors(w, http.StatusBadRequest, map[string][]string{"name": {"is required"}})
+		return
+	}
+
+	renameAPIKeyParams := database.RenameAPIKeyParams{
+		ID:     keyID,
+		UserID: userID,
+		Name:   strings.TrimSpace(inputData.Name),
+	}
+
+	dbKey, err := apiCfg.dbQueries.RenameAPIKey(r.Context(), renameAPIKeyParams)
+	if errors.Is(err, sql.ErrNoRows) {
+		errorMessage := "API key not found"
+
+		respondWithError(w, http.StatusNotFound, errorMessage)
+		return
+	} else if err != nil {
+		errorMessage := err.Error()
+
+		respondWithError(w, http.StatusBadRequest, errorMessage)
+		return
+	}
+
+	respondwithJSON(w, http.StatusOK, apiKeyFromDB(dbKey))
+}
+
+// handlerDeleteAPIKey revokes a key. It stops working immediately.
+func (apiCfg *apiConfig) handlerDeleteAPIKey(w http.ResponseWriter, r *http.Request) {
+	keyID, err := uuid.Parse(r.PathValue("keyID"))
+	if err != nil {
+		errorMessage := "Error parsing key ID"
+
+		respondWithError(w, http.StatusBadRequest, errorMessage)
+		return
+	}
+
+	userID, err := userIDFromContext(r.Context())
+	if err != nil {
+		errorMessage := err.Error()
+
+		respondWithError(w, http.StatusUnauthorized, errorMessage)
+		return
+	}
+
+	revokeAPIKeyParams := database.RevokeAPIKeyParams{
+		ID:     keyID,
+		UserID: userID,
+	}
+
+	rows, err := apiCfg.dbQueries.RevokeAPIKey(r.Context(), revokeAPIKeyParams)
+	if err != nil {
+		errorMessage := err.Error()
+
+		respondWithError(w, http.StatusBadRequest, errorMessage)
+		return
+	}
+
+	if rows == 0 {
+		errorMessage := "API key not found"
+
+		respondWithError(w, http.StatusNotFound, errorMessage)
+		return
+	}
+
+	respondwithJSON(w, http.StatusNoContent, nil)
+}
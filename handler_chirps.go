@@ -9,8 +9,9 @@ import (
 	"sort"
 	"strings"
 
-	"github.com/Cmolloy36/Chirpy/internal/auth"
 	"github.com/Cmolloy36/Chirpy/internal/database"
+	"github.com/Cmolloy36/Chirpy/internal/entitlements"
+	"github.com/Cmolloy36/Chirpy/internal/webhooks"
 	"github.com/google/uuid"
 )
 
@@ -25,15 +26,7 @@ func (apiCfg *apiConfig) handlerDeleteChirp(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
-	accessTokenString, err := auth.GetBearerToken(r.Header)
-	if err != nil {
-		errorMessage := err.Error()
-
-		respondWithError(w, http.StatusUnauthorized, errorMessage)
-		return
-	}
-
-	userID, err := auth.ValidateJWT(accessTokenString, apiCfg.secretString)
+	userID, err := userIDFromContext(r.Context())
 	if err != nil {
 		errorMessage := err.Error()
 
@@ -61,13 +54,46 @@ func (apiCfg *apiConfig) handlerDeleteChirp(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
-	if err := apiCfg.dbQueries.DeleteChirp(r.Context(), chirpID); err != nil {
+	tx, err := apiCfg.db.BeginTx(r.Context(), nil)
+	if err != nil {
+		errorMessage := err.Error()
+
+		respondWithError(w, http.StatusInternalServerError, errorMessage)
+		return
+	}
+	defer tx.Rollback()
+
+	qtx := apiCfg.dbQueries.WithTx(tx)
+
+	if err := qtx.DeleteChirp(r.Context(), chirpID); err != nil {
 		errorMessage := err.Error()
 
 		respondWithError(w, http.StatusBadRequest, errorMessage)
 		return
 	}
 
+	retChirp := Chirp{
+		ID:        chirp.ID,
+		CreatedAt: chirp.CreatedAt,
+		UpdatedAt: chirp.UpdatedAt,
+		Body:      chirp.Body,
+		UserID:    chirp.UserID,
+	}
+
+	if err := webhooks.Enqueue(r.Context(), qtx, chirp.UserID, webhooks.EventChirpDeleted, retChirp); err != nil {
+		errorMessage := err.Error()
+
+		respondWithError(w, http.StatusInternalServerError, errorMessage)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		errorMessage := err.Error()
+
+		respondWithError(w, http.StatusInternalServerError, errorMessage)
+		return
+	}
+
 	respondwithJSON(w, http.StatusNoContent, nil)
 }
 
@@ -203,38 +229,54 @@ func (apiCfg *apiConfig) handlerPostChirp(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	token, err := auth.GetBearerToken(r.Header)
+	validatedUserID, err := userIDFromContext(r.Context())
 	if err != nil {
 		errorMessage := err.Error()
 
-		respondWithError(w, http.StatusBadRequest, errorMessage)
+		respondWithError(w, http.StatusUnauthorized, errorMessage)
 		return
 	}
 
-	validatedUserID, err := auth.ValidateJWT(token, apiCfg.secretString)
+	plan, err := apiCfg.planForUser(r.Context(), validatedUserID)
 	if err != nil {
 		errorMessage := err.Error()
 
-		respondWithError(w, http.StatusUnauthorized, errorMessage)
+		respondWithError(w, http.StatusBadRequest, errorMessage)
 		return
 	}
 
-	if len(inputData.Body) > 140 {
+	if err := apiCfg.entitlements.AllowChirpLength(plan, len(inputData.Body)); err != nil {
+		respondWithEntitlementError(w, err)
+		return
+	}
 
-		errorMessage := "Chirp is too long"
+	cleanedBody := removeProfanity(inputData.Body)
 
-		respondWithError(w, http.StatusBadRequest, errorMessage)
+	tx, err := apiCfg.db.BeginTx(r.Context(), nil)
+	if err != nil {
+		errorMessage := err.Error()
+
+		respondWithError(w, http.StatusInternalServerError, errorMessage)
 		return
 	}
+	defer tx.Rollback()
 
-	cleanedBody := removeProfanity(inputData.Body)
+	qtx := apiCfg.dbQueries.WithTx(tx)
+
+	// The quota is charged in the same transaction as the insert, so a
+	// failed insert doesn't use any of it up.
+	remaining, err := apiCfg.consumeQuota(r.Context(), qtx, validatedUserID, plan, entitlements.MetricChirps)
+	if err != nil {
+		respondWithEntitlementError(w, err)
+		return
+	}
 
 	createChirpParams := database.CreateChirpParams{
 		Body:   cleanedBody,
 		UserID: validatedUserID,
 	}
 
-	chirp, err := apiCfg.dbQueries.CreateChirp(context.Background(), createChirpParams)
+	chirp, err := qtx.CreateChirp(r.Context(), createChirpParams)
 	if err != nil {
 		errorMessage := "Error creating chirp"
 
@@ -250,9 +292,71 @@ func (apiCfg *apiConfig) handlerPostChirp(w http.ResponseWriter, r *http.Request
 		UserID:    chirp.UserID,
 	}
 
+	if err := webhooks.Enqueue(r.Context(), qtx, chirp.UserID, webhooks.EventChirpCreated, retChirp); err != nil {
+		errorMessage := err.Error()
+
+		respondWithError(w, http.StatusInternalServerError, errorMessage)
+		return
+	}
+
+	// Mentioning an unknown user queues nothing, since they have no
+	// endpoints.
+	for _, mentionedID := range chirpMentions(cleanedBody) {
+		if mentionedID == chirp.UserID {
+			continue
+		}
+
+		if err := webhooks.Enqueue(r.Context(), qtx, mentionedID, webhooks.EventChirpMentioned, retChirp); err != nil {
+			errorMessage := err.Error()
+
+			respondWithError(w, http.StatusInternalServerError, errorMessage)
+			return
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		errorMessage := "Error creating chirp"
+
+		respondWithError(w, http.StatusBadRequest, errorMessage)
+		return
+	}
+
+	setQuotaRemaining(w, entitlements.MetricChirps, remaining)
+
 	respondwithJSON(w, http.StatusCreated, retChirp)
 }
 
+// maxMentions caps how many users one chirp can notify.
+const maxMentions = 10
+
+// chirpMentions returns the users a chirp body mentions, in order and
+// without repeats. Users have no handles, so a mention is "@" followed by
+// the user's ID, e.g. "@3f1c0e5a-...". Trailing punctuation is ignored.
+func chirpMentions(body string) []uuid.UUID {
+	var mentions []uuid.UUID
+	seen := map[uuid.UUID]bool{}
+
+	for _, word := range strings.Fields(body) {
+		word, ok := strings.CutPrefix(word, "@")
+		if !ok {
+			continue
+		}
+
+		userID, err := uuid.Parse(strings.TrimRight(word, ".,;:!?)"))
+		if err != nil || seen[userID] {
+			continue
+		}
+		seen[userID] = true
+
+		mentions = append(mentions, userID)
+		if len(mentions) == maxMentions {
+			break
+		}
+	}
+
+	return mentions
+}
+
 var profaneWords []string = []string{"kerfuffle", "sharbert", "fornax"}
 
 func removeProfanity(chirpBody string) string {
@@ -0,0 +1,24 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestChirpMentions(t *testing.T) {
+	alice, bob := uuid.New(), uuid.New()
+
+	body := "hi @" + alice.String() + ", and @" + bob.String() + "! again @" + alice.String() + " not@" + bob.String() + " @nobody"
+	assert.Equal(t, []uuid.UUID{alice, bob}, chirpMentions(body))
+
+	assert.Empty(t, chirpMentions("no mentions here"))
+
+	var words []string
+	for range maxMentions + 5 {
+		words = append(words, "@"+uuid.NewString())
+	}
+	assert.Len(t, chirpMentions(strings.Join(words, " ")), maxMentions)
+}
@@ -0,0 +1,427 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/Cmolloy36/Chirpy/internal/auth"
+	"github.com/Cmolloy36/Chirpy/internal/database"
+	"github.com/Cmolloy36/Chirpy/internal/mailer"
+	"github.com/google/uuid"
+)
+
+const (
+	verifyEmailTTL   = 24 * time.Hour
+	resetPasswordTTL = time.Hour
+)
+
+// createEmailToken records a single-use token for userID and returns its
+// signed form. The email is stored so that a token minted for an old
+// address stops working once the address changes.
+func (apiCfg *apiConfig) createEmailToken(ctx context.Context, userID uuid.UUID, purpose, email string, ttl time.Duration) (string, error) {
+	expiresAt := time.Now().Add(ttl)
+
+	createEmailTokenParams := database.CreateEmailTokenParams{
+		UserID:    userID,
+		Purpose:   purpose,
+		Email:     email,
+		ExpiresAt: expiresAt,
+	}
+
+	emailToken, err := apiCfg.dbQueries.CreateEmailToken(ctx, createEmailTokenParams)
+	if err != nil {
+		return "", err
+	}
+
+	return auth.MakeSignedToken(emailToken.ID, purpose, expiresAt, apiCfg.secretString), nil
+}
+
+// useEmailToken verifies a signed token and marks its row used. It fails if
+// the token was already used, has expired, or was minted for another purpose.
+// Pass a transaction's queries to spend the token only if it commits.
+func (apiCfg *apiConfig) useEmailToken(ctx context.Context, q *database.Queries, token, purpose string) (database.EmailToken, error) {
+	tokenID, err := auth.ParseSignedToken(token, purpose, apiCfg.secretString)
+	if err != nil {
+		return database.EmailToken{}, err
+	}
+
+	useEmailTokenParams := database.UseEmailTokenParams{
+		ID:      tokenID,
+		Purpose: purpose,
+	}
+
+	emailToken, err := q.UseEmailToken(ctx, useEmailTokenParams)
+	if err != nil {
+		return database.EmailToken{}, auth.ErrInvalidSignedToken
+	}
+
+	return emailToken, nil
+}
+
+func (apiCfg *apiConfig) sendVerificationEmail(ctx context.Context, userID uuid.UUID, email string) error {
+	token, err := apiCfg.createEmailToken(ctx, userID, auth.PurposeVerifyEmail, email, verifyEmailTTL)
+	if err != nil {
+		return err
+	}
+
+	msg := mailer.Message{
+		To:      email,
+		Subject: "Confirm your Chirpy email address",
+		Body: fmt.Sprintf("Welcome to Chirpy!\n\nConfirm your email address by opening this link:\n\n%s/app/verify-email?token=%s\n\nThe link expires in 24 hours.\n",
+			apiCfg.publicBaseURL, token),
+	}
+
+	return apiCfg.mailer.Send(ctx, msg)
+}
+
+// startEmailChange sends a confirmation link to newEmail and lets the
+// current address know a change was requested. Any earlier pending change
+// is cancelled.
+func (apiCfg *apiConfig) startEmailChange(ctx context.Context, dbUser database.User, newEmail string) error {
+	invalidateEmailTokensParams := database.InvalidateEmailTokensParams{
+		UserID:  dbUser.ID,
+		Purpose: auth.PurposeChangeEmail,
+	}
+
+	if err := apiCfg.dbQueries.InvalidateEmailTokens(ctx, invalidateEmailTokensParams); err != nil {
+		return err
+	}
+
+	token, err := apiCfg.createEmailToken(ctx, dbUser.ID, auth.PurposeChangeEmail, newEmail, verifyEmailTTL)
+	if err != nil {
+		return err
+	}
+
+	confirmMsg := mailer.Message{
+		To:      newEmail,
+		Subject: "Confirm your new Chirpy email address",
+		Body: fmt.Sprintf("Someone asked to move a Chirpy account to this address.\n\nIf it was you, confirm by opening this link:\n\n%s/app/confirm-email-change?token=%s\n\nThe link expires in 24 hours.\n",
+			apiCfg.publicBaseURL, token),
+	}
+
+	if err := apiCfg.mailer.Send(ctx, confirmMsg); err != nil {
+		return err
+	}
+
+	noticeMsg := mailer.Message{
+		To:      dbUser.Email,
+		Subject: "Your Chirpy email address is being changed",
+		Body: fmt.Sprintf("We received a request to change the email address on your Chirpy account to %s.\n\nNothing changes until the new address is confirmed. If this wasn't you, change your password at %s/app/reset-password.\n",
+			newEmail, apiCfg.publicBaseURL),
+	}
+
+	return apiCfg.mailer.Send(ctx, noticeMsg)
+}
+
+func (apiCfg *apiConfig) handlerConfirmEmailChange(w http.ResponseWriter, r *http.Request) {
+	type inputJSON struct {
+		Token string `json:"token"`
+	}
+
+	var inputData inputJSON
+
+	decoder := json.NewDecoder(r.Body)
+
+	defer r.Body.Close()
+
+	if err := decoder.Decode(&inputData); err != nil {
+		errorMessage := err.Error()
+
+		respondWithError(w, http.StatusBadRequest, errorMessage)
+		return
+	}
+
+	emailToken, err := apiCfg.useEmailToken(r.Context(), apiCfg.dbQueries, inputData.Token, auth.PurposeChangeEmail)
+	if err != nil {
+		errorMessage := err.Error()
+
+		respondWithError(w, http.StatusBadRequest, errorMessage)
+		return
+	}
+
+	if _, err := apiCfg.dbQueries.GetUser(r.Context(), emailToken.Email); err == nil {
+		errorMessage := "email address is already in use"
+
+		respondWithError(w, http.StatusConflict, errorMessage)
+		return
+	}
+
+	changeUserEmailParams := database.ChangeUserEmailParams{
+		ID:    emailToken.UserID,
+		Email: emailToken.Email,
+	}
+
+	dbUser, err := apiCfg.dbQueries.ChangeUserEmail(r.Context(), changeUserEmailParams)
+	if err != nil {
+		errorMessage := err.Error()
+
+		respondWithError(w, http.StatusBadRequest, errorMessage)
+		return
+	}
+
+	user := User{
+		ID:            dbUser.ID,
+		CreatedAt:     dbUser.CreatedAt,
+		UpdatedAt:     dbUser.UpdatedAt,
+		Email:         dbUser.Email,
+		EmailVerified: dbUser.EmailVerifiedAt.Valid,
+		IsChirpyRed:   dbUser.IsChirpyRed,
+	}
+
+	respondwithJSON(w, http.StatusOK, user)
+}
+
+func (apiCfg *apiConfig) handlerVerifyEmail(w http.ResponseWriter, r *http.Request) {
+	type inputJSON struct {
+		Token string `json:"token"`
+	}
+
+	var inputData inputJSON
+
+	decoder := json.NewDecoder(r.Body)
+
+	defer r.Body.Close()
+
+	if err := decoder.Decode(&inputData); err != nil {
+		errorMessage := err.Error()
+
+		respondWithError(w, http.StatusBadRequest, errorMessage)
+		return
+	}
+
+	emailToken, err := apiCfg.useEmailToken(r.Context(), apiCfg.dbQueries, inputData.Token, auth.PurposeVerifyEmail)
+	if err != nil {
+		errorMessage := err.Error()
+
+		respondWithError(w, http.StatusBadRequest, errorMessage)
+		return
+	}
+
+	markEmailVerifiedParams := database.MarkEmailVerifiedParams{
+		ID:    emailToken.UserID,
+		Email: emailToken.Email,
+	}
+
+	dbUser, err := apiCfg.dbQueries.MarkEmailVerified(r.Context(), markEmailVerifiedParams)
+	if err != nil {
+		errorMessage := auth.ErrInvalidSignedToken.Error()
+
+		respondWithError(w, http.StatusBadRequest, errorMessage)
+		return
+	}
+
+	user := User{
+		ID:            dbUser.ID,
+		CreatedAt:     dbUser.CreatedAt,
+		UpdatedAt:     dbUser.UpdatedAt,
+		Email:         dbUser.Email,
+		EmailVerified: dbUser.EmailVerifiedAt.Valid,
+		IsChirpyRed:   dbUser.IsChirpyRed,
+	}
+
+	respondwithJSON(w, http.StatusOK, user)
+}
+
+func (apiCfg *apiConfig) handlerResendVerificationEmail(w http.ResponseWriter, r *http.Request) {
+	userID, err := userIDFromContext(r.Context())
+	if err != nil {
+		errorMessage := err.Error()
+
+		respondWithError(w, http.StatusUnauthorized, errorMessage)
+		return
+	}
+
+	dbUser, err := apiCfg.dbQueries.GetUserFromID(r.Context(), userID)
+	if err != nil {
+		errorMessage := err.Error()
+
+		respondWithError(w, http.StatusBadRequest, errorMessage)
+		return
+	}
+
+	if dbUser.EmailVerifiedAt.Valid {
+		errorMessage := "email address is already verified"
+
+		respondWithError(w, http.StatusConflict, errorMessage)
+		return
+	}
+
+	invalidateEmailTokensParams := database.InvalidateEmailTokensParams{
+		UserID:  userID,
+		Purpose: auth.PurposeVerifyEmail,
+	}
+
+	if err := apiCfg.dbQueries.InvalidateEmailTokens(r.Context(), invalidateEmailTokensParams); err != nil {
+		errorMessage := err.Error()
+
+		respondWithError(w, http.StatusBadRequest, errorMessage)
+		return
+	}
+
+	if err := apiCfg.sendVerificationEmail(r.Context(), userID, dbUser.Email); err != nil {
+		errorMessage := err.Error()
+
+		respondWithError(w, http.StatusInternalServerError, errorMessage)
+		return
+	}
+
+	respondwithJSON(w, http.StatusAccepted, nil)
+}
+
+// handlerRequestPasswordReset always answers 202 so it can't be used to
+// find out whether an account exists.
+func (apiCfg *apiConfig) handlerRequestPasswordReset(w http.ResponseWriter, r *http.Request) {
+	type inputJSON struct {
+		Email string `json:"email"`
+	}
+
+	var inputData inputJSON
+
+	decoder := json.NewDecoder(r.Body)
+
+	defer r.Body.Close()
+
+	if err := decoder.Decode(&inputData); err != nil {
+		errorMessage := err.Error()
+
+		respondWithError(w, http.StatusBadRequest, errorMessage)
+		return
+	}
+
+	dbUser, err := apiCfg.dbQueries.GetUser(r.Context(), inputData.Email)
+	if err != nil {
+		respondwithJSON(w, http.StatusAccepted, nil)
+		return
+	}
+
+	invalidateEmailTokensParams := database.InvalidateEmailTokensParams{
+		UserID:  dbUser.ID,
+		Purpose: auth.PurposeResetPassword,
+	}
+
+	if err := apiCfg.dbQueries.InvalidateEmailTokens(r.Context(), invalidateEmailTokensParams); err != nil {
+		errorMessage := err.Error()
+
+		respondWithError(w, http.StatusBadRequest, errorMessage)
+		return
+	}
+
+	token, err := apiCfg.createEmailToken(r.Context(), dbUser.ID, auth.PurposeResetPassword, dbUser.Email, resetPasswordTTL)
+	if err != nil {
+		errorMessage := err.Error()
+
+		respondWithError(w, http.StatusBadRequest, errorMessage)
+		return
+	}
+
+	msg := mailer.Message{
+		To:      dbUser.Email,
+		Subject: "Reset your Chirpy password",
+		Body: fmt.Sprintf("Someone asked to reset the password for your Chirpy account.\n\nIf it was you, open this link to choose a new password:\n\n%s/app/reset-password?token=%s\n\nThe link expires in 1 hour. If it wasn't you, you can ignore this email.\n",
+			apiCfg.publicBaseURL, token),
+	}
+
+	if err := apiCfg.mailer.Send(r.Context(), msg); err != nil {
+		errorMessage := err.Error()
+
+		respondWithError(w, http.StatusInternalServerError, errorMessage)
+		return
+	}
+
+	respondwithJSON(w, http.StatusAccepted, nil)
+}
+
+// handlerConfirmPasswordReset sets the new password and signs the user out
+// everywhere by revoking their refresh tokens.
+func (apiCfg *apiConfig) handlerConfirmPasswordReset(w http.ResponseWriter, r *http.Request) {
+	type inputJSON struct {
+		Token    string `json:"token"`
+		Password string `json:"password"`
+	}
+
+	var inputData inputJSON
+
+	decoder := json.NewDecoder(r.Body)
+
+	defer r.Body.Close()
+
+	if err := decoder.Decode(&inputData); err != nil {
+		errorMessage := err.Error()
+
+		respondWithError(w, http.StatusBadRequest, errorMessage)
+		return
+	}
+
+	tx, err := apiCfg.db.BeginTx(r.Context(), nil)
+	if err != nil {
+		errorMessage := err.Error()
+
+		respondWithError(w, http.StatusInternalServerError, errorMessage)
+		return
+	}
+	defer tx.Rollback()
+
+	qtx := apiCfg.dbQueries.WithTx(tx)
+
+	// The token is only spent if the commit below happens, so a password
+	// the policy rejects doesn't use up the link.
+	emailToken, err := apiCfg.useEmailToken(r.Context(), qtx, inputData.Token, auth.PurposeResetPassword)
+	if err != nil {
+		errorMessage := err.Error()
+
+		respondWithError(w, http.StatusBadRequest, errorMessage)
+		return
+	}
+
+	dbUser, err := qtx.GetUserFromID(r.Context(), emailToken.UserID)
+	if err != nil || dbUser.Email != emailToken.Email {
+		errorMessage := auth.ErrInvalidSignedToken.Error()
+
+		respondWithError(w, http.StatusBadRequest, errorMessage)
+		return
+	}
+
+	if problems := apiCfg.passwordPolicy.Check(inputData.Password, dbUser.Email); len(problems) > 0 {
+		respondWithFieldErrors(w, http.StatusBadRequest, map[string][]string{"password": problems})
+		return
+	}
+
+	hashedPassword, err := auth.HashPassword(inputData.Password)
+	if err != nil {
+		errorMessage := err.Error()
+
+		respondWithError(w, http.StatusBadRequest, errorMessage)
+		return
+	}
+
+	updateUserPasswordParams := database.UpdateUserPasswordParams{
+		ID:             dbUser.ID,
+		HashedPassword: hashedPassword,
+	}
+
+	if _, err := qtx.UpdateUserPassword(r.Context(), updateUserPasswordParams); err != nil {
+		errorMessage := err.Error()
+
+		respondWithError(w, http.StatusBadRequest, errorMessage)
+		return
+	}
+
+	if err := qtx.RevokeRefreshTokensForUser(r.Context(), dbUser.ID); err != nil {
+		errorMessage := err.Error()
+
+		respondWithError(w, http.StatusBadRequest, errorMessage)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		errorMessage := err.Error()
+
+		respondWithError(w, http.StatusInternalServerError, errorMessage)
+		return
+	}
+
+	respondwithJSON(w, http.StatusNoContent, nil)
+}
@@ -0,0 +1,227 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Cmolloy36/Chirpy/internal/auth"
+	"github.com/Cmolloy36/Chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+// Users can hand out a few invites of their own; admins are not limited.
+const (
+	userInviteMaxUses = 5
+	userInviteLimit   = 10
+)
+
+var errInvalidInviteCode = errors.New("invite code is invalid, expired or used up")
+
+type Invite struct {
+	ID        uuid.UUID  `json:"id"`
+	CreatedAt time.Time  `json:"created_at"`
+	Prefix    string     `json:"prefix"`
+	MaxUses   int32      `json:"max_uses"`
+	Uses      int32      `json:"uses"`
+	ExpiresAt *time.Time `json:"expires_at"`
+	Code      string     `json:"code,omitempty"`
+}
+
+func inviteFromDB(dbInvite database.Invite) Invite {
+	invite := Invite{
+		ID:        dbInvite.ID,
+		CreatedAt: dbInvite.CreatedAt,
+		Prefix:    dbInvite.CodePrefix,
+		MaxUses:   dbInvite.MaxUses,
+		Uses:      dbInvite.Uses,
+	}
+
+	if dbInvite.ExpiresAt.Valid {
+		invite.ExpiresAt = &dbInvite.ExpiresAt.Time
+	}
+
+	return invite
+}
+
+// handlerPostInvite creates an invite code belonging to the current user.
+func (apiCfg *apiConfig) handlerPostInvite(w http.ResponseWriter, r *http.Request) {
+	userID, err := userIDFromContext(r.Context())
+	if err != nil {
+		errorMessage := err.Error()
+
+		respondWithError(w, http.StatusUnauthorized, errorMessage)
+		return
+	}
+
+	createdBy := uuid.NullUUID{UUID: userID, Valid: true}
+
+	active, err := apiCfg.dbQueries.CountActiveInvitesForUser(r.Context(), createdBy)
+	if err != nil {
+		errorMessage := err.Error()
+
+		respondWithError(w, http.StatusBadRequest, errorMessage)
+		return
+	}
+
+	if active >= userInviteLimit {
+		errorMessage := "you already have the maximum number of unused invites"
+
+		respondWithError(w, http.StatusForbidden, errorMessage)
+		return
+	}
+
+	apiCfg.createInvite(w, r, createdBy, userInviteMaxUses)
+}
+
+// handlerPostAdminInvite creates an invite code that belongs to no user.
+func (apiCfg *apiConfig) handlerPostAdminInvite(w http.ResponseWriter, r *http.Request) {
+	apiCfg.createInvite(w, r, uuid.NullUUID{}, 0)
+}
+
+// createInvite reads max_uses and expires_at from the request and responds
+// with the new invite. The code itself is returned only in this response;
+// Chirpy keeps just its hash. A maxUsesCap of 0 means no cap.
+func (apiCfg *apiConfig) createInvite(w http.ResponseWriter, r *http.Request, createdBy uuid.NullUUID, maxUsesCap int32) {
+	type inputJSON struct {
+		MaxUses   int32      `json:"max_uses"`
+		ExpiresAt *time.Time `json:"expires_at"`
+	}
+
+	var inputData inputJSON
+
+	decoder := json.NewDecoder(r.Body)
+
+	defer r.Body.Close()
+
+	if err := decoder.Decode(&inputData); err != nil {
+		errorMessage := err.Error()
+
+		respondWithError(w, http.StatusBadRequest, errorMessage)
+		return
+	}
+
+	fieldErrors := map[string][]string{}
+
+	if inputData.MaxUses == 0 {
+		inputData.MaxUses = 1
+	}
+
+	if inputData.MaxUses < 0 {
+		fieldErrors["max_uses"] = []string{"must be positive"}
+	} else if maxUsesCap > 0 && inputData.MaxUses > maxUsesCap {
+		fieldErrors["max_uses"] = []string{"must be at most " + strconv.Itoa(int(maxUsesCap))}
+	}
+
+	var expiresAt sql.NullTime
+
+	if inputData.ExpiresAt != nil {
+		if !inputData.ExpiresAt.After(time.Now()) {
+			fieldErrors["expires_at"] = []string{"must be in the future"}
+		}
+
+		expiresAt = sql.NullTime{Time: *inputData.ExpiresAt, Valid: true}
+	}
+
+	if len(fieldErrors) > 0 {
+		respondWithFieldErrors(w, http.StatusBadRequest, fieldErrors)
+		return
+	}
+
+	code, err := auth.MakeInviteCode()
+	if err != nil {
+		errorMessage := err.Error()
+
+		respondWithError(w, http.StatusInternalServerError, errorMessage)
+		return
+	}
+
+	createInviteParams := database.CreateInviteParams{
+		CreatedBy:  createdBy,
+		CodePrefix: auth.InviteCodeDisplayPrefix(code),
+		CodeHash:   auth.HashInviteCode(code),
+		MaxUses:    inputData.MaxUses,
+		ExpiresAt:  expiresAt,
+	}
+
+	dbInvite, err := apiCfg.dbQueries.CreateInvite(r.Context(), createInviteParams)
+	if err != nil {
+		errorMessage := err.Error()
+
+		respondWithError(w, http.StatusBadRequest, errorMessage)
+		return
+	}
+
+	invite := inviteFromDB(dbInvite)
+	invite.Code = code
+
+	respondwithJSON(w, http.StatusCreated, invite)
+}
+
+func (apiCfg *apiConfig) handlerGetInvites(w http.ResponseWriter, r *http.Request) {
+	userID, err := userIDFromContext(r.Context())
+	if err != nil {
+		errorMessage := err.Error()
+
+		respondWithError(w, http.StatusUnauthorized, errorMessage)
+		return
+	}
+
+	dbInvites, err := apiCfg.dbQueries.GetInvitesForUser(r.Context(), uuid.NullUUID{UUID: userID, Valid: true})
+	if err != nil {
+		errorMessage := err.Error()
+
+		respondWithError(w, http.StatusBadRequest, errorMessage)
+		return
+	}
+
+	retSlc := make([]Invite, len(dbInvites))
+	for i, dbInvite := range dbInvites {
+		retSlc[i] = inviteFromDB(dbInvite)
+	}
+
+	respondwithJSON(w, http.StatusOK, retSlc)
+}
+
+func (apiCfg *apiConfig) handlerDeleteInvite(w http.ResponseWriter, r *http.Request) {
+	inviteID, err := uuid.Parse(r.PathValue("inviteID"))
+	if err != nil {
+		errorMessage := "Error parsing invite ID"
+
+		respondWithError(w, http.StatusBadRequest, errorMessage)
+		return
+	}
+
+	userID, err := userIDFromContext(r.Context())
+	if err != nil {
+		errorMessage := err.Error()
+
+		respondWithError(w, http.StatusUnauthorized, errorMessage)
+		return
+	}
+
+	revokeInviteParams := database.RevokeInviteParams{
+		ID:        inviteID,
+		CreatedBy: uuid.NullUUID{UUID: userID, Valid: true},
+	}
+
+	rows, err := apiCfg.dbQueries.RevokeInvite(r.Context(), revokeInviteParams)
+	if err != nil {
+		errorMessage := err.Error()
+
+		respondWithError(w, http.StatusBadRequest, errorMessage)
+		return
+	}
+
+	if rows == 0 {
+		errorMessage := "invite not found"
+
+		respondWithError(w, http.StatusNotFound, errorMessage)
+		return
+	}
+
+	respondwithJSON(w, http.StatusNoContent, nil)
+}
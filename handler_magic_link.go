@@ -0,0 +1,210 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/Cmolloy36/Chirpy/internal/auth"
+	"github.com/Cmolloy36/Chirpy/internal/database"
+	"github.com/Cmolloy36/Chirpy/internal/mailer"
+)
+
+const magicLinkNonceCookie = "chirpy_magic_nonce"
+
+type MagicLinkRequest struct {
+	Nonce string `json:"nonce"`
+}
+
+// handlerRequestMagicLink emails a one-time login link. The response is the
+// same whether or not the account exists; it carries the nonce (also set as
+// a cookie) that has to be presented with the link to redeem it.
+func (apiCfg *apiConfig) handlerRequestMagicLink(w http.ResponseWriter, r *http.Request) {
+	type inputJSON struct {
+		Email string `json:"email"`
+	}
+
+	var inputData inputJSON
+
+	decoder := json.NewDecoder(r.Body)
+
+	defer r.Body.Close()
+
+	if err := decoder.Decode(&inputData); err != nil {
+		errorMessage := err.Error()
+
+		respondWithError(w, http.StatusBadRequest, errorMessage)
+		return
+	}
+
+	throttleKey := magicLinkThrottleKey(inputData.Email)
+
+	blockedUntil, err := apiCfg.loginBlockedUntil(r.Context(), throttleKey)
+	if err != nil {
+		errorMessage := err.Error()
+
+		respondWithError(w, http.StatusInternalServerError, errorMessage)
+		return
+	}
+
+	if !blockedUntil.IsZero() {
+		respondThrottled(w, blockedUntil)
+		return
+	}
+
+	// Every request counts towards the limit, not just failed ones.
+	if _, err := apiCfg.recordLoginFailure(r.Context(), throttleKey); err != nil {
+		log.Printf("Error recording magic link request: %s", err)
+	}
+
+	nonce, err := auth.MakeMagicLinkNonce()
+	if err != nil {
+		errorMessage := err.Error()
+
+		respondWithError(w, http.StatusInternalServerError, errorMessage)
+		return
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     magicLinkNonceCookie,
+		Value:    nonce,
+		Path:     "/api/login/magic",
+		MaxAge:   int(auth.MagicLinkTTL.Seconds()),
+		HttpOnly: true,
+		Secure:   apiCfg.secureCookies(r),
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	dbUser, err := apiCfg.dbQueries.GetUser(r.Context(), inputData.Email)
+	if err != nil {
+		respondwithJSON(w, http.StatusAccepted, MagicLinkRequest{Nonce: nonce})
+		return
+	}
+
+	if err := apiCfg.dbQueries.InvalidateMagicLinks(r.Context(), dbUser.ID); err != nil {
+		errorMessage := err.Error()
+
+		respondWithError(w, http.StatusBadRequest, errorMessage)
+		return
+	}
+
+	expiresAt := time.Now().Add(auth.MagicLinkTTL)
+
+	createMagicLinkParams := database.CreateMagicLinkParams{
+		UserID:    dbUser.ID,
+		Email:     dbUser.Email,
+		NonceHash: auth.HashMagicLinkNonce(nonce),
+		ExpiresAt: expiresAt,
+	}
+
+	magicLink, err := apiCfg.dbQueries.CreateMagicLink(r.Context(), createMagicLinkParams)
+	if err != nil {
+		errorMessage := err.Error()
+
+		respondWithError(w, http.StatusBadRequest, errorMessage)
+		return
+	}
+
+	token := auth.MakeSignedToken(magicLink.ID, auth.PurposeMagicLogin, expiresAt, apiCfg.secretString)
+
+	msg := mailer.Message{
+		To:      dbUser.Email,
+		Subject: "Your Chirpy login link",
+		Body: fmt.Sprintf("Open this link to log in to Chirpy:\n\n%s/app/magic-login?token=%s\n\nIt works once, only in the browser where you asked for it, and expires in 15 minutes. If you didn't ask for it, you can ignore this email.\n",
+			apiCfg.publicBaseURL, token),
+	}
+
+	if err := apiCfg.mailer.Send(r.Context(), msg); err != nil {
+		errorMessage := err.Error()
+
+		respondWithError(w, http.StatusInternalServerError, errorMessage)
+		return
+	}
+
+	respondwithJSON(w, http.StatusAccepted, MagicLinkRequest{Nonce: nonce})
+}
+
+// handlerRedeemMagicLink exchanges a login link for the same payload as
+// handlerLogin. The nonce comes from the body or, failing that, the cookie
+// set when the link was requested.
+func (apiCfg *apiConfig) handlerRedeemMagicLink(w http.ResponseWriter, r *http.Request) {
+	type inputJSON struct {
+		Token            string `json:"token"`
+		Nonce            string `json:"nonce"`
+		ExpiresInSeconds int    `json:"expires_in_seconds"`
+		RememberMe       bool   `json:"remember_me"`
+		SessionCookies   bool   `json:"session_cookies"`
+	}
+
+	var inputData inputJSON
+
+	decoder := json.NewDecoder(r.Body)
+
+	defer r.Body.Close()
+
+	if err := decoder.Decode(&inputData); err != nil {
+		errorMessage := err.Error()
+
+		respondWithError(w, http.StatusBadRequest, errorMessage)
+		return
+	}
+
+	if inputData.Nonce == "" {
+		if cookie, err := r.Cookie(magicLinkNonceCookie); err == nil {
+			inputData.Nonce = cookie.Value
+		}
+	}
+
+	magicLinkID, err := auth.ParseSignedToken(inputData.Token, auth.PurposeMagicLogin, apiCfg.secretString)
+	if err != nil {
+		errorMessage := err.Error()
+
+		respondWithError(w, http.StatusUnauthorized, errorMessage)
+		return
+	}
+
+	useMagicLinkParams := database.UseMagicLinkParams{
+		ID:        magicLinkID,
+		NonceHash: auth.HashMagicLinkNonce(inputData.Nonce),
+	}
+
+	magicLink, err := apiCfg.dbQueries.UseMagicLink(r.Context(), useMagicLinkParams)
+	if err != nil {
+		errorMessage := auth.ErrInvalidSignedToken.Error()
+
+		respondWithError(w, http.StatusUnauthorized, errorMessage)
+		return
+	}
+
+	dbUser, err := apiCfg.dbQueries.GetUserFromID(r.Context(), magicLink.UserID)
+	if err != nil || dbUser.Email != magicLink.Email {
+		errorMessage := auth.ErrInvalidSignedToken.Error()
+
+		respondWithError(w, http.StatusUnauthorized, errorMessage)
+		return
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:   magicLinkNonceCookie,
+		Path:   "/api/login/magic",
+		MaxAge: -1,
+	})
+
+	// Following the link proves the user can read mail at this address.
+	if !dbUser.EmailVerifiedAt.Valid {
+		markEmailVerifiedParams := database.MarkEmailVerifiedParams{
+			ID:    dbUser.ID,
+			Email: dbUser.Email,
+		}
+
+		if verifiedUser, err := apiCfg.dbQueries.MarkEmailVerified(r.Context(), markEmailVerifiedParams); err != nil {
+			log.Printf("Error marking email verified: %s", err)
+		} else {
+			dbUser = verifiedUser
+		}
+	}
+
+	apiCfg.respondWithLogin(w, r, dbUser, loginMethodMagicLink, inputData.ExpiresInSeconds, inputData.RememberMe, inputData.SessionCookies)
+}
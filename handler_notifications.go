@@ -0,0 +1,75 @@
+package main
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/Cmolloy36/Chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+type Notification struct {
+	ID        uuid.UUID  `json:"id"`
+	CreatedAt time.Time  `json:"created_at"`
+	Kind      string     `json:"kind"`
+	Message   string     `json:"message"`
+	ReadAt    *time.Time `json:"read_at"`
+}
+
+func (apiCfg *apiConfig) handlerGetNotifications(w http.ResponseWriter, r *http.Request) {
+	userID, err := userIDFromContext(r.Context())
+	if err != nil {
+		errorMessage := err.Error()
+
+		respondWithError(w, http.StatusUnauthorized, errorMessage)
+		return
+	}
+
+	getNotificationsForUserParams := database.GetNotificationsForUserParams{
+		UserID: userID,
+		Limit:  50,
+	}
+
+	dbNotifications, err := apiCfg.dbQueries.GetNotificationsForUser(r.Context(), getNotificationsForUserParams)
+	if err != nil {
+		errorMessage := err.Error()
+
+		respondWithError(w, http.StatusBadRequest, errorMessage)
+		return
+	}
+
+	retSlc := make([]Notification, len(dbNotifications))
+	for i, dbNotification := range dbNotifications {
+		retSlc[i] = Notification{
+			ID:        dbNotification.ID,
+			CreatedAt: dbNotification.CreatedAt,
+			Kind:      dbNotification.Kind,
+			Message:   dbNotification.Message,
+		}
+
+		if dbNotification.ReadAt.Valid {
+			retSlc[i].ReadAt = &dbNotification.ReadAt.Time
+		}
+	}
+
+	respondwithJSON(w, http.StatusOK, retSlc)
+}
+
+func (apiCfg *apiConfig) handlerReadNotifications(w http.ResponseWriter, r *http.Request) {
+	userID, err := userIDFromContext(r.Context())
+	if err != nil {
+		errorMessage := err.Error()
+
+		respondWithError(w, http.StatusUnauthorized, errorMessage)
+		return
+	}
+
+	if err := apiCfg.dbQueries.MarkNotificationsRead(r.Context(), userID); err != nil {
+		errorMessage := err.Error()
+
+		respondWithError(w, http.StatusBadRequest, errorMessage)
+		return
+	}
+
+	respondwithJSON(w, http.StatusNoContent, nil)
+}
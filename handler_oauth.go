@@ -0,0 +1,608 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/Cmolloy36/Chirpy/internal/auth"
+	"github.com/Cmolloy36/Chirpy/internal/database"
+	"github.com/Cmolloy36/Chirpy/internal/oauth"
+	"github.com/google/uuid"
+)
+
+const oauthConsentPage = "/app/oauth/consent.html"
+
+type OAuthTokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int    `json:"expires_in"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	Scope        string `json:"scope"`
+}
+
+type OAuthIntrospection struct {
+	Active    bool     `json:"active"`
+	TokenType string   `json:"token_type,omitempty"`
+	ClientID  string   `json:"client_id,omitempty"`
+	Subject   string   `json:"sub,omitempty"`
+	Audience  []string `json:"aud,omitempty"`
+	Scope     string   `json:"scope,omitempty"`
+	IssuedAt  int64    `json:"iat,omitempty"`
+	ExpiresAt int64    `json:"exp,omitempty"`
+}
+
+type OAuthAuthorization struct {
+	ClientID       uuid.UUID `json:"client_id"`
+	ClientName     string    `json:"client_name"`
+	RedirectURI    string    `json:"redirect_uri"`
+	Scopes         []string  `json:"scopes"`
+	AlreadyGranted bool      `json:"already_granted"`
+}
+
+type OAuthRedirect struct {
+	RedirectTo string `json:"redirect_to"`
+}
+
+// authorizationRequest is a validated /oauth/authorize request.
+type authorizationRequest struct {
+	client        database.OauthClient
+	redirectURI   string
+	state         string
+	scopes        []string
+	codeChallenge string
+}
+
+// parseAuthorizationRequest validates the parameters of an authorization
+// request. A bad client_id or redirect_uri is returned as a plain error and
+// must be shown to the user, never redirected. Anything else is an
+// *oauth.Error to be sent back to the (now trusted) redirect URI.
+func (apiCfg *apiConfig) parseAuthorizationRequest(ctx context.Context, query url.Values) (authorizationRequest, error) {
+	clientID, err := uuid.Parse(query.Get("client_id"))
+	if err != nil {
+		return authorizationRequest{}, errors.New("unknown client_id")
+	}
+
+	client, err := apiCfg.dbQueries.GetOAuthClient(ctx, clientID)
+	if err != nil {
+		return authorizationRequest{}, errors.New("unknown client_id")
+	}
+
+	redirectURI := query.Get("redirect_uri")
+	if !slices.Contains(strings.Fields(client.RedirectUris), redirectURI) {
+		return authorizationRequest{}, errors.New("redirect_uri is not registered for this client")
+	}
+
+	authRequest := authorizationRequest{
+		client:      client,
+		redirectURI: redirectURI,
+		state:       query.Get("state"),
+	}
+
+	if responseType := query.Get("response_type"); responseType != oauth.ResponseTypeCode {
+		return authRequest, oauth.UnsupportedResponseType(responseType)
+	}
+
+	if oauthErr := oauth.ValidateCodeChallenge(query.Get("code_challenge"), query.Get("code_challenge_method")); oauthErr != nil {
+		return authRequest, oauthErr
+	}
+
+	scopes, oauthErr := oauth.ResolveScope(query.Get("scope"), strings.Fields(client.Scope))
+	if oauthErr != nil {
+		return authRequest, oauthErr
+	}
+
+	authRequest.scopes = scopes
+	authRequest.codeChallenge = query.Get("code_challenge")
+
+	return authRequest, nil
+}
+
+// limitToClaims drops requested scopes that the approving user's own token
+// doesn't hold, so consenting can never give an app more than the user
+// could do themselves. It fails if no requested scope is left.
+func (authRequest *authorizationRequest) limitToClaims(claims auth.Claims) *oauth.Error {
+	authRequest.scopes = slices.DeleteFunc(authRequest.scopes, func(scope string) bool {
+		return !claims.HasScope(scope)
+	})
+
+	if len(authRequest.scopes) == 0 {
+		return oauth.InvalidScope("you can't grant any of the requested scopes")
+	}
+
+	return nil
+}
+
+func (authRequest authorizationRequest) errorRedirect(oauthErr *oauth.Error) string {
+	params := url.Values{"error": {oauthErr.Code}}
+	if oauthErr.Description != "" {
+		params.Set("error_description", oauthErr.Description)
+	}
+	if authRequest.state != "" {
+		params.Set("state", authRequest.state)
+	}
+
+	return oauth.RedirectURL(authRequest.redirectURI, params)
+}
+
+// handlerOAuthAuthorize is where third-party apps send the browser. Once
+// the request checks out it hands over to the consent page, which signs the
+// user in if needed and asks them to approve.
+func (apiCfg *apiConfig) handlerOAuthAuthorize(w http.ResponseWriter, r *http.Request) {
+	authRequest, err := apiCfg.parseAuthorizationRequest(r.Context(), r.URL.Query())
+
+	var oauthErr *oauth.Error
+	if errors.As(err, &oauthErr) {
+		http.Redirect(w, r, authRequest.errorRedirect(oauthErr), http.StatusFound)
+		return
+	} else if err != nil {
+		errorMessage := err.Error()
+
+		respondWithError(w, http.StatusBadRequest, errorMessage)
+		return
+	}
+
+	http.Redirect(w, r, oauthConsentPage+"?"+r.URL.RawQuery, http.StatusFound)
+}
+
+// handlerGetOAuthAuthorization describes a pending authorization request
+// for the consent page: which app is asking and for what.
+func (apiCfg *apiConfig) handlerGetOAuthAuthorization(w http.ResponseWriter, r *http.Request) {
+	userID, err := userIDFromContext(r.Context())
+	if err != nil {
+		errorMessage := err.Error()
+
+		respondWithError(w, http.StatusUnauthorized, errorMessage)
+		return
+	}
+
+	authRequest, err := apiCfg.parseAuthorizationRequest(r.Context(), r.URL.Query())
+	if err != nil {
+		errorMessage := err.Error()
+
+		respondWithError(w, http.StatusBadRequest, errorMessage)
+		return
+	}
+
+	claims, _ := claimsFromContext(r.Context())
+	if oauthErr := authRequest.limitToClaims(claims); oauthErr != nil {
+		errorMessage := oauthErr.Error()
+
+		respondWithError(w, http.StatusForbidden, errorMessage)
+		return
+	}
+
+	alreadyGranted := false
+
+	getOAuthConsentParams := database.GetOAuthConsentParams{
+		UserID:   userID,
+		ClientID: authRequest.client.ID,
+	}
+
+	consent, err := apiCfg.dbQueries.GetOAuthConsent(r.Context(), getOAuthConsentParams)
+	if err == nil {
+		granted := strings.Fields(consent.Scope)
+		alreadyGranted = !slices.ContainsFunc(authRequest.scopes, func(scope string) bool {
+			return !slices.Contains(granted, scope)
+		})
+	} else if !errors.Is(err, sql.ErrNoRows) {
+		errorMessage := err.Error()
+
+		respondWithError(w, http.StatusBadRequest, errorMessage)
+		return
+	}
+
+	respondwithJSON(w, http.StatusOK, OAuthAuthorization{
+		ClientID:       authRequest.client.ID,
+		ClientName:     authRequest.client.Name,
+		RedirectURI:    authRequest.redirectURI,
+		Scopes:         authRequest.scopes,
+		AlreadyGranted: alreadyGranted,
+	})
+}
+
+// handlerPostOAuthAuthorization records the user's decision on the consent
+// page and returns where to send the browser: back to the app with either
+// an authorization code or access_denied.
+func (apiCfg *apiConfig) handlerPostOAuthAuthorization(w http.ResponseWriter, r *http.Request) {
+	type inputJSON struct {
+		ClientID            string `json:"client_id"`
+		RedirectURI         string `json:"redirect_uri"`
+		ResponseType        string `json:"response_type"`
+		Scope               string `json:"scope"`
+		State               string `json:"state"`
+		CodeChallenge       string `json:"code_challenge"`
+		CodeChallengeMethod string `json:"code_challenge_method"`
+		Approve             bool   `json:"approve"`
+	}
+
+	var inputData inputJSON
+
+	decoder := json.NewDecoder(r.Body)
+
+	defer r.Body.Close()
+
+	if err := decoder.Decode(&inputData); err != nil {
+		errorMessage := err.Error()
+
+		respondWithError(w, http.StatusBadRequest, errorMessage)
+		return
+	}
+
+	userID, err := userIDFromContext(r.Context())
+	if err != nil {
+		errorMessage := err.Error()
+
+		respondWithError(w, http.StatusUnauthorized, errorMessage)
+		return
+	}
+
+	query := url.Values{
+		"client_id":             {inputData.ClientID},
+		"redirect_uri":          {inputData.RedirectURI},
+		"response_type":         {inputData.ResponseType},
+		"scope":                 {inputData.Scope},
+		"state":                 {inputData.State},
+		"code_challenge":        {inputData.CodeChallenge},
+		"code_challenge_method": {inputData.CodeChallengeMethod},
+	}
+
+	authRequest, err := apiCfg.parseAuthorizationRequest(r.Context(), query)
+
+	var oauthErr *oauth.Error
+	if errors.As(err, &oauthErr) {
+		respondwithJSON(w, http.StatusOK, OAuthRedirect{RedirectTo: authRequest.errorRedirect(oauthErr)})
+		return
+	} else if err != nil {
+		errorMessage := err.Error()
+
+		respondWithError(w, http.StatusBadRequest, errorMessage)
+		return
+	}
+
+	claims, _ := claimsFromContext(r.Context())
+	if oauthErr := authRequest.limitToClaims(claims); oauthErr != nil {
+		respondwithJSON(w, http.StatusOK, OAuthRedirect{RedirectTo: authRequest.errorRedirect(oauthErr)})
+		return
+	}
+
+	if !inputData.Approve {
+		redirectTo := authRequest.errorRedirect(oauth.AccessDenied("the user denied the request"))
+
+		respondwithJSON(w, http.StatusOK, OAuthRedirect{RedirectTo: redirectTo})
+		return
+	}
+
+	if err := apiCfg.grantOAuthConsent(r.Context(), userID, authRequest.client.ID, authRequest.scopes); err != nil {
+		errorMessage := err.Error()
+
+		respondWithError(w, http.StatusBadRequest, errorMessage)
+		return
+	}
+
+	code, err := auth.MakeRefreshToken()
+	if err != nil {
+		errorMessage := err.Error()
+
+		respondWithError(w, http.StatusInternalServerError, errorMessage)
+		return
+	}
+
+	createOAuthCodeParams := database.CreateOAuthCodeParams{
+		CodeHash:      oauth.HashCode(code),
+		ClientID:      authRequest.client.ID,
+		UserID:        userID,
+		RedirectUri:   authRequest.redirectURI,
+		Scope:         strings.Join(authRequest.scopes, " "),
+		CodeChallenge: authRequest.codeChallenge,
+		ExpiresAt:     time.Now().Add(oauth.AuthorizationCodeTTL),
+	}
+
+	if err := apiCfg.dbQueries.CreateOAuthCode(r.Context(), createOAuthCodeParams); err != nil {
+		errorMessage := err.Error()
+
+		respondWithError(w, http.StatusBadRequest, errorMessage)
+		return
+	}
+
+	params := url.Values{"code": {code}}
+	if authRequest.state != "" {
+		params.Set("state", authRequest.state)
+	}
+
+	respondwithJSON(w, http.StatusOK, OAuthRedirect{RedirectTo: oauth.RedirectURL(authRequest.redirectURI, params)})
+}
+
+// grantOAuthConsent adds scopes to whatever the user already granted clientID.
+func (apiCfg *apiConfig) grantOAuthConsent(ctx context.Context, userID, clientID uuid.UUID, scopes []string) error {
+	getOAuthConsentParams := database.GetOAuthConsentParams{
+		UserID:   userID,
+		ClientID: clientID,
+	}
+
+	granted := []string{}
+
+	consent, err := apiCfg.dbQueries.GetOAuthConsent(ctx, getOAuthConsentParams)
+	if err == nil {
+		granted = strings.Fields(consent.Scope)
+	} else if !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+
+	for _, scope := range scopes {
+		if !slices.Contains(granted, scope) {
+			granted = append(granted, scope)
+		}
+	}
+
+	upsertOAuthConsentParams := database.UpsertOAuthConsentParams{
+		UserID:   userID,
+		ClientID: clientID,
+		Scope:    strings.Join(granted, " "),
+	}
+
+	_, err = apiCfg.dbQueries.UpsertOAuthConsent(ctx, upsertOAuthConsentParams)
+	return err
+}
+
+// authenticateOAuthClient identifies the client calling a form-encoded
+// OAuth endpoint. Confidential clients must present their secret; public
+// clients identify themselves by client_id alone.
+func (apiCfg *apiConfig) authenticateOAuthClient(r *http.Request) (database.OauthClient, *oauth.Error) {
+	clientIDString, clientSecret, ok := oauth.ClientCredentials(r)
+	if !ok {
+		return database.OauthClient{}, oauth.InvalidClient("client authentication is required")
+	}
+
+	clientID, err := uuid.Parse(clientIDString)
+	if err != nil {
+		return database.OauthClient{}, oauth.InvalidClient("unknown client")
+	}
+
+	client, err := apiCfg.dbQueries.GetOAuthClient(r.Context(), clientID)
+	if err != nil {
+		return database.OauthClient{}, oauth.InvalidClient("unknown client")
+	}
+
+	if client.SecretHash.Valid {
+		if err := auth.CheckPasswordHash(client.SecretHash.String, clientSecret); err != nil {
+			return database.OauthClient{}, oauth.InvalidClient("client authentication failed")
+		}
+	} else if clientSecret != "" {
+		return database.OauthClient{}, oauth.InvalidClient("public clients do not have a secret")
+	}
+
+	return client, nil
+}
+
+// handlerOAuthToken is the RFC 6749 token endpoint. Requests are
+// form-encoded, as the spec requires.
+func (apiCfg *apiConfig) handlerOAuthToken(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		respondWithOAuthError(w, oauth.InvalidRequest(err.Error()))
+		return
+	}
+
+	client, oauthErr := apiCfg.authenticateOAuthClient(r)
+	if oauthErr != nil {
+		respondWithOAuthError(w, oauthErr)
+		return
+	}
+
+	var tokenResponse OAuthTokenResponse
+
+	switch grantType := r.PostForm.Get("grant_type"); grantType {
+	case oauth.GrantTypeAuthorizationCode:
+		tokenResponse, oauthErr = apiCfg.exchangeAuthorizationCode(r, client)
+	case oauth.GrantTypeRefreshToken:
+		tokenResponse, oauthErr = apiCfg.exchangeOAuthRefreshToken(r, client)
+	case oauth.GrantTypeClientCredentials:
+		tokenResponse, oauthErr = apiCfg.exchangeClientCredentials(r, client)
+	case "":
+		oauthErr = oauth.InvalidRequest("grant_type is required")
+	default:
+		oauthErr = oauth.UnsupportedGrantType(grantType)
+	}
+
+	if oauthErr != nil {
+		respondWithOAuthError(w, oauthErr)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	respondwithJSON(w, http.StatusOK, tokenResponse)
+}
+
+func (apiCfg *apiConfig) exchangeAuthorizationCode(r *http.Request, client database.OauthClient) (OAuthTokenResponse, *oauth.Error) {
+	code := r.PostForm.Get("code")
+	if code == "" {
+		return OAuthTokenResponse{}, oauth.InvalidRequest("code is required")
+	}
+
+	authCode, err := apiCfg.dbQueries.UseOAuthCode(r.Context(), oauth.HashCode(code))
+	if err != nil || authCode.ClientID != client.ID {
+		return OAuthTokenResponse{}, oauth.InvalidGrant("authorization code is invalid, expired or already used")
+	}
+
+	if r.PostForm.Get("redirect_uri") != authCode.RedirectUri {
+		return OAuthTokenResponse{}, oauth.InvalidGrant("redirect_uri does not match the authorization request")
+	}
+
+	if oauthErr := oauth.VerifyPKCE(r.PostForm.Get("code_verifier"), authCode.CodeChallenge); oauthErr != nil {
+		return OAuthTokenResponse{}, oauthErr
+	}
+
+	return apiCfg.issueOAuthTokens(r.Context(), client, authCode.UserID, strings.Fields(authCode.Scope), true)
+}
+
+// exchangeOAuthRefreshToken issues a new access token for a refresh token
+// the client holds, optionally narrowed to fewer scopes.
+func (apiCfg *apiConfig) exchangeOAuthRefreshToken(r *http.Request, client database.OauthClient) (OAuthTokenResponse, *oauth.Error) {
+	refreshToken, err := apiCfg.dbQueries.GetRefreshToken(r.Context(), r.PostForm.Get("refresh_token"))
+	if err != nil || !refreshToken.ClientID.Valid || refreshToken.ClientID.UUID != client.ID ||
+		refreshToken.RevokedAt.Valid || time.Now().After(refreshToken.ExpiresAt) {
+		return OAuthTokenResponse{}, oauth.InvalidGrant("refresh token is invalid, expired or revoked")
+	}
+
+	scopes, oauthErr := oauth.ResolveScope(r.PostForm.Get("scope"), strings.Fields(refreshToken.Scope.String))
+	if oauthErr != nil {
+		return OAuthTokenResponse{}, oauthErr
+	}
+
+	return apiCfg.issueOAuthTokens(r.Context(), client, refreshToken.UserID, scopes, false)
+}
+
+// exchangeClientCredentials lets a bot act as the account that registered
+// it, limited to the client's scopes. No refresh token is issued; the bot
+// can always ask again.
+func (apiCfg *apiConfig) exchangeClientCredentials(r *http.Request, client database.OauthClient) (OAuthTokenResponse, *oauth.Error) {
+	if !client.SecretHash.Valid {
+		return OAuthTokenResponse{}, oauth.UnauthorizedClient("public clients cannot use client_credentials")
+	}
+
+	scopes, oauthErr := oauth.ResolveScope(r.PostForm.Get("scope"), strings.Fields(client.Scope))
+	if oauthErr != nil {
+		return OAuthTokenResponse{}, oauthErr
+	}
+
+	return apiCfg.issueOAuthTokens(r.Context(), client, client.OwnerID, scopes, false)
+}
+
+func (apiCfg *apiConfig) issueOAuthTokens(ctx context.Context, client database.OauthClient, userID uuid.UUID, scopes []string, withRefreshToken bool) (OAuthTokenResponse, *oauth.Error) {
+	accessTTL := apiCfg.tokenPolicy.AccessTTL
+
+	accessToken, err := auth.MakeJWTForClient(userID, client.ID.String(), apiCfg.secretString, apiCfg.tokenAudience, scopes, accessTTL)
+	if err != nil {
+		return OAuthTokenResponse{}, &oauth.Error{Code: "server_error", Description: err.Error()}
+	}
+
+	tokenResponse := OAuthTokenResponse{
+		AccessToken: accessToken,
+		TokenType:   "Bearer",
+		ExpiresIn:   int(accessTTL.Seconds()),
+		Scope:       strings.Join(scopes, " "),
+	}
+
+	if !withRefreshToken {
+		return tokenResponse, nil
+	}
+
+	refreshTokenString, err := auth.MakeRefreshToken()
+	if err != nil {
+		return OAuthTokenResponse{}, &oauth.Error{Code: "server_error", Description: err.Error()}
+	}
+
+	createOAuthRefreshTokenParams := database.CreateOAuthRefreshTokenParams{
+		Token:     refreshTokenString,
+		UserID:    userID,
+		ExpiresAt: time.Now().Add(apiCfg.tokenPolicy.RefreshTTL),
+		ClientID:  uuid.NullUUID{UUID: client.ID, Valid: true},
+		Scope:     sql.NullString{String: tokenResponse.Scope, Valid: true},
+	}
+
+	if _, err := apiCfg.dbQueries.CreateOAuthRefreshToken(ctx, createOAuthRefreshTokenParams); err != nil {
+		return OAuthTokenResponse{}, &oauth.Error{Code: "server_error", Description: err.Error()}
+	}
+
+	tokenResponse.RefreshToken = refreshTokenString
+
+	return tokenResponse, nil
+}
+
+// handlerOAuthRevoke implements RFC 7009. Refresh tokens issued to the
+// calling client are revoked; access tokens are short-lived JWTs and simply
+// expire. Unknown tokens still get 200, as the RFC requires.
+func (apiCfg *apiConfig) handlerOAuthRevoke(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		respondWithOAuthError(w, oauth.InvalidRequest(err.Error()))
+		return
+	}
+
+	client, oauthErr := apiCfg.authenticateOAuthClient(r)
+	if oauthErr != nil {
+		respondWithOAuthError(w, oauthErr)
+		return
+	}
+
+	token := r.PostForm.Get("token")
+	if token == "" {
+		respondWithOAuthError(w, oauth.InvalidRequest("token is required"))
+		return
+	}
+
+	refreshToken, err := apiCfg.dbQueries.GetRefreshToken(r.Context(), token)
+	if err == nil && refreshToken.ClientID.Valid && refreshToken.ClientID.UUID == client.ID && !refreshToken.RevokedAt.Valid {
+		setTokenRevokedAtParams := database.SetTokenRevokedAtParams{
+			Token:     token,
+			RevokedAt: sql.NullTime{Time: time.Now(), Valid: true},
+		}
+
+		if _, err := apiCfg.dbQueries.SetTokenRevokedAt(r.Context(), setTokenRevokedAtParams); err != nil {
+			respondWithOAuthError(w, &oauth.Error{Code: "server_error", Description: err.Error()})
+			return
+		}
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// handlerOAuthIntrospect implements RFC 7662 for confidential clients.
+// A client only learns about tokens issued to itself; any other token
+// reports {"active": false}.
+func (apiCfg *apiConfig) handlerOAuthIntrospect(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		respondWithOAuthError(w, oauth.InvalidRequest(err.Error()))
+		return
+	}
+
+	client, oauthErr := apiCfg.authenticateOAuthClient(r)
+	if oauthErr != nil {
+		respondWithOAuthError(w, oauthErr)
+		return
+	}
+
+	if !client.SecretHash.Valid {
+		respondWithOAuthError(w, oauth.UnauthorizedClient("only confidential clients may introspect tokens"))
+		return
+	}
+
+	token := r.PostForm.Get("token")
+	clientID := client.ID.String()
+
+	if claims, err := auth.ValidateJWT(token, apiCfg.secretString, apiCfg.tokenAudience); err == nil && claims.ClientID == clientID {
+		respondwithJSON(w, http.StatusOK, OAuthIntrospection{
+			Active:    true,
+			TokenType: "access_token",
+			ClientID:  claims.ClientID,
+			Subject:   claims.Subject,
+			Audience:  claims.Audience,
+			Scope:     claims.Scope,
+			IssuedAt:  claims.IssuedAt.Unix(),
+			ExpiresAt: claims.ExpiresAt.Unix(),
+		})
+		return
+	}
+
+	refreshToken, err := apiCfg.dbQueries.GetRefreshToken(r.Context(), token)
+	if err != nil || !refreshToken.ClientID.Valid || refreshToken.ClientID.UUID != client.ID ||
+		refreshToken.RevokedAt.Valid || time.Now().After(refreshToken.ExpiresAt) {
+		respondwithJSON(w, http.StatusOK, OAuthIntrospection{Active: false})
+		return
+	}
+
+	respondwithJSON(w, http.StatusOK, OAuthIntrospection{
+		Active:    true,
+		TokenType: "refresh_token",
+		ClientID:  clientID,
+		Subject:   refreshToken.UserID.String(),
+		Scope:     refreshToken.Scope.String,
+		IssuedAt:  refreshToken.CreatedAt.Unix(),
+		ExpiresAt: refreshToken.ExpiresAt.Unix(),
+	})
+}
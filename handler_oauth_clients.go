@@ -0,0 +1,313 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Cmolloy36/Chirpy/internal/auth"
+	"github.com/Cmolloy36/Chirpy/internal/database"
+	"github.com/Cmolloy36/Chirpy/internal/oauth"
+	"github.com/google/uuid"
+)
+
+type OAuthClient struct {
+	ID           uuid.UUID `json:"client_id"`
+	CreatedAt    time.Time `json:"created_at"`
+	Name         string    `json:"name"`
+	RedirectURIs []string  `json:"redirect_uris"`
+	Scopes       []string  `json:"scopes"`
+	Confidential bool      `json:"confidential"`
+	ClientSecret string    `json:"client_secret,omitempty"`
+}
+
+func oauthClientFromDB(dbClient database.OauthClient) OAuthClient {
+	return OAuthClient{
+		ID:           dbClient.ID,
+		CreatedAt:    dbClient.CreatedAt,
+		Name:         dbClient.Name,
+		RedirectURIs: strings.Fields(dbClient.RedirectUris),
+		Scopes:       strings.Fields(dbClient.Scope),
+		Confidential: dbClient.SecretHash.Valid,
+	}
+}
+
+type OAuthConsent struct {
+	ClientID   uuid.UUID `json:"client_id"`
+	ClientName string    `json:"client_name"`
+	Scopes     []string  `json:"scopes"`
+	GrantedAt  time.Time `json:"granted_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+// handlerPostOAuthClient registers an app owned by the logged-in user.
+// Confidential clients get a secret, returned only in this response; public
+// clients (mobile and single-page apps) rely on PKCE alone.
+func (apiCfg *apiConfig) handlerPostOAuthClient(w http.ResponseWriter, r *http.Request) {
+	type inputJSON struct {
+		Name         string   `json:"name"`
+		RedirectURIs []string `json:"redirect_uris"`
+		Scopes       []string `json:"scopes"`
+		Confidential bool     `json:"confidential"`
+	}
+
+	var inputData inputJSON
+
+	decoder := json.NewDecoder(r.Body)
+
+	defer r.Body.Close()
+
+	if err := decoder.Decode(&inputData); err != nil {
+		errorMessage := err.Error()
+
+		respondWithError(w, http.StatusBadRequest, errorMessage)
+		return
+	}
+
+	userID, err := userIDFromContext(r.Context())
+	if err != nil {
+		errorMessage := err.Error()
+
+		respondWithError(w, http.StatusUnauthorized, errorMessage)
+		return
+	}
+
+	fieldErrors := map[string][]string{}
+
+	if strings.TrimSpace(inputData.Name) == "" {
+		fieldErrors["name"] = []string{"is required"}
+	}
+
+	// A client without redirect URIs can only use client_credentials, which
+	// needs a secret.
+	if len(inputData.RedirectURIs) == 0 && !inputData.Confidential {
+		fieldErrors["redirect_uris"] = append(fieldErrors["redirect_uris"], "at least one is required for public clients")
+	}
+
+	for _, redirectURI := range inputData.RedirectURIs {
+		if err := oauth.ValidateRedirectURI(redirectURI); err != nil {
+			fieldErrors["redirect_uris"] = append(fieldErrors["redirect_uris"], err.Description)
+		}
+	}
+
+	if len(inputData.Scopes) == 0 {
+		fieldErrors["scopes"] = []string{"at least one is required"}
+	}
+
+	// An app can't be given more than its owner's token holds; otherwise a
+	// narrow token could register a client and mint broader tokens with it.
+	claims, _ := claimsFromContext(r.Context())
+
+	for _, scope := range inputData.Scopes {
+		if !auth.IsValidScope(scope) {
+			fieldErrors["scopes"] = append(fieldErrors["scopes"], "unknown scope "+scope)
+		} else if !claims.HasScope(scope) {
+			fieldErrors["scopes"] = append(fieldErrors["scopes"], "your token does not grant "+scope)
+		}
+	}
+
+	if len(fieldErrors) > 0 {
+		respondWithFieldErrors(w, http.StatusBadRequest, fieldErrors)
+		return
+	}
+
+	var clientSecret string
+	var secretHash sql.NullString
+
+	if inputData.Confidential {
+		clientSecret, err = auth.MakeRefreshToken()
+		if err != nil {
+			errorMessage := err.Error()
+
+			respondWithError(w, http.StatusInternalServerError, errorMessage)
+			return
+		}
+
+		hashedSecret, err := auth.HashPassword(clientSecret)
+		if err != nil {
+			errorMessage := err.Error()
+
+			respondWithError(w, http.StatusInternalServerError, errorMessage)
+			return
+		}
+
+		secretHash = sql.NullString{String: hashedSecret, Valid: true}
+	}
+
+	createOAuthClientParams := database.CreateOAuthClientParams{
+		OwnerID:      userID,
+		Name:         strings.TrimSpace(inputData.Name),
+		SecretHash:   secretHash,
+		RedirectUris: strings.Join(inputData.RedirectURIs, " "),
+		Scope:        strings.Join(inputData.Scopes, " "),
+	}
+
+	dbClient, err := apiCfg.dbQueries.CreateOAuthClient(r.Context(), createOAuthClientParams)
+	if err != nil {
+		errorMessage := err.Error()
+
+		respondWithError(w, http.StatusBadRequest, errorMessage)
+		return
+	}
+
+	client := oauthClientFromDB(dbClient)
+	client.ClientSecret = clientSecret
+
+	respondwithJSON(w, http.StatusCreated, client)
+}
+
+func (apiCfg *apiConfig) handlerGetOAuthClients(w http.ResponseWriter, r *http.Request) {
+	userID, err := userIDFromContext(r.Context())
+	if err != nil {
+		errorMessage := err.Error()
+
+		respondWithError(w, http.StatusUnauthorized, errorMessage)
+		return
+	}
+
+	dbClients, err := apiCfg.dbQueries.GetOAuthClientsForOwner(r.Context(), userID)
+	if err != nil {
+		errorMessage := err.Error()
+
+		respondWithError(w, http.StatusBadRequest, errorMessage)
+		return
+	}
+
+	retSlc := make([]OAuthClient, len(dbClients))
+	for i, dbClient := range dbClients {
+		retSlc[i] = oauthClientFromDB(dbClient)
+	}
+
+	respondwithJSON(w, http.StatusOK, retSlc)
+}
+
+// handlerDeleteOAuthClient removes an app. Its codes, consents and refresh
+// tokens go with it.
+func (apiCfg *apiConfig) handlerDeleteOAuthClient(w http.ResponseWriter, r *http.Request) {
+	clientID, err := uuid.Parse(r.PathValue("clientID"))
+	if err != nil {
+		errorMessage := "Error parsing client ID"
+
+		respondWithError(w, http.StatusBadRequest, errorMessage)
+		return
+	}
+
+	userID, err := userIDFromContext(r.Context())
+	if err != nil {
+		errorMessage := err.Error()
+
+		respondWithError(w, http.StatusUnauthorized, errorMessage)
+		return
+	}
+
+	deleteOAuthClientParams := database.DeleteOAuthClientParams{
+		ID:      clientID,
+		OwnerID: userID,
+	}
+
+	rows, err := apiCfg.dbQueries.DeleteOAuthClient(r.Context(), deleteOAuthClientParams)
+	if err != nil {
+		errorMessage := err.Error()
+
+		respondWithError(w, http.StatusBadRequest, errorMessage)
+		return
+	}
+
+	if rows == 0 {
+		errorMessage := "client not found"
+
+		respondWithError(w, http.StatusNotFound, errorMessage)
+		return
+	}
+
+	respondwithJSON(w, http.StatusNoContent, nil)
+}
+
+// handlerGetOAuthConsents lists the apps the logged-in user has authorized.
+func (apiCfg *apiConfig) handlerGetOAuthConsents(w http.ResponseWriter, r *http.Request) {
+	userID, err := userIDFromContext(r.Context())
+	if err != nil {
+		errorMessage := err.Error()
+
+		respondWithError(w, http.StatusUnauthorized, errorMessage)
+		return
+	}
+
+	dbConsents, err := apiCfg.dbQueries.GetOAuthConsentsForUser(r.Context(), userID)
+	if err != nil {
+		errorMessage := err.Error()
+
+		respondWithError(w, http.StatusBadRequest, errorMessage)
+		return
+	}
+
+	retSlc := make([]OAuthConsent, len(dbConsents))
+	for i, dbConsent := range dbConsents {
+		retSlc[i] = OAuthConsent{
+			ClientID:   dbConsent.ClientID,
+			ClientName: dbConsent.ClientName,
+			Scopes:     strings.Fields(dbConsent.Scope),
+			GrantedAt:  dbConsent.CreatedAt,
+			UpdatedAt:  dbConsent.UpdatedAt,
+		}
+	}
+
+	respondwithJSON(w, http.StatusOK, retSlc)
+}
+
+// handlerDeleteOAuthConsent revokes an app's access: the consent is removed
+// and every refresh token the app holds for this user is revoked. Access
+// tokens already issued stay valid until they expire.
+func (apiCfg *apiConfig) handlerDeleteOAuthConsent(w http.ResponseWriter, r *http.Request) {
+	clientID, err := uuid.Parse(r.PathValue("clientID"))
+	if err != nil {
+		errorMessage := "Error parsing client ID"
+
+		respondWithError(w, http.StatusBadRequest, errorMessage)
+		return
+	}
+
+	userID, err := userIDFromContext(r.Context())
+	if err != nil {
+		errorMessage := err.Error()
+
+		respondWithError(w, http.StatusUnauthorized, errorMessage)
+		return
+	}
+
+	deleteOAuthConsentParams := database.DeleteOAuthConsentParams{
+		UserID:   userID,
+		ClientID: clientID,
+	}
+
+	rows, err := apiCfg.dbQueries.DeleteOAuthConsent(r.Context(), deleteOAuthConsentParams)
+	if err != nil {
+		errorMessage := err.Error()
+
+		respondWithError(w, http.StatusBadRequest, errorMessage)
+		return
+	}
+
+	if rows == 0 {
+		errorMessage := "consent not found"
+
+		respondWithError(w, http.StatusNotFound, errorMessage)
+		return
+	}
+
+	revokeRefreshTokensForClientParams := database.RevokeRefreshTokensForClientParams{
+		UserID:   userID,
+		ClientID: uuid.NullUUID{UUID: clientID, Valid: true},
+	}
+
+	if err := apiCfg.dbQueries.RevokeRefreshTokensForClient(r.Context(), revokeRefreshTokensForClientParams); err != nil {
+		errorMessage := err.Error()
+
+		respondWithError(w, http.StatusBadRequest, errorMessage)
+		return
+	}
+
+	respondwithJSON(w, http.StatusNoContent, nil)
+}
@@ -0,0 +1,260 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"database/sql"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/Cmolloy36/Chirpy/internal/auth"
+	"github.com/Cmolloy36/Chirpy/internal/database"
+	"github.com/Cmolloy36/Chirpy/internal/oidc"
+)
+
+const (
+	oidcStateCookie = "chirpy_oidc_state"
+	oidcSessionTTL  = 10 * time.Minute
+)
+
+var (
+	errOIDCEmailNotVerified = errors.New("the provider did not supply a verified email")
+	errOIDCLinkConflict     = errors.New("an account with this email already exists; log in and verify your email before signing in with this provider")
+)
+
+// handlerBeginOIDCLogin sends the browser to the provider. The state, nonce
+// and PKCE verifier are kept server-side; the state is also set as a cookie
+// so the callback can only be completed in the browser that started it.
+func (apiCfg *apiConfig) handlerBeginOIDCLogin(w http.ResponseWriter, r *http.Request) {
+	if apiCfg.oidc == nil {
+		errorMessage := "OpenID Connect login is not configured"
+
+		respondWithError(w, http.StatusNotFound, errorMessage)
+		return
+	}
+
+	apiCfg.dbQueries.DeleteExpiredOIDCSessions(r.Context())
+
+	values := make([]string, 3)
+	for i := range values {
+		value, err := oidc.RandomString()
+		if err != nil {
+			errorMessage := err.Error()
+
+			respondWithError(w, http.StatusInternalServerError, errorMessage)
+			return
+		}
+
+		values[i] = value
+	}
+
+	createOIDCSessionParams := database.CreateOIDCSessionParams{
+		State:        values[0],
+		Nonce:        values[1],
+		CodeVerifier: values[2],
+		ExpiresAt:    time.Now().Add(oidcSessionTTL),
+	}
+
+	session, err := apiCfg.dbQueries.CreateOIDCSession(r.Context(), createOIDCSessionParams)
+	if err != nil {
+		errorMessage := err.Error()
+
+		respondWithError(w, http.StatusBadRequest, errorMessage)
+		return
+	}
+
+	authURL, err := apiCfg.oidc.AuthCodeURL(r.Context(), session.State, session.Nonce, session.CodeVerifier)
+	if err != nil {
+		errorMessage := err.Error()
+
+		respondWithError(w, http.StatusBadGateway, errorMessage)
+		return
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcStateCookie,
+		Value:    session.State,
+		Path:     "/api/login/oidc",
+		MaxAge:   int(oidcSessionTTL.Seconds()),
+		HttpOnly: true,
+		Secure:   apiCfg.secureCookies(r),
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	http.Redirect(w, r, authURL, http.StatusFound)
+}
+
+// handlerOIDCCallback finishes the provider login and responds with the
+// same payload as handlerLogin.
+func (apiCfg *apiConfig) handlerOIDCCallback(w http.ResponseWriter, r *http.Request) {
+	if apiCfg.oidc == nil {
+		errorMessage := "OpenID Connect login is not configured"
+
+		respondWithError(w, http.StatusNotFound, errorMessage)
+		return
+	}
+
+	query := r.URL.Query()
+
+	if providerError := query.Get("error"); providerError != "" {
+		errorMessage := "provider returned " + providerError
+
+		respondWithError(w, http.StatusUnauthorized, errorMessage)
+		return
+	}
+
+	state := query.Get("state")
+
+	cookie, err := r.Cookie(oidcStateCookie)
+	if err != nil || state == "" || subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(state)) != 1 {
+		errorMessage := "login state does not match"
+
+		respondWithError(w, http.StatusBadRequest, errorMessage)
+		return
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:   oidcStateCookie,
+		Path:   "/api/login/oidc",
+		MaxAge: -1,
+	})
+
+	session, err := apiCfg.dbQueries.ConsumeOIDCSession(r.Context(), state)
+	if err != nil {
+		errorMessage := "login session expired"
+
+		respondWithError(w, http.StatusBadRequest, errorMessage)
+		return
+	}
+
+	claims, err := apiCfg.oidc.Exchange(r.Context(), query.Get("code"), session.CodeVerifier, session.Nonce)
+	if err != nil {
+		errorMessage := err.Error()
+
+		respondWithError(w, http.StatusUnauthorized, errorMessage)
+		return
+	}
+
+	dbUser, err := apiCfg.userForOIDCClaims(r.Context(), claims)
+	if errors.Is(err, errOIDCEmailNotVerified) {
+		errorMessage := err.Error()
+
+		respondWithError(w, http.StatusForbidden, errorMessage)
+		return
+	} else if errors.Is(err, errRegistrationClosed) {
+		errorMessage := err.Error()
+
+		respondWithError(w, http.StatusForbidden, errorMessage)
+		return
+	} else if errors.Is(err, errOIDCLinkConflict) {
+		errorMessage := err.Error()
+
+		respondWithError(w, http.StatusConflict, errorMessage)
+		return
+	} else if err != nil {
+		errorMessage := err.Error()
+
+		respondWithError(w, http.StatusBadRequest, errorMessage)
+		return
+	}
+
+	apiCfg.respondWithLogin(w, r, dbUser, loginMethodOIDC, 0, false, false)
+}
+
+// userForOIDCClaims finds the Chirpy user for a provider identity, linking
+// or creating one on first sign-in. Linking goes by email, and only when
+// both the provider and Chirpy have verified it; otherwise whoever
+// registered the address first (on either side) could take over the other
+// account.
+func (apiCfg *apiConfig) userForOIDCClaims(ctx context.Context, claims oidc.Claims) (database.User, error) {
+	getUserIdentityParams := database.GetUserIdentityParams{
+		Issuer:  apiCfg.oidc.Issuer(),
+		Subject: claims.Subject,
+	}
+
+	identity, err := apiCfg.dbQueries.GetUserIdentity(ctx, getUserIdentityParams)
+	if err == nil {
+		return apiCfg.dbQueries.GetUserFromID(ctx, identity.UserID)
+	} else if !errors.Is(err, sql.ErrNoRows) {
+		return database.User{}, err
+	}
+
+	email := claims.VerifiedEmail()
+	if email == "" {
+		return database.User{}, errOIDCEmailNotVerified
+	}
+
+	tx, err := apiCfg.db.BeginTx(ctx, nil)
+	if err != nil {
+		return database.User{}, err
+	}
+	defer tx.Rollback()
+
+	qtx := apiCfg.dbQueries.WithTx(tx)
+
+	dbUser, err := qtx.GetUser(ctx, email)
+	if errors.Is(err, sql.ErrNoRows) {
+		if apiCfg.registrationMode != registrationOpen {
+			return database.User{}, errRegistrationClosed
+		}
+
+		dbUser, err = createOIDCUser(ctx, qtx, email)
+		if err != nil {
+			return database.User{}, err
+		}
+	} else if err != nil {
+		return database.User{}, err
+	} else if !dbUser.EmailVerifiedAt.Valid {
+		return database.User{}, errOIDCLinkConflict
+	}
+
+	createUserIdentityParams := database.CreateUserIdentityParams{
+		UserID:  dbUser.ID,
+		Issuer:  apiCfg.oidc.Issuer(),
+		Subject: claims.Subject,
+		Email:   email,
+	}
+
+	if _, err := qtx.CreateUserIdentity(ctx, createUserIdentityParams); err != nil {
+		return database.User{}, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return database.User{}, err
+	}
+
+	return dbUser, nil
+}
+
+// createOIDCUser registers a user who signed in through the provider. They
+// get an unguessable password, so until they reset it the provider is the
+// only way in.
+func createOIDCUser(ctx context.Context, qtx *database.Queries, email string) (database.User, error) {
+	password, err := auth.MakeRefreshToken()
+	if err != nil {
+		return database.User{}, err
+	}
+
+	hashedPassword, err := auth.HashPassword(password)
+	if err != nil {
+		return database.User{}, err
+	}
+
+	createUserParams := database.CreateUserParams{
+		Email:          email,
+		HashedPassword: hashedPassword,
+	}
+
+	dbUser, err := qtx.CreateUser(ctx, createUserParams)
+	if err != nil {
+		return database.User{}, err
+	}
+
+	markEmailVerifiedParams := database.MarkEmailVerifiedParams{
+		ID:    dbUser.ID,
+		Email: dbUser.Email,
+	}
+
+	return qtx.MarkEmailVerified(ctx, markEmailVerifiedParams)
+}
@@ -0,0 +1,445 @@
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/Cmolloy36/Chirpy/internal/database"
+	"github.com/Cmolloy36/Chirpy/internal/webauthn"
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+const (
+	ceremonyRegistration   = "webauthn.create"
+	ceremonyAuthentication = "webauthn.get"
+)
+
+type Passkey struct {
+	ID         uuid.UUID  `json:"id"`
+	CreatedAt  time.Time  `json:"created_at"`
+	Name       string     `json:"name"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+}
+
+func passkeyFromDB(dbPasskey database.Passkey) Passkey {
+	passkey := Passkey{
+		ID:        dbPasskey.ID,
+		CreatedAt: dbPasskey.CreatedAt,
+		Name:      dbPasskey.Name,
+	}
+
+	if dbPasskey.LastUsedAt.Valid {
+		passkey.LastUsedAt = &dbPasskey.LastUsedAt.Time
+	}
+
+	return passkey
+}
+
+type PasskeyCeremony struct {
+	SessionID uuid.UUID `json:"session_id"`
+	PublicKey any       `json:"public_key"`
+}
+
+func (apiCfg *apiConfig) handlerBeginPasskeyRegistration(w http.ResponseWriter, r *http.Request) {
+	userID, err := userIDFromContext(r.Context())
+	if err != nil {
+		errorMessage := err.Error()
+
+		respondWithError(w, http.StatusUnauthorized, errorMessage)
+		return
+	}
+
+	dbUser, err := apiCfg.dbQueries.GetUserFromID(r.Context(), userID)
+	if err != nil {
+		errorMessage := err.Error()
+
+		respondWithError(w, http.StatusBadRequest, errorMessage)
+		return
+	}
+
+	existing, err := apiCfg.dbQueries.GetPasskeysForUser(r.Context(), userID)
+	if err != nil {
+		errorMessage := err.Error()
+
+		respondWithError(w, http.StatusBadRequest, errorMessage)
+		return
+	}
+
+	existingIDs := make([][]byte, len(existing))
+	for i, passkey := range existing {
+		existingIDs[i] = passkey.CredentialID
+	}
+
+	// Abandoned ceremonies are never consumed, so sweep them as we go.
+	apiCfg.dbQueries.DeleteExpiredWebauthnSessions(r.Context())
+
+	challenge, err := webauthn.NewChallenge()
+	if err != nil {
+		errorMessage := err.Error()
+
+		respondWithError(w, http.StatusInternalServerError, errorMessage)
+		return
+	}
+
+	createWebauthnSessionParams := database.CreateWebauthnSessionParams{
+		UserID:    uuid.NullUUID{UUID: userID, Valid: true},
+		Ceremony:  ceremonyRegistration,
+		Challenge: challenge,
+		ExpiresAt: time.Now().Add(webauthn.CeremonyTimeout),
+	}
+
+	session, err := apiCfg.dbQueries.CreateWebauthnSession(r.Context(), createWebauthnSessionParams)
+	if err != nil {
+		errorMessage := err.Error()
+
+		respondWithError(w, http.StatusBadRequest, errorMessage)
+		return
+	}
+
+	userHandle := userID[:]
+
+	ceremony := PasskeyCeremony{
+		SessionID: session.ID,
+		PublicKey: apiCfg.webauthn.CreationOptions(challenge, userHandle, dbUser.Email, existingIDs),
+	}
+
+	respondwithJSON(w, http.StatusOK, ceremony)
+}
+
+func (apiCfg *apiConfig) handlerFinishPasskeyRegistration(w http.ResponseWriter, r *http.Request) {
+	type inputJSON struct {
+		SessionID uuid.UUID                    `json:"session_id"`
+		Name      string                       `json:"name"`
+		Response  webauthn.AttestationResponse `json:"response"`
+	}
+
+	var inputData inputJSON
+
+	decoder := json.NewDecoder(r.Body)
+
+	defer r.Body.Close()
+
+	if err := decoder.Decode(&inputData); err != nil {
+		errorMessage := err.Error()
+
+		respondWithError(w, http.StatusBadRequest, errorMessage)
+		return
+	}
+
+	userID, err := userIDFromContext(r.Context())
+	if err != nil {
+		errorMessage := err.Error()
+
+		respondWithError(w, http.StatusUnauthorized, errorMessage)
+		return
+	}
+
+	session, err := apiCfg.consumeWebauthnSession(r, inputData.SessionID, ceremonyRegistration)
+	if err != nil || session.UserID.UUID != userID {
+		errorMessage := "invalid or expired passkey session"
+
+		respondWithError(w, http.StatusBadRequest, errorMessage)
+		return
+	}
+
+	credential, err := apiCfg.webauthn.VerifyRegistration(session.Challenge, inputData.Response)
+	if err != nil {
+		errorMessage := err.Error()
+
+		respondWithError(w, http.StatusBadRequest, errorMessage)
+		return
+	}
+
+	if inputData.Name == "" {
+		inputData.Name = "Passkey"
+	}
+
+	createPasskeyParams := database.CreatePasskeyParams{
+		UserID:       userID,
+		Name:         inputData.Name,
+		CredentialID: credential.ID,
+		PublicKey:    credential.PublicKey,
+		SignCount:    int64(credential.SignCount),
+	}
+
+	dbPasskey, err := apiCfg.dbQueries.CreatePasskey(r.Context(), createPasskeyParams)
+	if err != nil {
+		errorMessage := err.Error()
+
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Code == "23505" {
+			respondWithError(w, http.StatusConflict, "passkey is already registered")
+			return
+		}
+
+		respondWithError(w, http.StatusBadRequest, errorMessage)
+		return
+	}
+
+	respondwithJSON(w, http.StatusCreated, passkeyFromDB(dbPasskey))
+}
+
+func (apiCfg *apiConfig) handlerGetPasskeys(w http.ResponseWriter, r *http.Request) {
+	userID, err := userIDFromContext(r.Context())
+	if err != nil {
+		errorMessage := err.Error()
+
+		respondWithError(w, http.StatusUnauthorized, errorMessage)
+		return
+	}
+
+	dbPasskeys, err := apiCfg.dbQueries.GetPasskeysForUser(r.Context(), userID)
+	if err != nil {
+		errorMessage := err.Error()
+
+		respondWithError(w, http.StatusBadRequest, errorMessage)
+		return
+	}
+
+	retSlc := make([]Passkey, len(dbPasskeys))
+	for i, dbPasskey := range dbPasskeys {
+		retSlc[i] = passkeyFromDB(dbPasskey)
+	}
+
+	respondwithJSON(w, http.StatusOK, retSlc)
+}
+
+func (apiCfg *apiConfig) handlerDeletePasskey(w http.ResponseWriter, r *http.Request) {
+	passkeyID, err := uuid.Parse(r.PathValue("passkeyID"))
+	if err != nil {
+		errorMessage := "Error parsing passkey ID"
+
+		respondWithError(w, http.StatusBadRequest, errorMessage)
+		return
+	}
+
+	userID, err := userIDFromContext(r.Context())
+	if err != nil {
+		errorMessage := err.Error()
+
+		respondWithError(w, http.StatusUnauthorized, errorMessage)
+		return
+	}
+
+	deletePasskeyParams := database.DeletePasskeyParams{
+		ID:     passkeyID,
+		UserID: userID,
+	}
+
+	rows, err := apiCfg.dbQueries.DeletePasskey(r.Context(), deletePasskeyParams)
+	if err != nil {
+		errorMessage := err.Error()
+
+		respondWithError(w, http.StatusBadRequest, errorMessage)
+		return
+	}
+
+	if rows == 0 {
+		errorMessage := "passkey not found"
+
+		respondWithError(w, http.StatusNotFound, errorMessage)
+		return
+	}
+
+	respondwithJSON(w, http.StatusNoContent, nil)
+}
+
+// handlerBeginPasskeyLogin starts an assertion ceremony. With an email the
+// user's credentials are listed in allowCredentials; without one the browser
+// offers any discoverable passkey for this site.
+func (apiCfg *apiConfig) handlerBeginPasskeyLogin(w http.ResponseWriter, r *http.Request) {
+	type inputJSON struct {
+		Email string `json:"email"`
+	}
+
+	var inputData inputJSON
+
+	decoder := json.NewDecoder(r.Body)
+
+	defer r.Body.Close()
+
+	if err := decoder.Decode(&inputData); err != nil {
+		errorMessage := err.Error()
+
+		respondWithError(w, http.StatusBadRequest, errorMessage)
+		return
+	}
+
+	var allowed [][]byte
+
+	if inputData.Email != "" {
+		// Unknown emails get an empty allow list rather than an error so the
+		// endpoint can't be used to probe for accounts.
+		dbUser, err := apiCfg.dbQueries.GetUser(r.Context(), inputData.Email)
+		if err == nil {
+			passkeys, err := apiCfg.dbQueries.GetPasskeysForUser(r.Context(), dbUser.ID)
+			if err != nil {
+				errorMessage := err.Error()
+
+				respondWithError(w, http.StatusBadRequest, errorMessage)
+				return
+			}
+
+			for _, passkey := range passkeys {
+				allowed = append(allowed, passkey.CredentialID)
+			}
+		}
+	}
+
+	// Abandoned ceremonies are never consumed, so sweep them as we go.
+	apiCfg.dbQueries.DeleteExpiredWebauthnSessions(r.Context())
+
+	challenge, err := webauthn.NewChallenge()
+	if err != nil {
+		errorMessage := err.Error()
+
+		respondWithError(w, http.StatusInternalServerError, errorMessage)
+		return
+	}
+
+	createWebauthnSessionParams := database.CreateWebauthnSessionParams{
+		Ceremony:  ceremonyAuthentication,
+		Challenge: challenge,
+		ExpiresAt: time.Now().Add(webauthn.CeremonyTimeout),
+	}
+
+	session, err := apiCfg.dbQueries.CreateWebauthnSession(r.Context(), createWebauthnSessionParams)
+	if err != nil {
+		errorMessage := err.Error()
+
+		respondWithError(w, http.StatusBadRequest, errorMessage)
+		return
+	}
+
+	ceremony := PasskeyCeremony{
+		SessionID: session.ID,
+		PublicKey: apiCfg.webauthn.RequestOptions(challenge, allowed),
+	}
+
+	respondwithJSON(w, http.StatusOK, ceremony)
+}
+
+func (apiCfg *apiConfig) handlerFinishPasskeyLogin(w http.ResponseWriter, r *http.Request) {
+	type inputJSON struct {
+		SessionID        uuid.UUID                  `json:"session_id"`
+		CredentialID     webauthn.URLEncodedBase64  `json:"credential_id"`
+		Response         webauthn.AssertionResponse `json:"response"`
+		ExpiresInSeconds int                        `json:"expires_in_seconds"`
+		RememberMe       bool                       `json:"remember_me"`
+		SessionCookies   bool                       `json:"session_cookies"`
+	}
+
+	var inputData inputJSON
+
+	decoder := json.NewDecoder(r.Body)
+
+	defer r.Body.Close()
+
+	if err := decoder.Decode(&inputData); err != nil {
+		errorMessage := err.Error()
+
+		respondWithError(w, http.StatusBadRequest, errorMessage)
+		return
+	}
+
+	session, err := apiCfg.consumeWebauthnSession(r, inputData.SessionID, ceremonyAuthentication)
+	if err != nil {
+		errorMessage := "invalid or expired passkey session"
+
+		respondWithError(w, http.StatusBadRequest, errorMessage)
+		return
+	}
+
+	dbPasskey, err := apiCfg.dbQueries.GetPasskeyByCredentialID(r.Context(), inputData.CredentialID)
+	if err != nil {
+		errorMessage := "unknown passkey"
+
+		respondWithError(w, http.StatusUnauthorized, errorMessage)
+		return
+	}
+
+	userHandle := inputData.Response.UserHandle
+	if len(userHandle) > 0 && !bytes.Equal(userHandle, dbPasskey.UserID[:]) {
+		errorMessage := "passkey does not belong to this user"
+
+		respondWithError(w, http.StatusUnauthorized, errorMessage)
+		return
+	}
+
+	credential := webauthn.Credential{
+		ID:        dbPasskey.CredentialID,
+		PublicKey: dbPasskey.PublicKey,
+		SignCount: uint32(dbPasskey.SignCount),
+	}
+
+	signCount, err := apiCfg.webauthn.VerifyAssertion(session.Challenge, credential, inputData.Response)
+	if err != nil {
+		apiCfg.recordLogin(w, r, uuid.NullUUID{UUID: dbPasskey.UserID, Valid: true}, "", loginMethodPasskey, false)
+
+		errorMessage := err.Error()
+
+		respondWithError(w, http.StatusUnauthorized, errorMessage)
+		return
+	}
+
+	updatePasskeySignCountParams := database.UpdatePasskeySignCountParams{
+		ID:          dbPasskey.ID,
+		SignCount:   dbPasskey.SignCount,
+		SignCount_2: int64(signCount),
+	}
+
+	// Matching on the old count makes a concurrent login with a cloned
+	// authenticator lose the race instead of both succeeding.
+	rows, err := apiCfg.dbQueries.UpdatePasskeySignCount(r.Context(), updatePasskeySignCountParams)
+	if err != nil || rows == 0 {
+		errorMessage := webauthn.ErrSignCountRegressed.Error()
+
+		respondWithError(w, http.StatusUnauthorized, errorMessage)
+		return
+	}
+
+	dbUser, err := apiCfg.dbQueries.GetUserFromID(r.Context(), dbPasskey.UserID)
+	if err != nil {
+		errorMessage := err.Error()
+
+		respondWithError(w, http.StatusBadRequest, errorMessage)
+		return
+	}
+
+	apiCfg.recordLogin(w, r, uuid.NullUUID{UUID: dbUser.ID, Valid: true}, dbUser.Email, loginMethodPasskey, true)
+
+	user, err := apiCfg.issueLoginTokens(r.Context(), dbUser, inputData.ExpiresInSeconds, inputData.RememberMe)
+	if err != nil {
+		errorMessage := err.Error()
+
+		respondWithError(w, http.StatusBadRequest, errorMessage)
+		return
+	}
+
+	apiCfg.respondWithTokens(w, r, user, inputData.ExpiresInSeconds, inputData.RememberMe, inputData.SessionCookies)
+}
+
+// consumeWebauthnSession deletes and returns the stored challenge, so each
+// ceremony can be finished at most once.
+func (apiCfg *apiConfig) consumeWebauthnSession(r *http.Request, sessionID uuid.UUID, ceremony string) (database.WebauthnSession, error) {
+	consumeWebauthnSessionParams := database.ConsumeWebauthnSessionParams{
+		ID:       sessionID,
+		Ceremony: ceremony,
+	}
+
+	session, err := apiCfg.dbQueries.ConsumeWebauthnSession(r.Context(), consumeWebauthnSessionParams)
+	if err != nil {
+		return database.WebauthnSession{}, err
+	}
+
+	if time.Now().After(session.ExpiresAt) {
+		return database.WebauthnSession{}, sql.ErrNoRows
+	}
+
+	return session, nil
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/Cmolloy36/Chirpy/internal/auth"
+	"github.com/google/uuid"
+)
+
+type TokenIntrospection struct {
+	Active    bool       `json:"active"`
+	TokenType string     `json:"token_type,omitempty"`
+	ClientID  string     `json:"client_id,omitempty"`
+	Subject   *uuid.UUID `json:"sub,omitempty"`
+	Audience  []string   `json:"aud,omitempty"`
+	Scope     string     `json:"scope,omitempty"`
+	IssuedAt  *time.Time `json:"issued_at,omitempty"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	ExpiresIn int        `json:"expires_in,omitempty"`
+}
+
+// handlerIntrospectToken reports on the bearer token itself, which may be
+// either an access token or a refresh token, or on an API key. Tokens that
+// are unknown, expired or revoked report only {"active": false}.
+func (apiCfg *apiConfig) handlerIntrospectToken(w http.ResponseWriter, r *http.Request) {
+	if auth.HasAPIKey(r.Header) {
+		apiCfg.introspectAPIKey(w, r)
+		return
+	}
+
+	tokenString, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		errorMessage := err.Error()
+
+		respondWithError(w, http.StatusUnauthorized, errorMessage)
+		return
+	}
+
+	currTime := time.Now()
+
+	if claims, err := auth.ValidateJWT(tokenString, apiCfg.secretString, apiCfg.tokenAudience); err == nil {
+		userID, _ := claims.UserID()
+		issuedAt := claims.IssuedAt.Time
+		expiresAt := claims.ExpiresAt.Time
+
+		respondwithJSON(w, http.StatusOK, TokenIntrospection{
+			Active:    true,
+			TokenType: "access_token",
+			ClientID:  claims.ClientID,
+			Subject:   &userID,
+			Audience:  claims.Audience,
+			Scope:     claims.Scope,
+			IssuedAt:  &issuedAt,
+			ExpiresAt: &expiresAt,
+			ExpiresIn: int(expiresAt.Sub(currTime).Seconds()),
+		})
+		return
+	}
+
+	refreshToken, err := apiCfg.dbQueries.GetRefreshToken(r.Context(), tokenString)
+	if err != nil || refreshToken.RevokedAt.Valid || currTime.After(refreshToken.ExpiresAt) {
+		respondwithJSON(w, http.StatusOK, TokenIntrospection{Active: false})
+		return
+	}
+
+	var clientID string
+	if refreshToken.ClientID.Valid {
+		clientID = refreshToken.ClientID.UUID.String()
+	}
+
+	respondwithJSON(w, http.StatusOK, TokenIntrospection{
+		Active:    true,
+		TokenType: "refresh_token",
+		ClientID:  clientID,
+		Subject:   &refreshToken.UserID,
+		IssuedAt:  &refreshToken.CreatedAt,
+		ExpiresAt: &refreshToken.ExpiresAt,
+		ExpiresIn: int(refreshToken.ExpiresAt.Sub(currTime).Seconds()),
+	})
+}
+
+func (apiCfg *apiConfig) introspectAPIKey(w http.ResponseWriter, r *http.Request) {
+	claims, err := apiCfg.claimsFromAPIKey(r.Context(), r.Header)
+	if err != nil {
+		respondwithJSON(w, http.StatusOK, TokenIntrospection{Active: false})
+		return
+	}
+
+	userID, _ := claims.UserID()
+	issuedAt := claims.IssuedAt.Time
+
+	introspection := TokenIntrospection{
+		Active:    true,
+		TokenType: "api_key",
+		Subject:   &userID,
+		Scope:     claims.Scope,
+		IssuedAt:  &issuedAt,
+	}
+
+	if claims.ExpiresAt != nil {
+		expiresAt := claims.ExpiresAt.Time
+		introspection.ExpiresAt = &expiresAt
+		introspection.ExpiresIn = int(time.Until(expiresAt).Seconds())
+	}
+
+	respondwithJSON(w, http.StatusOK, introspection)
+}
@@ -0,0 +1,487 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/Cmolloy36/Chirpy/internal/auth"
+	"github.com/Cmolloy36/Chirpy/internal/database"
+	"github.com/Cmolloy36/Chirpy/internal/qrcode"
+	"github.com/google/uuid"
+)
+
+const totpIssuer = "Chirpy"
+
+type TwoFactorChallenge struct {
+	TwoFactorRequired bool   `json:"two_factor_required"`
+	ChallengeToken    string `json:"challenge_token"`
+}
+
+type TwoFactorEnrollment struct {
+	Secret     string `json:"secret"`
+	OTPAuthURI string `json:"otpauth_uri"`
+	QRCodePNG  string `json:"qr_code_png"`
+}
+
+type RecoveryCodes struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+func (apiCfg *apiConfig) twoFactorEnabled(ctx context.Context, userID uuid.UUID) (bool, error) {
+	totp, err := apiCfg.dbQueries.GetTOTP(ctx, userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+
+	return totp.EnabledAt.Valid, nil
+}
+
+// handlerEnrollTwoFactor starts (or restarts) enrollment with a new secret.
+// The secret does nothing until it is confirmed with a valid code.
+func (apiCfg *apiConfig) handlerEnrollTwoFactor(w http.ResponseWriter, r *http.Request) {
+	userID, err := userIDFromContext(r.Context())
+	if err != nil {
+		errorMessage := err.Error()
+
+		respondWithError(w, http.StatusUnauthorized, errorMessage)
+		return
+	}
+
+	twoFactorEnabled, err := apiCfg.twoFactorEnabled(r.Context(), userID)
+	if err != nil {
+		errorMessage := err.Error()
+
+		respondWithError(w, http.StatusBadRequest, errorMessage)
+		return
+	}
+
+	if twoFactorEnabled {
+		errorMessage := "two-factor authentication is already enabled"
+
+		respondWithError(w, http.StatusConflict, errorMessage)
+		return
+	}
+
+	dbUser, err := apiCfg.dbQueries.GetUserFromID(r.Context(), userID)
+	if err != nil {
+		errorMessage := err.Error()
+
+		respondWithError(w, http.StatusBadRequest, errorMessage)
+		return
+	}
+
+	secret, err := auth.GenerateTOTPSecret()
+	if err != nil {
+		errorMessage := err.Error()
+
+		respondWithError(w, http.StatusInternalServerError, errorMessage)
+		return
+	}
+
+	upsertPendingTOTPParams := database.UpsertPendingTOTPParams{
+		UserID: userID,
+		Secret: secret,
+	}
+
+	if _, err := apiCfg.dbQueries.UpsertPendingTOTP(r.Context(), upsertPendingTOTPParams); err != nil {
+		errorMessage := err.Error()
+
+		respondWithError(w, http.StatusBadRequest, errorMessage)
+		return
+	}
+
+	uri := auth.TOTPURI(secret, totpIssuer, dbUser.Email)
+
+	qrCode, err := qrcode.Encode([]byte(uri))
+	if err != nil {
+		errorMessage := err.Error()
+
+		respondWithError(w, http.StatusInternalServerError, errorMessage)
+		return
+	}
+
+	qrPNG, err := qrCode.PNG(6)
+	if err != nil {
+		errorMessage := err.Error()
+
+		respondWithError(w, http.StatusInternalServerError, errorMessage)
+		return
+	}
+
+	enrollment := TwoFactorEnrollment{
+		Secret:     secret,
+		OTPAuthURI: uri,
+		QRCodePNG:  "data:image/png;base64," + base64.StdEncoding.EncodeToString(qrPNG),
+	}
+
+	respondwithJSON(w, http.StatusOK, enrollment)
+}
+
+// handlerConfirmTwoFactor enables 2FA once the user proves their
+// authenticator works, and hands back the one-time recovery codes.
+func (apiCfg *apiConfig) handlerConfirmTwoFactor(w http.ResponseWriter, r *http.Request) {
+	type inputJSON struct {
+		Code string `json:"code"`
+	}
+
+	var inputData inputJSON
+
+	decoder := json.NewDecoder(r.Body)
+
+	defer r.Body.Close()
+
+	if err := decoder.Decode(&inputData); err != nil {
+		errorMessage := err.Error()
+
+		respondWithError(w, http.StatusBadRequest, errorMessage)
+		return
+	}
+
+	userID, err := userIDFromContext(r.Context())
+	if err != nil {
+		errorMessage := err.Error()
+
+		respondWithError(w, http.StatusUnauthorized, errorMessage)
+		return
+	}
+
+	totp, err := apiCfg.dbQueries.GetTOTP(r.Context(), userID)
+	if err != nil {
+		errorMessage := "two-factor enrollment has not been started"
+
+		respondWithError(w, http.StatusBadRequest, errorMessage)
+		return
+	}
+
+	if totp.EnabledAt.Valid {
+		errorMessage := "two-factor authentication is already enabled"
+
+		respondWithError(w, http.StatusConflict, errorMessage)
+		return
+	}
+
+	step, err := auth.ValidateTOTP(totp.Secret, inputData.Code, time.Now())
+	if err != nil {
+		errorMessage := err.Error()
+
+		respondWithError(w, http.StatusUnauthorized, errorMessage)
+		return
+	}
+
+	recoveryCodes, err := auth.GenerateRecoveryCodes(auth.RecoveryCodeCount)
+	if err != nil {
+		errorMessage := err.Error()
+
+		respondWithError(w, http.StatusInternalServerError, errorMessage)
+		return
+	}
+
+	tx, err := apiCfg.db.BeginTx(r.Context(), nil)
+	if err != nil {
+		errorMessage := err.Error()
+
+		respondWithError(w, http.StatusInternalServerError, errorMessage)
+		return
+	}
+	defer tx.Rollback()
+
+	qtx := apiCfg.dbQueries.WithTx(tx)
+
+	enableTOTPParams := database.EnableTOTPParams{
+		UserID:       userID,
+		LastUsedStep: step,
+	}
+
+	if _, err := qtx.EnableTOTP(r.Context(), enableTOTPParams); err != nil {
+		errorMessage := err.Error()
+
+		respondWithError(w, http.StatusBadRequest, errorMessage)
+		return
+	}
+
+	if err := qtx.DeleteRecoveryCodes(r.Context(), userID); err != nil {
+		errorMessage := err.Error()
+
+		respondWithError(w, http.StatusBadRequest, errorMessage)
+		return
+	}
+
+	for _, code := range recoveryCodes {
+		codeHash, err := auth.HashPassword(code)
+		if err != nil {
+			errorMessage := err.Error()
+
+			respondWithError(w, http.StatusInternalServerError, errorMessage)
+			return
+		}
+
+		createRecoveryCodeParams := database.CreateRecoveryCodeParams{
+			UserID:   userID,
+			CodeHash: codeHash,
+		}
+
+		if err := qtx.CreateRecoveryCode(r.Context(), createRecoveryCodeParams); err != nil {
+			errorMessage := err.Error()
+
+			respondWithError(w, http.StatusBadRequest, errorMessage)
+			return
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		errorMessage := err.Error()
+
+		respondWithError(w, http.StatusInternalServerError, errorMessage)
+		return
+	}
+
+	respondwithJSON(w, http.StatusOK, RecoveryCodes{RecoveryCodes: recoveryCodes})
+}
+
+func (apiCfg *apiConfig) handlerDisableTwoFactor(w http.ResponseWriter, r *http.Request) {
+	type inputJSON struct {
+		Password string `json:"password"`
+	}
+
+	var inputData inputJSON
+
+	decoder := json.NewDecoder(r.Body)
+
+	defer r.Body.Close()
+
+	if err := decoder.Decode(&inputData); err != nil {
+		errorMessage := err.Error()
+
+		respondWithError(w, http.StatusBadRequest, errorMessage)
+		return
+	}
+
+	userID, err := userIDFromContext(r.Context())
+	if err != nil {
+		errorMessage := err.Error()
+
+		respondWithError(w, http.StatusUnauthorized, errorMessage)
+		return
+	}
+
+	dbUser, err := apiCfg.dbQueries.GetUserFromID(r.Context(), userID)
+	if err != nil {
+		errorMessage := err.Error()
+
+		respondWithError(w, http.StatusBadRequest, errorMessage)
+		return
+	}
+
+	if err := auth.CheckPasswordHash(dbUser.HashedPassword, inputData.Password); err != nil {
+		errorMessage := err.Error()
+
+		respondWithError(w, http.StatusUnauthorized, errorMessage)
+		return
+	}
+
+	tx, err := apiCfg.db.BeginTx(r.Context(), nil)
+	if err != nil {
+		errorMessage := err.Error()
+
+		respondWithError(w, http.StatusInternalServerError, errorMessage)
+		return
+	}
+	defer tx.Rollback()
+
+	qtx := apiCfg.dbQueries.WithTx(tx)
+
+	if err := qtx.DeleteTOTP(r.Context(), userID); err != nil {
+		errorMessage := err.Error()
+
+		respondWithError(w, http.StatusBadRequest, errorMessage)
+		return
+	}
+
+	if err := qtx.DeleteRecoveryCodes(r.Context(), userID); err != nil {
+		errorMessage := err.Error()
+
+		respondWithError(w, http.StatusBadRequest, errorMessage)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		errorMessage := err.Error()
+
+		respondWithError(w, http.StatusInternalServerError, errorMessage)
+		return
+	}
+
+	respondwithJSON(w, http.StatusNoContent, nil)
+}
+
+// handlerLoginTwoFactor completes a login that handlerLogin answered with a
+// challenge token. Either a current TOTP code or an unused recovery code is
+// accepted.
+func (apiCfg *apiConfig) handlerLoginTwoFactor(w http.ResponseWriter, r *http.Request) {
+	type inputJSON struct {
+		ChallengeToken   string `json:"challenge_token"`
+		Code             string `json:"code"`
+		RecoveryCode     string `json:"recovery_code"`
+		ExpiresInSeconds int    `json:"expires_in_seconds"`
+		RememberMe       bool   `json:"remember_me"`
+		SessionCookies   bool   `json:"session_cookies"`
+	}
+
+	var inputData inputJSON
+
+	decoder := json.NewDecoder(r.Body)
+
+	defer r.Body.Close()
+
+	if err := decoder.Decode(&inputData); err != nil {
+		errorMessage := err.Error()
+
+		respondWithError(w, http.StatusBadRequest, errorMessage)
+		return
+	}
+
+	claims, err := auth.ValidateJWT(inputData.ChallengeToken, apiCfg.secretString, auth.TwoFactorAudience)
+	if err != nil {
+		errorMessage := err.Error()
+
+		respondWithError(w, http.StatusUnauthorized, errorMessage)
+		return
+	}
+
+	userID, err := claims.UserID()
+	if err != nil {
+		errorMessage := err.Error()
+
+		respondWithError(w, http.StatusUnauthorized, errorMessage)
+		return
+	}
+
+	twoFactorKey := twoFactorThrottleKey(userID)
+	ipKey := ipThrottleKey(clientIP(r, apiCfg.trustProxyHeaders))
+
+	blockedUntil, err := apiCfg.loginBlockedUntil(r.Context(), twoFactorKey, ipKey)
+	if err != nil {
+		errorMessage := err.Error()
+
+		respondWithError(w, http.StatusInternalServerError, errorMessage)
+		return
+	}
+
+	if !blockedUntil.IsZero() {
+		respondThrottled(w, blockedUntil)
+		return
+	}
+
+	totp, err := apiCfg.dbQueries.GetTOTP(r.Context(), userID)
+	if err != nil || !totp.EnabledAt.Valid {
+		errorMessage := "two-factor authentication is not enabled"
+
+		respondWithError(w, http.StatusBadRequest, errorMessage)
+		return
+	}
+
+	method := loginMethodTOTP
+	if inputData.RecoveryCode != "" {
+		method = loginMethodRecoveryCode
+		err = apiCfg.useRecoveryCode(r.Context(), userID, inputData.RecoveryCode)
+	} else {
+		err = apiCfg.useTOTPCode(r.Context(), totp, inputData.Code)
+	}
+	if err != nil {
+		apiCfg.recordLogin(w, r, uuid.NullUUID{UUID: userID, Valid: true}, "", method, false)
+
+		if _, err := apiCfg.recordLoginFailure(r.Context(), twoFactorKey, ipKey); err != nil {
+			log.Printf("Error recording failed login: %s", err)
+		}
+
+		errorMessage := err.Error()
+
+		respondWithError(w, http.StatusUnauthorized, errorMessage)
+		return
+	}
+
+	if err := apiCfg.clearLoginThrottle(r.Context(), twoFactorKey); err != nil {
+		log.Printf("Error clearing login throttle: %s", err)
+	}
+
+	dbUser, err := apiCfg.dbQueries.GetUserFromID(r.Context(), userID)
+	if err != nil {
+		errorMessage := err.Error()
+
+		respondWithError(w, http.StatusBadRequest, errorMessage)
+		return
+	}
+
+	apiCfg.recordLogin(w, r, uuid.NullUUID{UUID: dbUser.ID, Valid: true}, dbUser.Email, method, true)
+
+	user, err := apiCfg.issueLoginTokens(r.Context(), dbUser, inputData.ExpiresInSeconds, inputData.RememberMe)
+	if err != nil {
+		errorMessage := err.Error()
+
+		respondWithError(w, http.StatusBadRequest, errorMessage)
+		return
+	}
+
+	apiCfg.respondWithTokens(w, r, user, inputData.ExpiresInSeconds, inputData.RememberMe, inputData.SessionCookies)
+}
+
+// useTOTPCode validates code and records its time step so the same code
+// cannot be used twice.
+func (apiCfg *apiConfig) useTOTPCode(ctx context.Context, totp database.UserTotp, code string) error {
+	step, err := auth.ValidateTOTP(totp.Secret, code, time.Now())
+	if err != nil {
+		return err
+	}
+
+	setTOTPLastUsedStepParams := database.SetTOTPLastUsedStepParams{
+		UserID:       totp.UserID,
+		LastUsedStep: step,
+	}
+
+	rows, err := apiCfg.dbQueries.SetTOTPLastUsedStep(ctx, setTOTPLastUsedStepParams)
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return auth.ErrInvalidTOTPCode
+	}
+
+	return nil
+}
+
+func (apiCfg *apiConfig) useRecoveryCode(ctx context.Context, userID uuid.UUID, code string) error {
+	codes, err := apiCfg.dbQueries.GetUnusedRecoveryCodes(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	code = auth.NormalizeRecoveryCode(code)
+
+	for _, recoveryCode := range codes {
+		if auth.CheckPasswordHash(recoveryCode.CodeHash, code) != nil {
+			continue
+		}
+
+		rows, err := apiCfg.dbQueries.UseRecoveryCode(ctx, recoveryCode.ID)
+		if err != nil {
+			return err
+		}
+
+		if rows == 0 {
+			break
+		}
+
+		return nil
+	}
+
+	return auth.ErrInvalidTOTPCode
+}
@@ -1,13 +1,18 @@
 package main
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
+	"errors"
+	"log"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/Cmolloy36/Chirpy/internal/auth"
 	"github.com/Cmolloy36/Chirpy/internal/database"
+	"github.com/google/uuid"
 )
 
 func (apiCfg *apiConfig) handlerLogin(w http.ResponseWriter, r *http.Request) {
@@ -15,6 +20,10 @@ func (apiCfg *apiConfig) handlerLogin(w http.ResponseWriter, r *http.Request) {
 		Password         string `json:"password"`
 		Email            string `json:"email"`
 		ExpiresInSeconds int    `json:"expires_in_seconds"`
+		RememberMe       bool   `json:"remember_me"`
+		SessionCookies   bool   `json:"session_cookies"`
+		PowChallenge     string `json:"pow_challenge"`
+		PowSolution      string `json:"pow_solution"`
 	}
 
 	var inputData inputJSON
@@ -30,34 +39,80 @@ func (apiCfg *apiConfig) handlerLogin(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if (inputData.ExpiresInSeconds == 0) || (inputData.ExpiresInSeconds > 3600) {
-		inputData.ExpiresInSeconds = 3600
+	if err := apiCfg.spendChallenge(r.Context(), inputData.PowChallenge, inputData.PowSolution); err != nil {
+		respondWithChallengeError(w, err)
+		return
 	}
 
-	dbPassword, err := apiCfg.dbQueries.GetPassword(r.Context(), inputData.Email)
+	ip := clientIP(r, apiCfg.trustProxyHeaders)
+	accountKey := accountThrottleKey(inputData.Email)
+	ipKey := ipThrottleKey(ip)
+
+	blockedUntil, err := apiCfg.loginBlockedUntil(r.Context(), accountKey, ipKey)
 	if err != nil {
 		errorMessage := err.Error()
 
-		respondWithError(w, http.StatusBadRequest, errorMessage)
+		respondWithError(w, http.StatusInternalServerError, errorMessage)
 		return
 	}
 
-	if err := auth.CheckPasswordHash(dbPassword, inputData.Password); err != nil {
-		errorMessage := err.Error()
-
-		respondWithError(w, http.StatusUnauthorized, errorMessage)
+	if !blockedUntil.IsZero() {
+		respondThrottled(w, blockedUntil)
 		return
 	}
 
+	// Unknown accounts still pay for a password hash comparison so the response
+	// time doesn't reveal whether the email is registered.
 	dbUser, err := apiCfg.dbQueries.GetUser(r.Context(), inputData.Email)
-	if err != nil {
+	userExists := err == nil
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
 		errorMessage := "Error encountered when retrieving user"
 
-		respondWithError(w, http.StatusBadRequest, errorMessage)
+		respondWithError(w, http.StatusInternalServerError, errorMessage)
+		return
+	}
+
+	hashedPassword := auth.DummyPasswordHash()
+	if userExists {
+		hashedPassword = dbUser.HashedPassword
+	}
+
+	if err := auth.CheckPasswordHash(hashedPassword, inputData.Password); err != nil || !userExists {
+		apiCfg.recordLogin(w, r, uuid.NullUUID{UUID: dbUser.ID, Valid: userExists}, inputData.Email, loginMethodPassword, false)
+
+		newlyLocked, err := apiCfg.recordLoginFailure(r.Context(), accountKey, ipKey)
+		if err != nil {
+			log.Printf("Error recording failed login: %s", err)
+		}
+
+		for _, key := range newlyLocked {
+			if key == accountKey && userExists {
+				if err := apiCfg.sendLockoutEmail(r.Context(), dbUser.Email, ip, key.policy.LockoutDuration); err != nil {
+					log.Printf("Error sending lockout email: %s", err)
+				}
+			}
+		}
+
+		respondWithError(w, http.StatusUnauthorized, errMsgInvalidLogin)
 		return
 	}
 
-	accessToken, err := auth.MakeJWT(dbUser.ID, apiCfg.secretString)
+	if err := apiCfg.clearLoginThrottle(r.Context(), accountKey); err != nil {
+		log.Printf("Error clearing login throttle: %s", err)
+	}
+
+	if auth.NeedsRehash(dbUser.HashedPassword) {
+		apiCfg.rehashPassword(r.Context(), dbUser.ID, inputData.Password)
+	}
+
+	apiCfg.respondWithLogin(w, r, dbUser, loginMethodPassword, inputData.ExpiresInSeconds, inputData.RememberMe, inputData.SessionCookies)
+}
+
+// respondWithLogin finishes a login whose first factor has been checked. If
+// the account has 2FA enabled the response is a challenge instead of tokens,
+// and the login is recorded once the second factor is checked.
+func (apiCfg *apiConfig) respondWithLogin(w http.ResponseWriter, r *http.Request, dbUser database.User, method string, expiresInSeconds int, rememberMe, sessionCookies bool) {
+	twoFactorEnabled, err := apiCfg.twoFactorEnabled(r.Context(), dbUser.ID)
 	if err != nil {
 		errorMessage := err.Error()
 
@@ -65,7 +120,25 @@ func (apiCfg *apiConfig) handlerLogin(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	refreshTokenString, err := auth.MakeRefreshToken()
+	if twoFactorEnabled {
+		challengeToken, err := auth.MakeJWT(dbUser.ID, apiCfg.secretString, auth.TwoFactorAudience, nil, auth.TwoFactorChallengeTTL)
+		if err != nil {
+			errorMessage := err.Error()
+
+			respondWithError(w, http.StatusBadRequest, errorMessage)
+			return
+		}
+
+		respondwithJSON(w, http.StatusOK, TwoFactorChallenge{
+			TwoFactorRequired: true,
+			ChallengeToken:    challengeToken,
+		})
+		return
+	}
+
+	apiCfg.recordLogin(w, r, uuid.NullUUID{UUID: dbUser.ID, Valid: true}, dbUser.Email, method, true)
+
+	user, err := apiCfg.issueLoginTokens(r.Context(), dbUser, expiresInSeconds, rememberMe)
 	if err != nil {
 		errorMessage := err.Error()
 
@@ -73,8 +146,45 @@ func (apiCfg *apiConfig) handlerLogin(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	apiCfg.respondWithTokens(w, r, user, expiresInSeconds, rememberMe, sessionCookies)
+}
+
+// rehashPassword upgrades a stored hash to the current algorithm and
+// parameters. The login has already succeeded, so failures are only logged.
+func (apiCfg *apiConfig) rehashPassword(ctx context.Context, userID uuid.UUID, password string) {
+	hashedPassword, err := auth.HashPassword(password)
+	if err != nil {
+		log.Printf("Error rehashing password: %s", err)
+		return
+	}
+
+	updateUserPasswordParams := database.UpdateUserPasswordParams{
+		ID:             userID,
+		HashedPassword: hashedPassword,
+	}
+
+	if _, err := apiCfg.dbQueries.UpdateUserPassword(ctx, updateUserPasswordParams); err != nil {
+		log.Printf("Error saving rehashed password: %s", err)
+	}
+}
+
+// issueLoginTokens creates a new access and refresh token pair for dbUser
+// and returns the User payload that every login flow responds with.
+func (apiCfg *apiConfig) issueLoginTokens(ctx context.Context, dbUser database.User, expiresInSeconds int, rememberMe bool) (User, error) {
+	accessTTL := apiCfg.tokenPolicy.AccessTTLFor(expiresInSeconds)
+
+	accessToken, err := auth.MakeJWT(dbUser.ID, apiCfg.secretString, apiCfg.tokenAudience, auth.AllScopes, accessTTL)
+	if err != nil {
+		return User{}, err
+	}
+
+	refreshTokenString, err := auth.MakeRefreshToken()
+	if err != nil {
+		return User{}, err
+	}
+
 	currTime := time.Now()
-	expiresIn := time.Duration(60*24) * time.Duration(time.Hour)
+	expiresIn := apiCfg.tokenPolicy.RefreshTTLFor(rememberMe)
 	expiresAt := currTime.Add(expiresIn)
 
 	createRefreshTokenParams := database.CreateRefreshTokenParams{
@@ -83,31 +193,65 @@ func (apiCfg *apiConfig) handlerLogin(w http.ResponseWriter, r *http.Request) {
 		ExpiresAt: expiresAt,
 	}
 
-	_, err = apiCfg.dbQueries.CreateRefreshToken(r.Context(), createRefreshTokenParams)
+	_, err = apiCfg.dbQueries.CreateRefreshToken(ctx, createRefreshTokenParams)
 	if err != nil {
-		errorMessage := err.Error()
-
-		respondWithError(w, http.StatusBadRequest, errorMessage)
-		return
+		return User{}, err
 	}
 
 	user := User{
-		ID:           dbUser.ID,
-		CreatedAt:    dbUser.CreatedAt,
-		UpdatedAt:    dbUser.UpdatedAt,
-		Email:        dbUser.Email,
-		Token:        accessToken,
-		RefreshToken: refreshTokenString,
-		IsChirpyRed:  dbUser.IsChirpyRed,
+		ID:            dbUser.ID,
+		CreatedAt:     dbUser.CreatedAt,
+		UpdatedAt:     dbUser.UpdatedAt,
+		Email:         dbUser.Email,
+		EmailVerified: dbUser.EmailVerifiedAt.Valid,
+		Token:         accessToken,
+		RefreshToken:  refreshTokenString,
+		IsChirpyRed:   dbUser.IsChirpyRed,
 	}
 
-	respondwithJSON(w, http.StatusOK, user)
+	return user, nil
 }
 
+// validateCredentials checks a new email and password pair and returns the
+// problems with each field, or nil if there are none.
+func (apiCfg *apiConfig) validateCredentials(email, password string) map[string][]string {
+	fieldErrors := map[string][]string{}
+
+	if problems := emailProblems(email); len(problems) > 0 {
+		fieldErrors["email"] = problems
+	}
+
+	if problems := apiCfg.passwordPolicy.Check(password, email); len(problems) > 0 {
+		fieldErrors["password"] = problems
+	}
+
+	if len(fieldErrors) == 0 {
+		return nil
+	}
+
+	return fieldErrors
+}
+
+func emailProblems(email string) []string {
+	if email := strings.TrimSpace(email); email == "" {
+		return []string{"is required"}
+	} else if !strings.Contains(email, "@") {
+		return []string{"must be an email address"}
+	}
+
+	return nil
+}
+
+// handlerPostUser registers a user. Outside open registration it needs an
+// invite code; in waitlist mode a signup without one is queued for an admin
+// to approve and gets a 202.
 func (apiCfg *apiConfig) handlerPostUser(w http.ResponseWriter, r *http.Request) {
 	type inputJSON struct {
-		Password string `json:"password"`
-		Email    string `json:"email"`
+		Password     string `json:"password"`
+		Email        string `json:"email"`
+		InviteCode   string `json:"invite_code"`
+		PowChallenge string `json:"pow_challenge"`
+		PowSolution  string `json:"pow_solution"`
 	}
 
 	var inputData inputJSON
@@ -123,6 +267,25 @@ func (apiCfg *apiConfig) handlerPostUser(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	if err := apiCfg.spendChallenge(r.Context(), inputData.PowChallenge, inputData.PowSolution); err != nil {
+		respondWithChallengeError(w, err)
+		return
+	}
+
+	fieldErrors := apiCfg.validateCredentials(inputData.Email, inputData.Password)
+
+	if apiCfg.registrationMode == registrationInviteOnly && strings.TrimSpace(inputData.InviteCode) == "" {
+		if fieldErrors == nil {
+			fieldErrors = map[string][]string{}
+		}
+		fieldErrors["invite_code"] = []string{"is required"}
+	}
+
+	if len(fieldErrors) > 0 {
+		respondWithFieldErrors(w, http.StatusBadRequest, fieldErrors)
+		return
+	}
+
 	hashedPassword, err := auth.HashPassword(inputData.Password)
 	if err != nil {
 		errorMessage := err.Error()
@@ -131,12 +294,63 @@ func (apiCfg *apiConfig) handlerPostUser(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	if apiCfg.registrationMode == registrationWaitlist && strings.TrimSpace(inputData.InviteCode) == "" {
+		createWaitlistEntryParams := database.CreateWaitlistEntryParams{
+			Email:          inputData.Email,
+			HashedPassword: hashedPassword,
+		}
+
+		// Joining twice, or with an address that already has an account,
+		// looks the same as joining, so this can't be used to probe for
+		// registered emails.
+		if err := apiCfg.dbQueries.CreateWaitlistEntry(r.Context(), createWaitlistEntryParams); err != nil {
+			errorMessage := err.Error()
+
+			respondWithError(w, http.StatusBadRequest, errorMessage)
+			return
+		}
+
+		waitlistSignup := WaitlistSignup{
+			Email:  inputData.Email,
+			Status: waitlistStatusPending,
+		}
+
+		respondwithJSON(w, http.StatusAccepted, waitlistSignup)
+		return
+	}
+
+	tx, err := apiCfg.db.BeginTx(r.Context(), nil)
+	if err != nil {
+		errorMessage := err.Error()
+
+		respondWithError(w, http.StatusInternalServerError, errorMessage)
+		return
+	}
+	defer tx.Rollback()
+
+	qtx := apiCfg.dbQueries.WithTx(tx)
+
+	// The invite is only used up if the account is created.
+	if apiCfg.registrationMode != registrationOpen {
+		if _, err := qtx.RedeemInvite(r.Context(), auth.HashInviteCode(inputData.InviteCode)); errors.Is(err, sql.ErrNoRows) {
+			errorMessage := errInvalidInviteCode.Error()
+
+			respondWithError(w, http.StatusForbidden, errorMessage)
+			return
+		} else if err != nil {
+			errorMessage := err.Error()
+
+			respondWithError(w, http.StatusBadRequest, errorMessage)
+			return
+		}
+	}
+
 	createUserParams := database.CreateUserParams{
 		Email:          inputData.Email,
 		HashedPassword: hashedPassword,
 	}
 
-	dbUser, err := apiCfg.dbQueries.CreateUser(r.Context(), createUserParams)
+	dbUser, err := qtx.CreateUser(r.Context(), createUserParams)
 	if err != nil {
 		errorMessage := err.Error()
 
@@ -144,22 +358,39 @@ func (apiCfg *apiConfig) handlerPostUser(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	if err := tx.Commit(); err != nil {
+		errorMessage := err.Error()
+
+		respondWithError(w, http.StatusInternalServerError, errorMessage)
+		return
+	}
+
+	// The account is usable either way; the user can ask for a new link.
+	if err := apiCfg.sendVerificationEmail(r.Context(), dbUser.ID, dbUser.Email); err != nil {
+		log.Printf("Error sending verification email: %s", err)
+	}
+
 	user := User{
-		ID:          dbUser.ID,
-		CreatedAt:   dbUser.CreatedAt,
-		UpdatedAt:   dbUser.UpdatedAt,
-		Email:       dbUser.Email,
-		IsChirpyRed: dbUser.IsChirpyRed,
+		ID:            dbUser.ID,
+		CreatedAt:     dbUser.CreatedAt,
+		UpdatedAt:     dbUser.UpdatedAt,
+		Email:         dbUser.Email,
+		EmailVerified: dbUser.EmailVerifiedAt.Valid,
+		IsChirpyRed:   dbUser.IsChirpyRed,
 	}
 
 	respondwithJSON(w, http.StatusCreated, user)
 
 }
 
+// handlerPutUser is the legacy full update: both email and password are
+// required. It is otherwise the same as PATCH /api/users/me, so it also
+// needs the current password and only starts an email change.
 func (apiCfg *apiConfig) handlerPutUser(w http.ResponseWriter, r *http.Request) {
 	type inputJSON struct {
-		Password string `json:"password"`
-		Email    string `json:"email"`
+		Password        string `json:"password"`
+		Email           string `json:"email"`
+		CurrentPassword string `json:"current_password"`
 	}
 
 	var inputData inputJSON
@@ -175,15 +406,39 @@ func (apiCfg *apiConfig) handlerPutUser(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	hashedPassword, err := auth.HashPassword(inputData.Password)
-	if err != nil {
+	apiCfg.updateUser(w, r, &inputData.Email, &inputData.Password, inputData.CurrentPassword)
+}
+
+// handlerPatchUser updates only the fields that are sent. Both changes need
+// the current password. A new email address is not applied until it has
+// been confirmed through the link sent to it.
+func (apiCfg *apiConfig) handlerPatchUser(w http.ResponseWriter, r *http.Request) {
+	type inputJSON struct {
+		Email           *string `json:"email"`
+		Password        *string `json:"password"`
+		CurrentPassword string  `json:"current_password"`
+	}
+
+	var inputData inputJSON
+
+	decoder := json.NewDecoder(r.Body)
+
+	defer r.Body.Close()
+
+	if err := decoder.Decode(&inputData); err != nil {
 		errorMessage := err.Error()
 
 		respondWithError(w, http.StatusBadRequest, errorMessage)
 		return
 	}
 
-	accessTokenString, err := auth.GetBearerToken(r.Header)
+	apiCfg.updateUser(w, r, inputData.Email, inputData.Password, inputData.CurrentPassword)
+}
+
+// updateUser changes the password and starts an email change, for
+// whichever of email and password is non-nil.
+func (apiCfg *apiConfig) updateUser(w http.ResponseWriter, r *http.Request, email, password *string, currentPassword string) {
+	userID, err := userIDFromContext(r.Context())
 	if err != nil {
 		errorMessage := err.Error()
 
@@ -191,38 +446,113 @@ func (apiCfg *apiConfig) handlerPutUser(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	userID, err := auth.ValidateJWT(accessTokenString, apiCfg.secretString)
+	dbUser, err := apiCfg.dbQueries.GetUserFromID(r.Context(), userID)
 	if err != nil {
 		errorMessage := err.Error()
 
-		respondWithError(w, http.StatusUnauthorized, errorMessage)
+		respondWithError(w, http.StatusBadRequest, errorMessage)
 		return
 	}
 
-	UpdateUserCredentialsParams := database.UpdateUserCredentialsParams{
-		ID:             userID,
-		Email:          inputData.Email,
-		HashedPassword: hashedPassword,
+	newEmail := ""
+	if email != nil && strings.TrimSpace(*email) != dbUser.Email {
+		newEmail = strings.TrimSpace(*email)
 	}
 
-	dbUser, err := apiCfg.dbQueries.UpdateUserCredentials(r.Context(), UpdateUserCredentialsParams)
-	if err != nil {
-		errorMessage := err.Error()
+	if newEmail == "" && password == nil {
+		errorMessage := "nothing to update"
 
 		respondWithError(w, http.StatusBadRequest, errorMessage)
 		return
 	}
 
+	fieldErrors := map[string][]string{}
+
+	if email != nil {
+		if problems := emailProblems(*email); len(problems) > 0 {
+			fieldErrors["email"] = problems
+		}
+	}
+
+	if password != nil {
+		if problems := apiCfg.passwordPolicy.Check(*password, dbUser.Email); len(problems) > 0 {
+			fieldErrors["password"] = problems
+		}
+	}
+
+	if currentPassword == "" {
+		fieldErrors["current_password"] = []string{"is required"}
+	}
+
+	if len(fieldErrors) > 0 {
+		respondWithFieldErrors(w, http.StatusBadRequest, fieldErrors)
+		return
+	}
+
+	if err := auth.CheckPasswordHash(dbUser.HashedPassword, currentPassword); err != nil {
+		errorMessage := "current password is incorrect"
+
+		respondWithError(w, http.StatusUnauthorized, errorMessage)
+		return
+	}
+
+	if newEmail != "" {
+		if _, err := apiCfg.dbQueries.GetUser(r.Context(), newEmail); err == nil {
+			errorMessage := "email address is already in use"
+
+			respondWithError(w, http.StatusConflict, errorMessage)
+			return
+		} else if !errors.Is(err, sql.ErrNoRows) {
+			errorMessage := err.Error()
+
+			respondWithError(w, http.StatusBadRequest, errorMessage)
+			return
+		}
+	}
+
+	if password != nil {
+		hashedPassword, err := auth.HashPassword(*password)
+		if err != nil {
+			errorMessage := err.Error()
+
+			respondWithError(w, http.StatusBadRequest, errorMessage)
+			return
+		}
+
+		updateUserPasswordParams := database.UpdateUserPasswordParams{
+			ID:             userID,
+			HashedPassword: hashedPassword,
+		}
+
+		dbUser, err = apiCfg.dbQueries.UpdateUserPassword(r.Context(), updateUserPasswordParams)
+		if err != nil {
+			errorMessage := err.Error()
+
+			respondWithError(w, http.StatusBadRequest, errorMessage)
+			return
+		}
+	}
+
+	if newEmail != "" {
+		if err := apiCfg.startEmailChange(r.Context(), dbUser, newEmail); err != nil {
+			errorMessage := err.Error()
+
+			respondWithError(w, http.StatusInternalServerError, errorMessage)
+			return
+		}
+	}
+
 	user := User{
-		ID:          dbUser.ID,
-		CreatedAt:   dbUser.CreatedAt,
-		UpdatedAt:   dbUser.UpdatedAt,
-		Email:       dbUser.Email,
-		IsChirpyRed: dbUser.IsChirpyRed,
+		ID:            dbUser.ID,
+		CreatedAt:     dbUser.CreatedAt,
+		UpdatedAt:     dbUser.UpdatedAt,
+		Email:         dbUser.Email,
+		EmailVerified: dbUser.EmailVerifiedAt.Valid,
+		PendingEmail:  newEmail,
+		IsChirpyRed:   dbUser.IsChirpyRed,
 	}
 
 	respondwithJSON(w, http.StatusOK, user)
-
 }
 
 func (apiCfg *apiConfig) handlerGetUser(w http.ResponseWriter, r *http.Request) {
@@ -252,11 +582,12 @@ func (apiCfg *apiConfig) handlerGetUser(w http.ResponseWriter, r *http.Request)
 	}
 
 	user := User{
-		ID:          dbUser.ID,
-		CreatedAt:   dbUser.CreatedAt,
-		UpdatedAt:   dbUser.UpdatedAt,
-		Email:       dbUser.Email,
-		IsChirpyRed: dbUser.IsChirpyRed,
+		ID:            dbUser.ID,
+		CreatedAt:     dbUser.CreatedAt,
+		UpdatedAt:     dbUser.UpdatedAt,
+		Email:         dbUser.Email,
+		EmailVerified: dbUser.EmailVerifiedAt.Valid,
+		IsChirpyRed:   dbUser.IsChirpyRed,
 	}
 
 	respondwithJSON(w, http.StatusOK, user)
@@ -268,7 +599,7 @@ func (apiCfg *apiConfig) handlerRefresh(w http.ResponseWriter, r *http.Request)
 		Token string `json:"token"`
 	}
 
-	refreshTokenString, err := auth.GetBearerToken(r.Header)
+	refreshTokenString, err := auth.GetRefreshToken(r.Header)
 	if err != nil {
 		errorMessage := err.Error()
 
@@ -276,14 +607,28 @@ func (apiCfg *apiConfig) handlerRefresh(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	if err := auth.CheckCSRF(r); err != nil {
+		errorMessage := err.Error()
+
+		respondWithError(w, http.StatusForbidden, errorMessage)
+		return
+	}
+
 	refreshTokenParams, err := apiCfg.dbQueries.GetRefreshToken(r.Context(), refreshTokenString)
-	if (err != nil) || (time.Now().After(refreshTokenParams.ExpiresAt)) {
+	if err != nil {
 		errorMessage := err.Error()
 
 		respondWithError(w, http.StatusUnauthorized, errorMessage)
 		return
 	}
 
+	if time.Now().After(refreshTokenParams.ExpiresAt) {
+		errorMessage := "refresh token expired"
+
+		respondWithError(w, http.StatusUnauthorized, errorMessage)
+		return
+	}
+
 	if !refreshTokenParams.RevokedAt.Time.IsZero() {
 		errorMessage := "refresh token was previously revoked"
 
@@ -291,6 +636,16 @@ func (apiCfg *apiConfig) handlerRefresh(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	// Tokens issued to OAuth clients carry their own scopes and are
+	// refreshed through /oauth/token; refreshing them here would grant
+	// every scope.
+	if refreshTokenParams.ClientID.Valid {
+		errorMessage := "refresh token belongs to an OAuth client"
+
+		respondWithError(w, http.StatusUnauthorized, errorMessage)
+		return
+	}
+
 	user, err := apiCfg.dbQueries.GetUserFromRefreshToken(r.Context(), refreshTokenParams.Token)
 	if err != nil {
 		errorMessage := err.Error()
@@ -299,7 +654,7 @@ func (apiCfg *apiConfig) handlerRefresh(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	accessToken, err := auth.MakeJWT(user.ID, apiCfg.secretString)
+	accessToken, err := auth.MakeJWT(user.ID, apiCfg.secretString, apiCfg.tokenAudience, auth.AllScopes, apiCfg.tokenPolicy.AccessTTL)
 	if err != nil {
 		errorMessage := err.Error()
 
@@ -307,6 +662,14 @@ func (apiCfg *apiConfig) handlerRefresh(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	// Browser sessions get the new access token as a cookie, keeping it out
+	// of JavaScript.
+	if auth.IsCookieAuth(r.Header) {
+		apiCfg.setAccessTokenCookie(w, r, accessToken, apiCfg.tokenPolicy.AccessTTL)
+		respondwithJSON(w, http.StatusNoContent, nil)
+		return
+	}
+
 	tokenStruct := Token{
 		Token: accessToken,
 	}
@@ -314,8 +677,10 @@ func (apiCfg *apiConfig) handlerRefresh(w http.ResponseWriter, r *http.Request)
 	respondwithJSON(w, http.StatusOK, tokenStruct)
 }
 
+// handlerRevoke revokes a refresh token. For browser sessions it is the
+// logout endpoint and also clears the session cookies.
 func (apiCfg *apiConfig) handlerRevoke(w http.ResponseWriter, r *http.Request) {
-	refreshTokenString, err := auth.GetBearerToken(r.Header)
+	refreshTokenString, err := auth.GetRefreshToken(r.Header)
 	if err != nil {
 		errorMessage := err.Error()
 
@@ -323,6 +688,17 @@ func (apiCfg *apiConfig) handlerRevoke(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if err := auth.CheckCSRF(r); err != nil {
+		errorMessage := err.Error()
+
+		respondWithError(w, http.StatusForbidden, errorMessage)
+		return
+	}
+
+	if auth.IsCookieAuth(r.Header) {
+		clearSessionCookies(w)
+	}
+
 	revokedAt := sql.NullTime{
 		Time:  time.Now(),
 		Valid: true,
@@ -334,12 +710,19 @@ func (apiCfg *apiConfig) handlerRevoke(w http.ResponseWriter, r *http.Request) {
 	}
 
 	refreshTokenParams, err := apiCfg.dbQueries.SetTokenRevokedAt(r.Context(), setTokenRevokedAtParams)
-	if (err != nil) || (time.Now().After(refreshTokenParams.ExpiresAt)) {
+	if err != nil {
 		errorMessage := err.Error()
 
 		respondWithError(w, http.StatusUnauthorized, errorMessage)
 		return
 	}
 
+	if time.Now().After(refreshTokenParams.ExpiresAt) {
+		errorMessage := "refresh token expired"
+
+		respondWithError(w, http.StatusUnauthorized, errorMessage)
+		return
+	}
+
 	respondwithJSON(w, http.StatusNoContent, nil)
 }
@@ -0,0 +1,386 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Cmolloy36/Chirpy/internal/database"
+	"github.com/Cmolloy36/Chirpy/internal/webhooks"
+	"github.com/google/uuid"
+)
+
+const maxWebhookEndpoints = 10
+
+type WebhookEndpoint struct {
+	ID        uuid.UUID `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	URL       string    `json:"url"`
+	Events    []string  `json:"events"`
+	Secret    string    `json:"secret,omitempty"`
+}
+
+type WebhookDelivery struct {
+	ID             uuid.UUID                `json:"id"`
+	CreatedAt      time.Time                `json:"created_at"`
+	EventID        uuid.UUID                `json:"event_id"`
+	EventType      string                   `json:"event_type"`
+	Status         string                   `json:"status"`
+	Attempts       int32                    `json:"attempts"`
+	NextAttemptAt  *time.Time               `json:"next_attempt_at"`
+	LastStatusCode *int32                   `json:"last_status_code"`
+	LastError      string                   `json:"last_error,omitempty"`
+	DeliveredAt    *time.Time               `json:"delivered_at"`
+	Payload        json.RawMessage          `json:"payload,omitempty"`
+	AttemptLog     []WebhookDeliveryAttempt `json:"attempt_log,omitempty"`
+}
+
+type WebhookDeliveryAttempt struct {
+	CreatedAt  time.Time `json:"created_at"`
+	StatusCode *int32    `json:"status_code"`
+	Error      string    `json:"error,omitempty"`
+	DurationMs int32     `json:"duration_ms"`
+}
+
+func webhookEndpointFromDB(dbEndpoint database.WebhookEndpoint) WebhookEndpoint {
+	return WebhookEndpoint{
+		ID:        dbEndpoint.ID,
+		CreatedAt: dbEndpoint.CreatedAt,
+		URL:       dbEndpoint.Url,
+		Events:    strings.Fields(dbEndpoint.Events),
+	}
+}
+
+func webhookDeliveryFromDB(dbDelivery database.WebhookDelivery) WebhookDelivery {
+	delivery := WebhookDelivery{
+		ID:        dbDelivery.ID,
+		CreatedAt: dbDelivery.CreatedAt,
+		EventID:   dbDelivery.EventID,
+		EventType: dbDelivery.EventType,
+		Status:    dbDelivery.Status,
+		Attempts:  dbDelivery.Attempts,
+		LastError: dbDelivery.LastError.String,
+	}
+
+	if dbDelivery.Status == webhooks.StatusPending {
+		delivery.NextAttemptAt = &dbDelivery.NextAttemptAt
+	}
+
+	if dbDelivery.LastStatusCode.Valid {
+		delivery.LastStatusCode = &dbDelivery.LastStatusCode.Int32
+	}
+
+	if dbDelivery.DeliveredAt.Valid {
+		delivery.DeliveredAt = &dbDelivery.DeliveredAt.Time
+	}
+
+	return delivery
+}
+
+// handlerPostWebhookEndpoint registers an endpoint for the current user.
+// The signing secret is returned only in this response.
+func (apiCfg *apiConfig) handlerPostWebhookEndpoint(w http.ResponseWriter, r *http.Request) {
+	type inputJSON struct {
+		URL    string   `json:"url"`
+		Events []string `json:"events"`
+	}
+
+	var inputData inputJSON
+
+	decoder := json.NewDecoder(r.Body)
+
+	defer r.Body.Close()
+
+	if err := decoder.Decode(&inputData); err != nil {
+		errorMessage := err.Error()
+
+		respondWithError(w, http.StatusBadRequest, errorMessage)
+		return
+	}
+
+	userID, err := userIDFromContext(r.Context())
+	if err != nil {
+		errorMessage := err.Error()
+
+		respondWithError(w, http.StatusUnauthorized, errorMessage)
+		return
+	}
+
+	fieldErrors := map[string][]string{}
+
+	// Plain http is only allowed while developing against a local receiver.
+	if err := webhooks.ValidateURL(inputData.URL, apiCfg.platform == "dev"); err != nil {
+		fieldErrors["url"] = []string{err.Error()}
+	}
+
+	if len(inputData.Events) == 0 {
+		fieldErrors["events"] = []string{"at least one is required"}
+	}
+
+	for _, event := range inputData.Events {
+		if !webhooks.IsValidEvent(event) {
+			fieldErrors["events"] = append(fieldErrors["events"], "unknown event "+event)
+		}
+	}
+
+	if len(fieldErrors) > 0 {
+		respondWithFieldErrors(w, http.StatusBadRequest, fieldErrors)
+		return
+	}
+
+	count, err := apiCfg.dbQueries.CountWebhookEndpointsForUser(r.Context(), userID)
+	if err != nil {
+		errorMessage := err.Error()
+
+		respondWithError(w, http.StatusBadRequest, errorMessage)
+		return
+	}
+
+	if count >= maxWebhookEndpoints {
+		errorMessage := "you already have the maximum number of webhook endpoints"
+
+		respondWithError(w, http.StatusForbidden, errorMessage)
+		return
+	}
+
+	secret, err := webhooks.MakeSecret()
+	if err != nil {
+		errorMessage := err.Error()
+
+		respondWithError(w, http.StatusInternalServerError, errorMessage)
+		return
+	}
+
+	createWebhookEndpointParams := database.CreateWebhookEndpointParams{
+		UserID: userID,
+		Url:    inputData.URL,
+		Secret: secret,
+		Events: strings.Join(inputData.Events, " "),
+	}
+
+	dbEndpoint, err := apiCfg.dbQueries.CreateWebhookEndpoint(r.Context(), createWebhookEndpointParams)
+	if err != nil {
+		errorMessage := err.Error()
+
+		respondWithError(w, http.StatusBadRequest, errorMessage)
+		return
+	}
+
+	endpoint := webhookEndpointFromDB(dbEndpoint)
+	endpoint.Secret = secret
+
+	respondwithJSON(w, http.StatusCreated, endpoint)
+}
+
+func (apiCfg *apiConfig) handlerGetWebhookEndpoints(w http.ResponseWriter, r *http.Request) {
+	userID, err := userIDFromContext(r.Context())
+	if err != nil {
+		errorMessage := err.Error()
+
+		respondWithError(w, http.StatusUnauthorized, errorMessage)
+		return
+	}
+
+	dbEndpoints, err := apiCfg.dbQueries.GetWebhookEndpointsForUser(r.Context(), userID)
+	if err != nil {
+		errorMessage := err.Error()
+
+		respondWithError(w, http.StatusBadRequest, errorMessage)
+		return
+	}
+
+	retSlc := make([]WebhookEndpoint, len(dbEndpoints))
+	for i, dbEndpoint := range dbEndpoints {
+		retSlc[i] = webhookEndpointFromDB(dbEndpoint)
+	}
+
+	respondwithJSON(w, http.StatusOK, retSlc)
+}
+
+// handlerDeleteWebhookEndpoint removes an endpoint along with its queued
+// deliveries and delivery log.
+func (apiCfg *apiConfig) handlerDeleteWebhookEndpoint(w http.ResponseWriter, r *http.Request) {
+	endpointID, err := uuid.Parse(r.PathValue("webhookID"))
+	if err != nil {
+		errorMessage := "Error parsing webhook ID"
+
+		respondWithError(w, http.StatusBadRequest, errorMessage)
+		return
+	}
+
+	userID, err := userIDFromContext(r.Context())
+	if err != nil {
+		errorMessage := err.Error()
+
+		respondWithError(w, http.StatusUnauthorized, errorMessage)
+		return
+	}
+
+	deleteWebhookEndpointParams := database.DeleteWebhookEndpointParams{
+		ID:     endpointID,
+		UserID: userID,
+	}
+
+	rows, err := apiCfg.dbQueries.DeleteWebhookEndpoint(r.Context(), deleteWebhookEndpointParams)
+	if err != nil {
+		errorMessage := err.Error()
+
+		respondWithError(w, http.StatusBadRequest, errorMessage)
+		return
+	}
+
+	if rows == 0 {
+		errorMessage := "webhook not found"
+
+		respondWithError(w, http.StatusNotFound, errorMessage)
+		return
+	}
+
+	respondwithJSON(w, http.StatusNoContent, nil)
+}
+
+// webhookEndpointForRequest loads the {webhookID} endpoint, responding
+// with an error and returning false unless it belongs to the current user.
+func (apiCfg *apiConfig) webhookEndpointForRequest(w http.ResponseWriter, r *http.Request) (database.WebhookEndpoint, bool) {
+	endpointID, err := uuid.Parse(r.PathValue("webhookID"))
+	if err != nil {
+		errorMessage := "Error parsing webhook ID"
+
+		respondWithError(w, http.StatusBadRequest, errorMessage)
+		return database.WebhookEndpoint{}, false
+	}
+
+	userID, err := userIDFromContext(r.Context())
+	if err != nil {
+		errorMessage := err.Error()
+
+		respondWithError(w, http.StatusUnauthorized, errorMessage)
+		return database.WebhookEndpoint{}, false
+	}
+
+	getWebhookEndpointForUserParams := database.GetWebhookEndpointForUserParams{
+		ID:     endpointID,
+		UserID: userID,
+	}
+
+	dbEndpoint, err := apiCfg.dbQueries.GetWebhookEndpointForUser(r.Context(), getWebhookEndpointForUserParams)
+	if errors.Is(err, sql.ErrNoRows) {
+		errorMessage := "webhook not found"
+
+		respondWithError(w, http.StatusNotFound, errorMessage)
+		return database.WebhookEndpoint{}, false
+	} else if err != nil {
+		errorMessage := err.Error()
+
+		respondWithError(w, http.StatusBadRequest, errorMessage)
+		return database.WebhookEndpoint{}, false
+	}
+
+	return dbEndpoint, true
+}
+
+// handlerGetWebhookDeliveries lists an endpoint's deliveries, newest first.
+// ?limit= caps the count.
+func (apiCfg *apiConfig) handlerGetWebhookDeliveries(w http.ResponseWriter, r *http.Request) {
+	dbEndpoint, ok := apiCfg.webhookEndpointForRequest(w, r)
+	if !ok {
+		return
+	}
+
+	limit := 50
+	if val := r.URL.Query().Get("limit"); val != "" {
+		parsed, err := strconv.Atoi(val)
+		if err != nil || parsed <= 0 {
+			errorMessage := "limit must be a positive integer"
+
+			respondWithError(w, http.StatusBadRequest, errorMessage)
+			return
+		}
+		limit = min(parsed, 500)
+	}
+
+	getWebhookDeliveriesForEndpointParams := database.GetWebhookDeliveriesForEndpointParams{
+		EndpointID: dbEndpoint.ID,
+		Limit:      int32(limit),
+	}
+
+	dbDeliveries, err := apiCfg.dbQueries.GetWebhookDeliveriesForEndpoint(r.Context(), getWebhookDeliveriesForEndpointParams)
+	if err != nil {
+		errorMessage := err.Error()
+
+		respondWithError(w, http.StatusBadRequest, errorMessage)
+		return
+	}
+
+	retSlc := make([]WebhookDelivery, len(dbDeliveries))
+	for i, dbDelivery := range dbDeliveries {
+		retSlc[i] = webhookDeliveryFromDB(dbDelivery)
+	}
+
+	respondwithJSON(w, http.StatusOK, retSlc)
+}
+
+// handlerGetWebhookDelivery shows one delivery with its payload and a log
+// of every attempt.
+func (apiCfg *apiConfig) handlerGetWebhookDelivery(w http.ResponseWriter, r *http.Request) {
+	dbEndpoint, ok := apiCfg.webhookEndpointForRequest(w, r)
+	if !ok {
+		return
+	}
+
+	deliveryID, err := uuid.Parse(r.PathValue("deliveryID"))
+	if err != nil {
+		errorMessage := "Error parsing delivery ID"
+
+		respondWithError(w, http.StatusBadRequest, errorMessage)
+		return
+	}
+
+	getWebhookDeliveryParams := database.GetWebhookDeliveryParams{
+		ID:         deliveryID,
+		EndpointID: dbEndpoint.ID,
+	}
+
+	dbDelivery, err := apiCfg.dbQueries.GetWebhookDelivery(r.Context(), getWebhookDeliveryParams)
+	if errors.Is(err, sql.ErrNoRows) {
+		errorMessage := "delivery not found"
+
+		respondWithError(w, http.StatusNotFound, errorMessage)
+		return
+	} else if err != nil {
+		errorMessage := err.Error()
+
+		respondWithError(w, http.StatusBadRequest, errorMessage)
+		return
+	}
+
+	dbAttempts, err := apiCfg.dbQueries.GetWebhookDeliveryAttempts(r.Context(), dbDelivery.ID)
+	if err != nil {
+		errorMessage := err.Error()
+
+		respondWithError(w, http.StatusBadRequest, errorMessage)
+		return
+	}
+
+	delivery := webhookDeliveryFromDB(dbDelivery)
+	delivery.Payload = json.RawMessage(dbDelivery.Payload)
+	delivery.AttemptLog = make([]WebhookDeliveryAttempt, len(dbAttempts))
+
+	for i, dbAttempt := range dbAttempts {
+		delivery.AttemptLog[i] = WebhookDeliveryAttempt{
+			CreatedAt:  dbAttempt.CreatedAt,
+			Error:      dbAttempt.Error.String,
+			DurationMs: dbAttempt.DurationMs,
+		}
+
+		if dbAttempt.StatusCode.Valid {
+			delivery.AttemptLog[i].StatusCode = &dbAttempt.StatusCode.Int32
+		}
+	}
+
+	respondwithJSON(w, http.StatusOK, delivery)
+}
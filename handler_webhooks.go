@@ -1,76 +1,323 @@
 package main
 
 import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
 	"database/sql"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
+	"io"
 	"net/http"
+	"strings"
+	"time"
 
 	"github.com/Cmolloy36/Chirpy/internal/auth"
+	"github.com/Cmolloy36/Chirpy/internal/billing"
+	"github.com/Cmolloy36/Chirpy/internal/database"
 	"github.com/google/uuid"
 )
 
+const maxWebhookBodyBytes = 1 << 20
+
+// bodyHashEventIDPrefix marks event IDs made from a hash of the body, for
+// events that came without an ID of their own.
+const bodyHashEventIDPrefix = "sha256:"
+
+const (
+	webhookSourcePolka = "polka"
+
+	webhookStatusReceived   = "received"
+	webhookStatusProcessing = "processing"
+	webhookStatusProcessed  = "processed"
+	webhookStatusIgnored    = "ignored"
+	webhookStatusFailed     = "failed"
+)
+
+var (
+	errWebhookUserNotFound = errors.New("user not found")
+	errWebhookInProgress   = errors.New("webhook event is already being processed")
+)
+
+type polkaEvent struct {
+	ID        string    `json:"id,omitempty"`
+	Event     string    `json:"event,omitempty"`
+	CreatedAt time.Time `json:"created_at,omitempty"`
+	Data      struct {
+		UserID           uuid.UUID `json:"user_id,omitempty"`
+		Plan             string    `json:"plan,omitempty"`
+		CurrentPeriodEnd time.Time `json:"current_period_end,omitempty"`
+	} `json:"data,omitempty"`
+}
+
+// handlerPostPolkaWebhook receives payment events from Polka. When webhook
+// secrets are configured the body must carry a valid HMAC signature;
+// otherwise the legacy static API key is checked.
+//
+// Every event is stored before it is processed. Polka retries deliveries,
+// so an event that was already handled is acknowledged without being
+// applied again.
 func (apiCfg *apiConfig) handlerPostPolkaWebhook(w http.ResponseWriter, r *http.Request) {
-	apiKey, err := auth.GetAPIKey(r.Header)
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxWebhookBodyBytes))
 	if err != nil {
 		errorMessage := err.Error()
 
-		respondWithError(w, http.StatusUnauthorized, errorMessage)
+		respondWithError(w, http.StatusBadRequest, errorMessage)
 		return
 	}
 
-	if apiKey != apiCfg.polkaKey {
-		errorMessage := "incorrect API Key"
+	if err := apiCfg.authenticatePolkaWebhook(r.Header, body); err != nil {
+		errorMessage := err.Error()
 
 		respondWithError(w, http.StatusUnauthorized, errorMessage)
 		return
 	}
 
-	type inputJSON struct {
-		Event string `json:"event,omitempty"`
-		Data  struct {
-			UserID uuid.UUID `json:"user_id,omitempty"`
-		} `json:"data,omitempty"`
+	var inputData polkaEvent
+
+	if err := json.Unmarshal(body, &inputData); err != nil {
+		errorMessage := "Something went wrong"
+
+		respondWithError(w, http.StatusBadRequest, errorMessage)
+		return
 	}
 
-	var inputData inputJSON
+	eventID := polkaEventID(r.Header, inputData, body)
 
-	decoder := json.NewDecoder(r.Body)
+	// Identical bodies are only the same event within the retry window;
+	// after that, e.g. a second upgrade months later, they are new.
+	if strings.HasPrefix(eventID, bodyHashEventIDPrefix) {
+		retireWebhookEventIDParams := database.RetireWebhookEventIDParams{
+			Source:        webhookSourcePolka,
+			EventID:       eventID,
+			WindowSeconds: apiCfg.polkaBodyDedupWindow().Seconds(),
+		}
 
-	defer r.Body.Close()
+		if err := apiCfg.dbQueries.RetireWebhookEventID(r.Context(), retireWebhookEventIDParams); err != nil {
+			errorMessage := err.Error()
 
-	if err := decoder.Decode(&inputData); err != nil {
-		errorMessage := "Something went wrong"
+			respondWithError(w, http.StatusInternalServerError, errorMessage)
+			return
+		}
+	}
 
-		respondWithError(w, http.StatusBadRequest, errorMessage)
+	webhookEvent, err := apiCfg.storeWebhookEvent(r.Context(), webhookSourcePolka, eventID, inputData.Event, body)
+	if err != nil {
+		errorMessage := err.Error()
+
+		respondWithError(w, http.StatusInternalServerError, errorMessage)
 		return
 	}
 
-	if inputData.Event != "user.upgraded" {
+	if webhookEvent.Status == webhookStatusProcessed || webhookEvent.Status == webhookStatusIgnored {
 		respondwithJSON(w, http.StatusNoContent, nil)
 		return
 	}
 
-	dbUser, err := apiCfg.dbQueries.UpgradeUsertoChirpyRed(r.Context(), inputData.Data.UserID)
-	if err != nil {
+	webhookEvent, err = apiCfg.processWebhookEvent(r.Context(), webhookEvent)
+	if errors.Is(err, errWebhookInProgress) {
+		// Polka will retry, and by then the first delivery has finished.
 		errorMessage := err.Error()
 
-		if errors.Is(err, sql.ErrNoRows) {
-			respondWithError(w, http.StatusNotFound, errorMessage)
-			return
-		}
+		respondWithError(w, http.StatusConflict, errorMessage)
+		return
+	} else if errors.Is(err, errWebhookUserNotFound) {
+		errorMessage := err.Error()
+
+		respondWithError(w, http.StatusNotFound, errorMessage)
+		return
+	} else if err != nil {
+		errorMessage := err.Error()
 
 		respondWithError(w, http.StatusBadRequest, errorMessage)
 		return
 	}
 
-	user := User{
-		ID:          dbUser.ID,
-		CreatedAt:   dbUser.CreatedAt,
-		UpdatedAt:   dbUser.UpdatedAt,
-		Email:       dbUser.Email,
-		IsChirpyRed: dbUser.IsChirpyRed,
+	respondwithJSON(w, http.StatusNoContent, nil)
+}
+
+// polkaEventID is the key deliveries are deduplicated on: the event's id,
+// the X-Polka-Event-ID header, or failing both a hash of the body.
+func polkaEventID(headers http.Header, event polkaEvent, body []byte) string {
+	if event.ID != "" {
+		return event.ID
+	}
+
+	if id := headers.Get("X-Polka-Event-ID"); id != "" {
+		return id
+	}
+
+	sum := sha256.Sum256(body)
+	return bodyHashEventIDPrefix + hex.EncodeToString(sum[:])
+}
+
+// polkaBodyDedupWindow is how long a body hash identifies an event: the
+// signature tolerance, since a signed retry can't be older than that.
+func (apiCfg *apiConfig) polkaBodyDedupWindow() time.Duration {
+	if apiCfg.polkaVerifier.Tolerance > 0 {
+		return apiCfg.polkaVerifier.Tolerance
+	}
+
+	return auth.DefaultWebhookTolerance
+}
+
+// storeWebhookEvent records a delivery, or returns the stored event if this
+// is a retry of one already seen.
+func (apiCfg *apiConfig) storeWebhookEvent(ctx context.Context, source, eventID, eventType string, body []byte) (database.WebhookEvent, error) {
+	createWebhookEventParams := database.CreateWebhookEventParams{
+		Source:    source,
+		EventID:   eventID,
+		EventType: eventType,
+		Payload:   string(body),
+	}
+
+	webhookEvent, err := apiCfg.dbQueries.CreateWebhookEvent(ctx, createWebhookEventParams)
+	if !errors.Is(err, sql.ErrNoRows) {
+		return webhookEvent, err
+	}
+
+	getWebhookEventBySourceIDParams := database.GetWebhookEventBySourceIDParams{
+		Source:  source,
+		EventID: eventID,
+	}
+
+	return apiCfg.dbQueries.GetWebhookEventBySourceID(ctx, getWebhookEventBySourceIDParams)
+}
+
+// processWebhookEvent applies a stored event and records the outcome. It is
+// used both for new deliveries and for admin replays. The event is claimed
+// first, so a retry arriving while the first delivery is still being
+// applied gets errWebhookInProgress instead of applying it twice. A claim
+// left behind by a crash can be taken over after five minutes.
+func (apiCfg *apiConfig) processWebhookEvent(ctx context.Context, webhookEvent database.WebhookEvent) (database.WebhookEvent, error) {
+	claimedEvent, err := apiCfg.dbQueries.ClaimWebhookEvent(ctx, webhookEvent.ID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return webhookEvent, errWebhookInProgress
+	} else if err != nil {
+		return webhookEvent, err
+	}
+	webhookEvent = claimedEvent
+
+	var handled bool
+	var processErr error
+
+	switch webhookEvent.Source {
+	case webhookSourcePolka:
+		handled, processErr = apiCfg.applyPolkaEvent(ctx, webhookEvent)
+	default:
+		processErr = errors.New("unknown webhook source " + webhookEvent.Source)
+	}
+
+	setWebhookEventResultParams := database.SetWebhookEventResultParams{
+		ID:     webhookEvent.ID,
+		Status: webhookStatusProcessed,
+	}
+
+	if processErr != nil {
+		setWebhookEventResultParams.Status = webhookStatusFailed
+		setWebhookEventResultParams.Error = sql.NullString{String: processErr.Error(), Valid: true}
+	} else if !handled {
+		setWebhookEventResultParams.Status = webhookStatusIgnored
+	}
+
+	updatedEvent, err := apiCfg.dbQueries.SetWebhookEventResult(ctx, setWebhookEventResultParams)
+	if err != nil {
+		return webhookEvent, errors.Join(processErr, err)
+	}
+
+	return updatedEvent, processErr
+}
+
+// applyPolkaEvent reports whether the event type is one Chirpy acts on.
+// The subscription change, the derived is_chirpy_red flag and the audit
+// entry are written in one transaction, with the subscription row locked
+// so concurrent deliveries for the same user apply one after the other.
+// Events older than the last one applied are ignored.
+func (apiCfg *apiConfig) applyPolkaEvent(ctx context.Context, webhookEvent database.WebhookEvent) (bool, error) {
+	var event polkaEvent
+
+	if err := json.Unmarshal([]byte(webhookEvent.Payload), &event); err != nil {
+		return false, err
+	}
+
+	switch event.Event {
+	case billing.EventUpgraded, billing.EventDowngraded, billing.EventRenewed, billing.EventPaymentFailed:
+	default:
+		return false, nil
+	}
+
+	tx, err := apiCfg.db.BeginTx(ctx, nil)
+	if err != nil {
+		return true, err
+	}
+	defer tx.Rollback()
+
+	qtx := apiCfg.dbQueries.WithTx(tx)
+
+	if _, err := qtx.GetUserFromID(ctx, event.Data.UserID); errors.Is(err, sql.ErrNoRows) {
+		return true, errWebhookUserNotFound
+	} else if err != nil {
+		return true, err
+	}
+
+	var current *billing.Subscription
+
+	dbSubscription, err := qtx.GetSubscriptionForUserForUpdate(ctx, event.Data.UserID)
+	if err == nil {
+		sub := billing.FromDatabase(dbSubscription)
+		current = &sub
+	} else if !errors.Is(err, sql.ErrNoRows) {
+		return true, err
+	}
+
+	// Postgres keeps timestamps to the microsecond, so compare at that
+	// precision or an event could look newer than itself once stored.
+	billingEvent := billing.Event{
+		Type:       event.Event,
+		Plan:       event.Data.Plan,
+		PeriodEnd:  event.Data.CurrentPeriodEnd,
+		OccurredAt: event.CreatedAt.Truncate(time.Microsecond),
+	}
+
+	sub, err := apiCfg.billingPolicy.Apply(current, billingEvent, time.Now())
+	if errors.Is(err, billing.ErrNoSubscription) || errors.Is(err, billing.ErrStaleEvent) {
+		// Nothing to downgrade or mark past due, or a newer event has
+		// already been applied.
+		return false, nil
+	} else if err != nil {
+		return true, err
+	}
+
+	change := billing.Change{
+		UserID: event.Data.UserID,
+		Source: billing.SourcePolka,
+		Action: event.Event,
+		Detail: "webhook event " + webhookEvent.EventID,
+		Before: current,
+		After:  sub,
+	}
+
+	if err := billing.Save(ctx, qtx, change); err != nil {
+		return true, err
+	}
+
+	return true, tx.Commit()
+}
+
+func (apiCfg *apiConfig) authenticatePolkaWebhook(headers http.Header, body []byte) error {
+	if apiCfg.polkaVerifier.Enabled() {
+		return apiCfg.polkaVerifier.Verify(headers, body, time.Now())
+	}
+
+	apiKey, err := auth.GetAPIKey(headers)
+	if err != nil {
+		return err
+	}
+
+	if apiCfg.polkaKey == "" || subtle.ConstantTimeCompare([]byte(apiKey), []byte(apiCfg.polkaKey)) != 1 {
+		return errors.New("incorrect API Key")
 	}
 
-	respondwithJSON(w, http.StatusNoContent, user)
+	return nil
 }
@@ -0,0 +1,229 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/Cmolloy36/Chirpy/internal/auth"
+	"github.com/Cmolloy36/Chirpy/internal/billing"
+	"github.com/Cmolloy36/Chirpy/internal/database"
+	"github.com/Cmolloy36/Chirpy/internal/polkasim"
+	"github.com/Cmolloy36/Chirpy/internal/polkasim/polkasimtest"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+const testPolkaSecret = "test-polka-secret"
+
+// newPolkaWebhookServer serves handlerPostPolkaWebhook against the
+// database at TEST_DB_URL, which must already be migrated. The test is
+// skipped when TEST_DB_URL isn't set.
+func newPolkaWebhookServer(t *testing.T) (*apiConfig, string) {
+	t.Helper()
+
+	dbURL := os.Getenv("TEST_DB_URL")
+	if dbURL == "" {
+		t.Skip("TEST_DB_URL is not set")
+	}
+
+	db, err := sql.Open("postgres", dbURL)
+	if err != nil {
+		t.Fatalf("error opening test database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	apiCfg := &apiConfig{
+		db:            db,
+		dbQueries:     database.New(db),
+		polkaVerifier: auth.WebhookVerifier{Secrets: []string{testPolkaSecret}, Tolerance: auth.DefaultWebhookTolerance},
+		billingPolicy: billing.DefaultPolicy(),
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(apiCfg.handlerPostPolkaWebhook))
+	t.Cleanup(server.Close)
+
+	return apiCfg, server.URL
+}
+
+func createWebhookTestUser(t *testing.T, apiCfg *apiConfig) uuid.UUID {
+	t.Helper()
+
+	createUserParams := database.CreateUserParams{
+		Email:          "polka-" + uuid.NewString() + "@example.com",
+		HashedPassword: "unused",
+	}
+
+	user, err := apiCfg.dbQueries.CreateUser(t.Context(), createUserParams)
+	if err != nil {
+		t.Fatalf("error creating user: %v", err)
+	}
+
+	t.Cleanup(func() {
+		apiCfg.db.Exec("DELETE FROM users WHERE id = $1", user.ID)
+	})
+
+	return user.ID
+}
+
+// assertAppliedOnce checks that every event was stored once, processed
+// once, and wrote at most one audit entry, however often it was delivered.
+func assertAppliedOnce(t *testing.T, apiCfg *apiConfig, userID uuid.UUID, events []polkasim.Event) {
+	t.Helper()
+
+	for _, event := range events {
+		getWebhookEventBySourceIDParams := database.GetWebhookEventBySourceIDParams{
+			Source:  webhookSourcePolka,
+			EventID: event.ID,
+		}
+
+		webhookEvent, err := apiCfg.dbQueries.GetWebhookEventBySourceID(t.Context(), getWebhookEventBySourceIDParams)
+		if err != nil {
+			t.Fatalf("event %s was not stored: %v", event.ID, err)
+		}
+
+		assert.Equal(t, int32(1), webhookEvent.Attempts, "event %s", event.ID)
+		assert.Contains(t, []string{webhookStatusProcessed, webhookStatusIgnored}, webhookEvent.Status, "event %s", event.ID)
+	}
+
+	entries, err := apiCfg.dbQueries.GetSubscriptionAuditEntriesForUser(t.Context(), userID)
+	if err != nil {
+		t.Fatalf("error reading audit log: %v", err)
+	}
+
+	seen := map[string]bool{}
+	for _, entry := range entries {
+		assert.False(t, seen[entry.Detail], "applied twice: %s", entry.Detail)
+		seen[entry.Detail] = true
+	}
+}
+
+func TestPolkaWebhookShuffledDowngrade(t *testing.T) {
+	apiCfg, url := newPolkaWebhookServer(t)
+	userID := createWebhookTestUser(t, apiCfg)
+
+	upgraded := polkasim.NewEvent(billing.EventUpgraded, userID)
+	polkasimtest.RequireDelivered(t, polkasimtest.NewSimulator(t, url, testPolkaSecret).Send(t.Context(), upgraded))
+
+	// The downgrade is the newest event, so it wins whatever order the
+	// rest arrive in.
+	events := []polkasim.Event{
+		polkasim.NewEvent(billing.EventPaymentFailed, userID),
+		polkasim.NewEvent(billing.EventRenewed, userID),
+		polkasim.NewEvent(billing.EventDowngraded, userID),
+	}
+
+	simulator := polkasimtest.NewSimulator(t, url, testPolkaSecret, func(config *polkasim.Config) {
+		config.DuplicateRate = 1
+		config.OutOfOrder = true
+	})
+
+	attempts := simulator.Send(t.Context(), events...)
+	polkasimtest.RequireDelivered(t, attempts)
+	assert.Len(t, attempts, 2*len(events))
+
+	assertAppliedOnce(t, apiCfg, userID, append(events, upgraded))
+
+	dbSubscription, err := apiCfg.dbQueries.GetSubscriptionForUser(t.Context(), userID)
+	if err != nil {
+		t.Fatalf("error reading subscription: %v", err)
+	}
+	assert.Equal(t, billing.StatusCanceled, dbSubscription.Status)
+	assert.True(t, dbSubscription.LastEventAt.Time.Equal(events[2].CreatedAt))
+
+	user, err := apiCfg.dbQueries.GetUserFromID(t.Context(), userID)
+	if err != nil {
+		t.Fatalf("error reading user: %v", err)
+	}
+	assert.False(t, user.IsChirpyRed)
+}
+
+func TestPolkaWebhookShuffledRenewals(t *testing.T) {
+	apiCfg, url := newPolkaWebhookServer(t)
+	userID := createWebhookTestUser(t, apiCfg)
+
+	start := time.Now().UTC().Truncate(time.Second)
+
+	upgraded := polkasim.NewEvent(billing.EventUpgraded, userID)
+	firstEnd := start.Add(billing.DefaultPeriod)
+	upgraded.Data.CurrentPeriodEnd = &firstEnd
+	polkasimtest.RequireDelivered(t, polkasimtest.NewSimulator(t, url, testPolkaSecret).Send(t.Context(), upgraded))
+
+	var events []polkasim.Event
+	var lastEnd time.Time
+	for i := 2; i <= 4; i++ {
+		event := polkasim.NewEvent(billing.EventRenewed, userID)
+		lastEnd = start.Add(time.Duration(i) * billing.DefaultPeriod)
+		event.Data.CurrentPeriodEnd = &lastEnd
+		events = append(events, event)
+	}
+
+	simulator := polkasimtest.NewSimulator(t, url, testPolkaSecret, func(config *polkasim.Config) {
+		config.DuplicateRate = 0.5
+		config.OutOfOrder = true
+	})
+
+	polkasimtest.RequireDelivered(t, simulator.Send(t.Context(), events...))
+
+	assertAppliedOnce(t, apiCfg, userID, append(events, upgraded))
+
+	dbSubscription, err := apiCfg.dbQueries.GetSubscriptionForUser(t.Context(), userID)
+	if err != nil {
+		t.Fatalf("error reading subscription: %v", err)
+	}
+	assert.Equal(t, billing.StatusActive, dbSubscription.Status)
+	assert.True(t, dbSubscription.CurrentPeriodEnd.Equal(lastEnd), "period ends %s, want %s", dbSubscription.CurrentPeriodEnd, lastEnd)
+
+	user, err := apiCfg.dbQueries.GetUserFromID(t.Context(), userID)
+	if err != nil {
+		t.Fatalf("error reading user: %v", err)
+	}
+	assert.True(t, user.IsChirpyRed)
+}
+
+func TestPolkaWebhookBodyHashRetryWindow(t *testing.T) {
+	apiCfg, url := newPolkaWebhookServer(t)
+	userID := createWebhookTestUser(t, apiCfg)
+
+	// Without an ID the event is deduplicated on a hash of its body.
+	upgraded := polkasim.NewEvent(billing.EventUpgraded, userID)
+	upgraded.ID = ""
+
+	body, err := json.Marshal(upgraded)
+	if err != nil {
+		t.Fatalf("error encoding event: %v", err)
+	}
+	eventID := polkaEventID(http.Header{}, polkaEvent{}, body)
+
+	countEvents := func() int {
+		var count int
+		err := apiCfg.db.QueryRow(
+			"SELECT COUNT(*) FROM webhook_events WHERE source = $1 AND event_id LIKE $2 || '%'",
+			webhookSourcePolka, eventID,
+		).Scan(&count)
+		if err != nil {
+			t.Fatalf("error counting events: %v", err)
+		}
+		return count
+	}
+
+	simulator := polkasimtest.NewSimulator(t, url, testPolkaSecret)
+	polkasimtest.RequireDelivered(t, simulator.Send(t.Context(), upgraded))
+	polkasimtest.RequireDelivered(t, simulator.Send(t.Context(), upgraded))
+	assert.Equal(t, 1, countEvents(), "a retry within the window is the same event")
+
+	_, err = apiCfg.db.Exec(
+		"UPDATE webhook_events SET created_at = created_at - INTERVAL '1 hour' WHERE source = $1 AND event_id = $2",
+		webhookSourcePolka, eventID,
+	)
+	if err != nil {
+		t.Fatalf("error ageing event: %v", err)
+	}
+
+	polkasimtest.RequireDelivered(t, simulator.Send(t.Context(), upgraded))
+	assert.Equal(t, 2, countEvents(), "the same body after the window is a new event")
+}
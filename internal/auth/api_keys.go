@@ -0,0 +1,41 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strings"
+)
+
+// APIKeyPrefix starts every personal API key, so leaked keys are easy to
+// spot in logs and by secret scanners.
+const APIKeyPrefix = "chirpy_"
+
+// MakeAPIKey returns a new personal API key. Keys are long and random, so a
+// plain SHA-256 is enough to store them; see HashAPIKey.
+func MakeAPIKey() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return APIKeyPrefix + hex.EncodeToString(b), nil
+}
+
+func HashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// APIKeyDisplayPrefix is the part of a key that is safe to show again after
+// creation, to help users tell their keys apart.
+func APIKeyDisplayPrefix(key string) string {
+	return key[:min(len(key), len(APIKeyPrefix)+8)]
+}
+
+// HasAPIKey reports whether the request authenticates with
+// "Authorization: ApiKey ..." rather than a bearer token.
+func HasAPIKey(headers http.Header) bool {
+	return strings.HasPrefix(headers.Get("Authorization"), "ApiKey ")
+}
@@ -19,20 +19,22 @@ var ErrTokenSigning = errors.New("error signing token")
 var ErrNoAuthHeader = errors.New("no authorization header provided")
 var ErrUnauthorized = errors.New("user not authorized")
 
+// HashPassword hashes password with argon2id using the current
+// SetPasswordHashParams parameters.
 func HashPassword(password string) (string, error) {
-	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	hash, err := hashArgon2id(password, passwordHashParams)
 	if err != nil {
 		return "", fmt.Errorf("unexpected error encountered when generating password hash: %w", err)
 	}
 
-	return string(hash), err
+	return hash, err
 }
 
+// CheckPasswordHash accepts both argon2id hashes and legacy bcrypt hashes.
 func CheckPasswordHash(hash, password string) error {
-	// hashedPassword, err := HashPassword(password)
-	// if err != nil {
-	// 	return fmt.Errorf("error hashing password")
-	// }
+	if strings.HasPrefix(hash, argon2idPrefix) {
+		return checkArgon2id(hash, password)
+	}
 
 	if err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)); err != nil {
 		return ErrHashMismatch
@@ -41,20 +43,30 @@ func CheckPasswordHash(hash, password string) error {
 	return nil
 }
 
-func MakeJWT(userID uuid.UUID, tokenSecret string) (string, error) {
+func MakeJWT(userID uuid.UUID, tokenSecret, audience string, scopes []string, expiresIn time.Duration) (string, error) {
+	return MakeJWTForClient(userID, "", tokenSecret, audience, scopes, expiresIn)
+}
+
+// MakeJWTForClient is MakeJWT for a token issued to a third-party OAuth
+// client. clientID is recorded in the client_id claim; it is empty for
+// first-party tokens.
+func MakeJWTForClient(userID uuid.UUID, clientID, tokenSecret, audience string, scopes []string, expiresIn time.Duration) (string, error) {
 	currTime := time.Now()
 	currTimeJWT := jwt.NewNumericDate(currTime)
 
-	expiresIn := time.Duration(1) * time.Hour
-
 	expiresAt := currTime.Add(expiresIn)
 	expiresAtJWT := jwt.NewNumericDate(expiresAt)
 
-	claims := jwt.RegisteredClaims{
-		Issuer:    "chirpy",
-		IssuedAt:  currTimeJWT,
-		ExpiresAt: expiresAtJWT,
-		Subject:   userID.String(),
+	claims := Claims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    "chirpy",
+			IssuedAt:  currTimeJWT,
+			ExpiresAt: expiresAtJWT,
+			Subject:   userID.String(),
+			Audience:  jwt.ClaimStrings{audience},
+		},
+		Scope:    strings.Join(scopes, " "),
+		ClientID: clientID,
 	}
 
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
@@ -66,37 +78,38 @@ func MakeJWT(userID uuid.UUID, tokenSecret string) (string, error) {
 	return signedToken, nil
 }
 
-func ValidateJWT(tokenString, tokenSecret string) (uuid.UUID, error) {
-	claims := jwt.RegisteredClaims{}
+func ValidateJWT(tokenString, tokenSecret, audience string) (Claims, error) {
+	claims := Claims{}
 	token, err := jwt.ParseWithClaims(tokenString, &claims, func(token *jwt.Token) (interface{}, error) {
 		return []byte(tokenSecret), nil
-	})
+	}, jwt.WithAudience(audience), jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}))
 	if errors.Is(err, jwt.ErrTokenExpired) {
-		return uuid.Nil, jwt.ErrTokenExpired
+		return Claims{}, jwt.ErrTokenExpired
 	} else if err != nil {
-		return uuid.Nil, err
+		return Claims{}, err
 	}
 
 	if !token.Valid {
-		return uuid.Nil, fmt.Errorf("invalid token")
+		return Claims{}, fmt.Errorf("invalid token")
 	}
 
-	id, err := claims.GetSubject()
-	if err != nil {
-		return uuid.Nil, err
+	if _, err := claims.UserID(); err != nil {
+		return Claims{}, err
 	}
 
-	idUUID, err := uuid.Parse(id)
-	if err != nil {
-		return uuid.Nil, err
-	}
-
-	return idUUID, nil
+	return claims, nil
 }
 
+// GetBearerToken returns the token from "Authorization: Bearer ...". Without
+// an Authorization header it falls back to the browser session's access
+// token cookie.
 func GetBearerToken(headers http.Header) (string, error) {
 	authHeader := headers.Get("Authorization")
 	if authHeader == "" {
+		if token, ok := cookieValue(headers, AccessTokenCookie); ok {
+			return token, nil
+		}
+
 		return "", ErrNoAuthHeader
 	}
 
@@ -2,12 +2,19 @@ package auth
 
 import (
 	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
 	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/bcrypt"
 )
 
 func TestHashSuccess(t *testing.T) {
@@ -39,16 +46,21 @@ func TestMakeJWT(t *testing.T) {
 	userId := uuid.New()
 	tokenSecret := os.Getenv("TOKEN_SECRET")
 
-	signedToken, err := MakeJWT(userId, tokenSecret)
+	signedToken, err := MakeJWT(userId, tokenSecret, DefaultAudience, AllScopes, time.Hour)
 	if err != nil {
 		t.Fatalf("error signing token: %v", err)
 	}
 
-	userIdValidated, err := ValidateJWT(signedToken, tokenSecret)
+	claims, err := ValidateJWT(signedToken, tokenSecret, DefaultAudience)
 	if err != nil {
 		t.Fatalf("error validating token: %v", err)
 	}
 
+	userIdValidated, err := claims.UserID()
+	if err != nil {
+		t.Fatalf("error parsing subject: %v", err)
+	}
+
 	assert.Equal(t, userId, userIdValidated)
 
 }
@@ -57,17 +69,17 @@ func TestExpiredToken(t *testing.T) {
 	userId := uuid.New()
 	tokenSecret := os.Getenv("TOKEN_SECRET")
 
-	signedToken, err := MakeJWT(userId, tokenSecret)
+	signedToken, err := MakeJWT(userId, tokenSecret, DefaultAudience, AllScopes, -time.Minute)
 	if err != nil {
 		t.Fatalf("error signing token: %v", err)
 	}
 
-	userIdValidated, err := ValidateJWT(signedToken, tokenSecret)
+	claims, err := ValidateJWT(signedToken, tokenSecret, DefaultAudience)
 	if !errors.Is(err, jwt.ErrTokenExpired) {
 		t.Fatalf("token should be expired, but isn't")
 	}
 
-	assert.Equal(t, userIdValidated, uuid.Nil)
+	assert.Equal(t, claims, Claims{})
 }
 
 func TestInvalidSecret(t *testing.T) {
@@ -75,14 +87,14 @@ func TestInvalidSecret(t *testing.T) {
 	userId := uuid.New()
 	correctSecret := "correct-secret"
 
-	signedToken, err := MakeJWT(userId, correctSecret)
+	signedToken, err := MakeJWT(userId, correctSecret, DefaultAudience, AllScopes, time.Hour)
 	if err != nil {
 		t.Fatalf("error signing token: %v", err)
 	}
 
 	// Try to validate with a different secret
 	invalidTokenSecret := os.Getenv("INVALID_TOKEN_SECRET")
-	_, err = ValidateJWT(signedToken, invalidTokenSecret)
+	_, err = ValidateJWT(signedToken, invalidTokenSecret, DefaultAudience)
 
 	// Assert that there was an error
 	assert.Error(t, err)
@@ -92,17 +104,408 @@ func TestInvalidSecret2(t *testing.T) {
 	userId := uuid.New()
 	tokenSecret := "right_secret"
 
-	signedToken, err := MakeJWT(userId, tokenSecret)
+	signedToken, err := MakeJWT(userId, tokenSecret, DefaultAudience, AllScopes, time.Hour)
 	if err != nil {
 		t.Fatalf("error signing token: %v", err)
 	}
 
 	invalidTokenSecret := "wrong_secret"
-	_, err = ValidateJWT(signedToken, invalidTokenSecret)
+	_, err = ValidateJWT(signedToken, invalidTokenSecret, DefaultAudience)
 
 	assert.Error(t, err)
 }
 
+func TestWrongAudience(t *testing.T) {
+	userId := uuid.New()
+	tokenSecret := "right_secret"
+
+	signedToken, err := MakeJWT(userId, tokenSecret, "some-other-api", AllScopes, time.Hour)
+	if err != nil {
+		t.Fatalf("error signing token: %v", err)
+	}
+
+	_, err = ValidateJWT(signedToken, tokenSecret, DefaultAudience)
+
+	assert.Error(t, err)
+}
+
+func TestScopes(t *testing.T) {
+	userId := uuid.New()
+	tokenSecret := "right_secret"
+
+	signedToken, err := MakeJWT(userId, tokenSecret, DefaultAudience, []string{ScopeChirpsRead}, time.Hour)
+	if err != nil {
+		t.Fatalf("error signing token: %v", err)
+	}
+
+	claims, err := ValidateJWT(signedToken, tokenSecret, DefaultAudience)
+	if err != nil {
+		t.Fatalf("error validating token: %v", err)
+	}
+
+	assert.True(t, claims.HasScope(ScopeChirpsRead))
+	assert.False(t, claims.HasScope(ScopeChirpsWrite))
+	assert.NoError(t, claims.RequireScopes(ScopeChirpsRead))
+	assert.ErrorIs(t, claims.RequireScopes(ScopeChirpsRead, ScopeChirpsWrite), ErrInsufficientScope)
+	assert.True(t, claims.IsFirstParty())
+}
+
+func TestClientJWT(t *testing.T) {
+	userId := uuid.New()
+	tokenSecret := "right_secret"
+
+	signedToken, err := MakeJWTForClient(userId, "client-1", tokenSecret, DefaultAudience, []string{ScopeChirpsRead}, time.Hour)
+	if err != nil {
+		t.Fatalf("error signing token: %v", err)
+	}
+
+	claims, err := ValidateJWT(signedToken, tokenSecret, DefaultAudience)
+	if err != nil {
+		t.Fatalf("error validating token: %v", err)
+	}
+
+	assert.Equal(t, "client-1", claims.ClientID)
+	assert.False(t, claims.IsFirstParty())
+}
+
+func TestTokenPolicyAccessTTL(t *testing.T) {
+	policy := DefaultTokenPolicy()
+
+	assert.Equal(t, policy.AccessTTL, policy.AccessTTLFor(0))
+	assert.Equal(t, 30*time.Second, policy.AccessTTLFor(30))
+	assert.Equal(t, policy.MaxAccessTTL, policy.AccessTTLFor(99999))
+	assert.Equal(t, policy.RememberMeRefreshTTL, policy.RefreshTTLFor(true))
+	assert.Equal(t, policy.RefreshTTL, policy.RefreshTTLFor(false))
+}
+
+func TestTOTPCodeRFC6238(t *testing.T) {
+	// RFC 6238 appendix B, SHA1, truncated to 6 digits.
+	secret := "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+	code, err := TOTPCode(secret, TOTPStep(time.Unix(59, 0)))
+	if err != nil {
+		t.Fatalf("error generating code: %v", err)
+	}
+	assert.Equal(t, "287082", code)
+
+	code, err = TOTPCode(secret, TOTPStep(time.Unix(1111111109, 0)))
+	if err != nil {
+		t.Fatalf("error generating code: %v", err)
+	}
+	assert.Equal(t, "081804", code)
+}
+
+func TestValidateTOTP(t *testing.T) {
+	secret, err := GenerateTOTPSecret()
+	if err != nil {
+		t.Fatalf("error generating secret: %v", err)
+	}
+
+	now := time.Now()
+	code, err := TOTPCode(secret, TOTPStep(now.Add(-TOTPPeriod)))
+	if err != nil {
+		t.Fatalf("error generating code: %v", err)
+	}
+
+	step, err := ValidateTOTP(secret, code, now)
+	assert.NoError(t, err)
+	assert.Equal(t, TOTPStep(now)-1, step)
+
+	_, err = ValidateTOTP(secret, code, now.Add(5*TOTPPeriod))
+	assert.ErrorIs(t, err, ErrInvalidTOTPCode)
+}
+
+func TestRecoveryCodes(t *testing.T) {
+	codes, err := GenerateRecoveryCodes(RecoveryCodeCount)
+	if err != nil {
+		t.Fatalf("error generating recovery codes: %v", err)
+	}
+
+	assert.Len(t, codes, RecoveryCodeCount)
+	assert.Equal(t, codes[0], NormalizeRecoveryCode(" "+strings.ToUpper(strings.ReplaceAll(codes[0], "-", ""))))
+}
+
+func TestSignedToken(t *testing.T) {
+	id := uuid.New()
+	secret := "right_secret"
+
+	token := MakeSignedToken(id, PurposeVerifyEmail, time.Now().Add(time.Hour), secret)
+
+	parsedID, err := ParseSignedToken(token, PurposeVerifyEmail, secret)
+	assert.NoError(t, err)
+	assert.Equal(t, id, parsedID)
+
+	_, err = ParseSignedToken(token, PurposeResetPassword, secret)
+	assert.ErrorIs(t, err, ErrInvalidSignedToken)
+
+	_, err = ParseSignedToken(token, PurposeVerifyEmail, "wrong_secret")
+	assert.ErrorIs(t, err, ErrInvalidSignedToken)
+
+	_, err = ParseSignedToken("x"+token, PurposeVerifyEmail, secret)
+	assert.ErrorIs(t, err, ErrInvalidSignedToken)
+
+	expired := MakeSignedToken(id, PurposeVerifyEmail, time.Now().Add(-time.Minute), secret)
+	_, err = ParseSignedToken(expired, PurposeVerifyEmail, secret)
+	assert.ErrorIs(t, err, ErrInvalidSignedToken)
+}
+
+func TestThrottlePolicyDelay(t *testing.T) {
+	policy := ThrottlePolicy{
+		FreeAttempts: 3,
+		BaseDelay:    time.Second,
+		MaxDelay:     10 * time.Second,
+	}
+
+	assert.Equal(t, time.Duration(0), policy.Delay(2))
+	assert.Equal(t, time.Second, policy.Delay(3))
+	assert.Equal(t, 4*time.Second, policy.Delay(5))
+	assert.Equal(t, 10*time.Second, policy.Delay(50))
+}
+
+func TestThrottlePolicyBlockedUntil(t *testing.T) {
+	policy := AccountThrottlePolicy
+	now := time.Now()
+
+	assert.True(t, policy.BlockedUntil(0, time.Time{}, time.Time{}).IsZero())
+
+	blockedUntil := policy.BlockedUntil(policy.FreeAttempts+1, now, time.Time{})
+	assert.Equal(t, now.Add(2*policy.BaseDelay), blockedUntil)
+
+	lockedUntil := now.Add(policy.LockoutDuration)
+	assert.Equal(t, lockedUntil, policy.BlockedUntil(policy.LockoutThreshold, now, lockedUntil))
+
+	stale := now.Add(-2 * policy.DecayAfter)
+	assert.True(t, policy.BlockedUntil(policy.LockoutThreshold-1, stale, time.Time{}).IsZero())
+}
+
+func TestDummyPasswordHash(t *testing.T) {
+	assert.ErrorIs(t, CheckPasswordHash(DummyPasswordHash(), ""), ErrHashMismatch)
+	assert.Equal(t, DummyPasswordHash(), DummyPasswordHash())
+}
+
+func TestArgon2idHash(t *testing.T) {
+	hash, err := HashPassword("hello")
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(hash, "$argon2id$v=19$m=19456,t=2,p=1$"))
+	assert.NoError(t, CheckPasswordHash(hash, "hello"))
+	assert.ErrorIs(t, CheckPasswordHash(hash, "goodbye"), ErrHashMismatch)
+	assert.False(t, NeedsRehash(hash))
+
+	_, _, _, err = parseArgon2id("$argon2id$v=19$m=1,t=1$c2FsdA$a2V5")
+	assert.ErrorIs(t, err, ErrInvalidPasswordHash)
+}
+
+func TestLegacyBcryptHash(t *testing.T) {
+	legacy, err := bcrypt.GenerateFromPassword([]byte("hello"), bcrypt.MinCost)
+	assert.NoError(t, err)
+	assert.NoError(t, CheckPasswordHash(string(legacy), "hello"))
+	assert.ErrorIs(t, CheckPasswordHash(string(legacy), "goodbye"), ErrHashMismatch)
+	assert.True(t, NeedsRehash(string(legacy)))
+}
+
+func TestNeedsRehashAfterParamsChange(t *testing.T) {
+	hash, err := HashPassword("hello")
+	assert.NoError(t, err)
+
+	params := DefaultArgon2idParams()
+	params.Iterations = 3
+	SetPasswordHashParams(params)
+	defer SetPasswordHashParams(DefaultArgon2idParams())
+
+	assert.True(t, NeedsRehash(hash))
+	assert.NoError(t, CheckPasswordHash(hash, "hello"))
+}
+
+func TestArgon2idParamsFromEnv(t *testing.T) {
+	t.Setenv("ARGON2_MEMORY_KIB", "65536")
+	t.Setenv("ARGON2_PARALLELISM", "4")
+
+	params, err := Argon2idParamsFromEnv()
+	assert.NoError(t, err)
+	assert.Equal(t, uint32(65536), params.Memory)
+	assert.Equal(t, uint32(2), params.Iterations)
+	assert.Equal(t, uint8(4), params.Parallelism)
+
+	t.Setenv("ARGON2_ITERATIONS", "0")
+	_, err = Argon2idParamsFromEnv()
+	assert.Error(t, err)
+}
+
+func TestPasswordPolicy(t *testing.T) {
+	policy := DefaultPasswordPolicy()
+
+	assert.Empty(t, policy.Check("correct horse battery", "walt@example.com"))
+	assert.Len(t, policy.Check("", "walt@example.com"), 1)
+	assert.Len(t, policy.Check(strings.Repeat("a", 73), "walt@example.com"), 1)
+	assert.Equal(t, []string{"must not contain your email address"}, policy.Check("my-walt@example.com-pw", "walt@example.com"))
+	assert.Equal(t, []string{"must not contain your email address"}, policy.Check("hunter2-WALTER", "walter@example.com"))
+	assert.Empty(t, policy.Check("hunter2-ab-xyz", "ab@example.com"))
+}
+
+func TestBreachedPasswords(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "breached.txt")
+	corpus := "# sha1 of \"password\"\n5BAA61E4C9B93F3F0682250B6CF8331B7EE68FD8:9545824\n"
+	assert.NoError(t, os.WriteFile(path, []byte(corpus), 0o600))
+
+	breached, err := LoadBreachedPasswords(path)
+	assert.NoError(t, err)
+	assert.True(t, breached.Contains("password"))
+	assert.False(t, breached.Contains("correct horse battery"))
+	assert.Len(t, breached.Range("5baa6"), 1)
+
+	policy := DefaultPasswordPolicy()
+	policy.Breached = breached
+	assert.Len(t, policy.Check("password", "walt@example.com"), 1)
+
+	assert.NoError(t, os.WriteFile(path, []byte("not-a-hash\n"), 0o600))
+	_, err = LoadBreachedPasswords(path)
+	assert.Error(t, err)
+}
+
+func TestMagicLinkNonce(t *testing.T) {
+	nonce, err := MakeMagicLinkNonce()
+	assert.NoError(t, err)
+
+	other, err := MakeMagicLinkNonce()
+	assert.NoError(t, err)
+	assert.NotEqual(t, nonce, other)
+
+	assert.Equal(t, HashMagicLinkNonce(nonce), HashMagicLinkNonce(nonce))
+	assert.NotEqual(t, HashMagicLinkNonce(nonce), HashMagicLinkNonce(other))
+
+	assert.Equal(t, time.Duration(0), MagicLinkThrottlePolicy.Delay(2))
+	assert.Equal(t, time.Minute, MagicLinkThrottlePolicy.Delay(3))
+	assert.False(t, MagicLinkThrottlePolicy.ShouldLock(100))
+}
+
+func TestAPIKey(t *testing.T) {
+	key, err := MakeAPIKey()
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(key, APIKeyPrefix))
+	assert.Len(t, APIKeyDisplayPrefix(key), len(APIKeyPrefix)+8)
+
+	other, err := MakeAPIKey()
+	assert.NoError(t, err)
+	assert.NotEqual(t, HashAPIKey(key), HashAPIKey(other))
+
+	headers := http.Header{}
+	headers.Set("Authorization", "ApiKey "+key)
+	assert.True(t, HasAPIKey(headers))
+
+	got, err := GetAPIKey(headers)
+	assert.NoError(t, err)
+	assert.Equal(t, key, got)
+
+	headers.Set("Authorization", "Bearer "+key)
+	assert.False(t, HasAPIKey(headers))
+}
+
+func TestInviteCode(t *testing.T) {
+	code, err := MakeInviteCode()
+	assert.NoError(t, err)
+	assert.Len(t, code, 19)
+	assert.Equal(t, code[:4], InviteCodeDisplayPrefix(code))
+
+	typed := " " + strings.ToUpper(strings.ReplaceAll(code, "-", "")) + " "
+	assert.Equal(t, HashInviteCode(code), HashInviteCode(typed))
+
+	other, err := MakeInviteCode()
+	assert.NoError(t, err)
+	assert.NotEqual(t, HashInviteCode(code), HashInviteCode(other))
+}
+
 func TestGetAuthHeader(t *testing.T) {
 
 }
+
+func TestSessionCookies(t *testing.T) {
+	r := httptest.NewRequest("POST", "/api/chirps", nil)
+	r.AddCookie(&http.Cookie{Name: AccessTokenCookie, Value: "access"})
+	r.AddCookie(&http.Cookie{Name: RefreshTokenCookie, Value: "refresh"})
+
+	token, err := GetBearerToken(r.Header)
+	assert.NoError(t, err)
+	assert.Equal(t, "access", token)
+
+	token, err = GetRefreshToken(r.Header)
+	assert.NoError(t, err)
+	assert.Equal(t, "refresh", token)
+
+	// The cookie holds the CSRF token but a forged request can't read it to
+	// copy it into the header.
+	assert.ErrorIs(t, CheckCSRF(r), ErrCSRFTokenMismatch)
+
+	csrfToken, err := MakeCSRFToken()
+	assert.NoError(t, err)
+	r.AddCookie(&http.Cookie{Name: CSRFCookie, Value: csrfToken})
+	assert.ErrorIs(t, CheckCSRF(r), ErrCSRFTokenMismatch)
+
+	r.Header.Set(CSRFHeader, "wrong")
+	assert.ErrorIs(t, CheckCSRF(r), ErrCSRFTokenMismatch)
+
+	r.Header.Set(CSRFHeader, csrfToken)
+	assert.NoError(t, CheckCSRF(r))
+
+	r = httptest.NewRequest("GET", "/api/chirps", nil)
+	r.AddCookie(&http.Cookie{Name: AccessTokenCookie, Value: "access"})
+	assert.NoError(t, CheckCSRF(r))
+
+	// Header-based clients are unaffected, cookies or not.
+	r = httptest.NewRequest("POST", "/api/chirps", nil)
+	r.AddCookie(&http.Cookie{Name: AccessTokenCookie, Value: "access"})
+	r.Header.Set("Authorization", "Bearer header")
+	assert.NoError(t, CheckCSRF(r))
+
+	token, err = GetBearerToken(r.Header)
+	assert.NoError(t, err)
+	assert.Equal(t, "header", token)
+
+	_, err = GetRefreshToken(httptest.NewRequest("POST", "/api/refresh", nil).Header)
+	assert.ErrorIs(t, err, ErrNoAuthHeader)
+}
+
+func TestWebhookSignature(t *testing.T) {
+	body := []byte(`{"event":"user.upgraded","data":{"user_id":"3311741c-680c-4546-99f3-fc9efac2036c"}}`)
+	now := time.Now()
+
+	verifier := WebhookVerifier{Secrets: []string{"new-secret", "old-secret"}, Tolerance: DefaultWebhookTolerance}
+
+	headers := http.Header{}
+	headers.Set(WebhookTimestampHeader, fmt.Sprint(now.Unix()))
+	headers.Set(WebhookSignatureHeader, SignWebhook("old-secret", now.Unix(), body))
+	assert.NoError(t, verifier.Verify(headers, body, now))
+
+	// A sender mid-rotation may send several signatures.
+	headers.Set(WebhookSignatureHeader, SignWebhook("retired", now.Unix(), body)+", "+SignWebhook("new-secret", now.Unix(), body))
+	assert.NoError(t, verifier.Verify(headers, body, now))
+
+	tampered := append([]byte{}, body...)
+	tampered[len(tampered)-3] = 'd'
+	assert.ErrorIs(t, verifier.Verify(headers, tampered, now), ErrInvalidWebhookSignature)
+
+	headers.Set(WebhookSignatureHeader, SignWebhook("unknown", now.Unix(), body))
+	assert.ErrorIs(t, verifier.Verify(headers, body, now), ErrInvalidWebhookSignature)
+
+	old := now.Add(-10 * time.Minute)
+	headers.Set(WebhookTimestampHeader, fmt.Sprint(old.Unix()))
+	headers.Set(WebhookSignatureHeader, SignWebhook("new-secret", old.Unix(), body))
+	assert.ErrorIs(t, verifier.Verify(headers, body, now), ErrWebhookTimestamp)
+
+	headers.Del(WebhookSignatureHeader)
+	assert.ErrorIs(t, verifier.Verify(headers, body, now), ErrMissingWebhookSignature)
+}
+
+func TestWebhookVerifierFromEnv(t *testing.T) {
+	t.Setenv("POLKA_WEBHOOK_SECRETS", " a, ,b ")
+	t.Setenv("POLKA_WEBHOOK_TOLERANCE", "30s")
+
+	verifier, err := WebhookVerifierFromEnv()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"a", "b"}, verifier.Secrets)
+	assert.Equal(t, 30*time.Second, verifier.Tolerance)
+	assert.True(t, verifier.Enabled())
+
+	t.Setenv("POLKA_WEBHOOK_TOLERANCE", "soon")
+	_, err = WebhookVerifierFromEnv()
+	assert.Error(t, err)
+}
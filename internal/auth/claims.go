@@ -0,0 +1,72 @@
+package auth
+
+import (
+	"errors"
+	"slices"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+const (
+	ScopeChirpsRead   = "chirps:read"
+	ScopeChirpsWrite  = "chirps:write"
+	ScopeProfileWrite = "profile:write"
+	ScopeDMRead       = "dm:read"
+)
+
+// DefaultAudience is the aud claim for tokens meant for the Chirpy API itself.
+const DefaultAudience = "chirpy-api"
+
+// AllScopes is granted to first-party logins (password, refresh, etc.).
+var AllScopes = []string{ScopeChirpsRead, ScopeChirpsWrite, ScopeProfileWrite, ScopeDMRead}
+
+var ErrInsufficientScope = errors.New("token does not grant the required scope")
+
+// Claims are the claims carried by every access token Chirpy issues.
+// Scope is a space-delimited list, as in RFC 8693. ClientID names the OAuth
+// client the token was issued to and is empty for first-party tokens.
+// APIKeyID is set instead when the request used a personal API key; it is
+// never part of a JWT.
+type Claims struct {
+	jwt.RegisteredClaims
+	Scope    string `json:"scope,omitempty"`
+	ClientID string `json:"client_id,omitempty"`
+	APIKeyID string `json:"-"`
+}
+
+func (c Claims) UserID() (uuid.UUID, error) {
+	return uuid.Parse(c.Subject)
+}
+
+func (c Claims) IsFirstParty() bool {
+	return c.ClientID == ""
+}
+
+func (c Claims) IsAPIKey() bool {
+	return c.APIKeyID != ""
+}
+
+func (c Claims) Scopes() []string {
+	return strings.Fields(c.Scope)
+}
+
+func (c Claims) HasScope(scope string) bool {
+	return slices.Contains(c.Scopes(), scope)
+}
+
+// RequireScopes returns ErrInsufficientScope unless every scope is granted.
+func (c Claims) RequireScopes(scopes ...string) error {
+	for _, scope := range scopes {
+		if !c.HasScope(scope) {
+			return ErrInsufficientScope
+		}
+	}
+
+	return nil
+}
+
+func IsValidScope(scope string) bool {
+	return slices.Contains(AllScopes, scope)
+}
@@ -0,0 +1,41 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+)
+
+// MakeInviteCode returns a random invite code formatted as
+// xxxx-xxxx-xxxx-xxxx, short enough to read out or type by hand.
+func MakeInviteCode() (string, error) {
+	b := make([]byte, 10)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	raw := strings.ToLower(totpEncoding.EncodeToString(b))
+	return raw[:4] + "-" + raw[4:8] + "-" + raw[8:12] + "-" + raw[12:16], nil
+}
+
+// NormalizeInviteCode undoes what people tend to do to a code when they
+// copy it: change its case, drop the dashes or add spaces.
+func NormalizeInviteCode(code string) string {
+	code = strings.ToLower(strings.TrimSpace(code))
+	code = strings.ReplaceAll(code, "-", "")
+	return strings.ReplaceAll(code, " ", "")
+}
+
+// HashInviteCode is what Chirpy stores instead of the code itself.
+func HashInviteCode(code string) string {
+	sum := sha256.Sum256([]byte(NormalizeInviteCode(code)))
+	return hex.EncodeToString(sum[:])
+}
+
+// InviteCodeDisplayPrefix is the part of a code that is safe to show again
+// after creation.
+func InviteCodeDisplayPrefix(code string) string {
+	code = NormalizeInviteCode(code)
+	return code[:min(len(code), 4)]
+}
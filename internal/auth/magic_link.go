@@ -0,0 +1,40 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"time"
+)
+
+const (
+	PurposeMagicLogin = "magic_login"
+	MagicLinkTTL      = 15 * time.Minute
+)
+
+// MagicLinkThrottlePolicy limits how often a login link can be emailed to
+// one address. Every request counts, successful or not.
+var MagicLinkThrottlePolicy = ThrottlePolicy{
+	FreeAttempts: 3,
+	BaseDelay:    time.Minute,
+	MaxDelay:     15 * time.Minute,
+	DecayAfter:   time.Hour,
+}
+
+// MakeMagicLinkNonce returns a random value that stays with the browser that
+// asked for a login link. Only its hash is stored, and the link can only be
+// redeemed together with the nonce.
+func MakeMagicLinkNonce() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func HashMagicLinkNonce(nonce string) string {
+	sum := sha256.Sum256([]byte(nonce))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,170 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+)
+
+// Password hashes are stored in the PHC string format, so the algorithm and
+// its parameters travel with each hash:
+//
+//	$argon2id$v=19$m=19456,t=2,p=1$<salt>$<key>
+//
+// Hashes created before argon2id was introduced are plain bcrypt strings
+// ("$2a$...") and are still accepted by CheckPasswordHash.
+const argon2idPrefix = "$argon2id$"
+
+var ErrInvalidPasswordHash = errors.New("invalid password hash")
+
+// Argon2idParams are the cost parameters for new password hashes. Memory is
+// in KiB.
+type Argon2idParams struct {
+	Memory      uint32
+	Iterations  uint32
+	Parallelism uint8
+	SaltLength  uint32
+	KeyLength   uint32
+}
+
+// DefaultArgon2idParams follows the OWASP minimum recommendation for argon2id.
+func DefaultArgon2idParams() Argon2idParams {
+	return Argon2idParams{
+		Memory:      19 * 1024,
+		Iterations:  2,
+		Parallelism: 1,
+		SaltLength:  16,
+		KeyLength:   32,
+	}
+}
+
+var passwordHashParams = DefaultArgon2idParams()
+
+// SetPasswordHashParams changes the parameters used by HashPassword. It is
+// meant to be called once at startup, before any requests are served.
+func SetPasswordHashParams(params Argon2idParams) {
+	passwordHashParams = params
+}
+
+// Argon2idParamsFromEnv starts from DefaultArgon2idParams and overrides the
+// cost parameters set in ARGON2_MEMORY_KIB, ARGON2_ITERATIONS and
+// ARGON2_PARALLELISM.
+func Argon2idParamsFromEnv() (Argon2idParams, error) {
+	params := DefaultArgon2idParams()
+
+	envParams := []struct {
+		name    string
+		bitSize int
+		set     func(uint64)
+	}{
+		{"ARGON2_MEMORY_KIB", 32, func(v uint64) { params.Memory = uint32(v) }},
+		{"ARGON2_ITERATIONS", 32, func(v uint64) { params.Iterations = uint32(v) }},
+		{"ARGON2_PARALLELISM", 8, func(v uint64) { params.Parallelism = uint8(v) }},
+	}
+
+	for _, envParam := range envParams {
+		val := os.Getenv(envParam.name)
+		if val == "" {
+			continue
+		}
+
+		v, err := strconv.ParseUint(val, 10, envParam.bitSize)
+		if err != nil || v == 0 {
+			return Argon2idParams{}, fmt.Errorf("invalid %s %q: must be a positive integer", envParam.name, val)
+		}
+
+		envParam.set(v)
+	}
+
+	if params.Memory < 8*uint32(params.Parallelism) {
+		return Argon2idParams{}, fmt.Errorf("ARGON2_MEMORY_KIB %d must be at least 8 times ARGON2_PARALLELISM %d", params.Memory, params.Parallelism)
+	}
+
+	return params, nil
+}
+
+func hashArgon2id(password string, params Argon2idParams) (string, error) {
+	salt := make([]byte, params.SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+
+	key := argon2.IDKey([]byte(password), salt, params.Iterations, params.Memory, params.Parallelism, params.KeyLength)
+
+	return fmt.Sprintf("%sv=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2idPrefix, argon2.Version, params.Memory, params.Iterations, params.Parallelism,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	), nil
+}
+
+// parseArgon2id splits a PHC argon2id string into its parameters, salt and
+// derived key.
+func parseArgon2id(hash string) (Argon2idParams, []byte, []byte, error) {
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return Argon2idParams{}, nil, nil, ErrInvalidPasswordHash
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return Argon2idParams{}, nil, nil, ErrInvalidPasswordHash
+	}
+
+	var params Argon2idParams
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.Memory, &params.Iterations, &params.Parallelism); err != nil {
+		return Argon2idParams{}, nil, nil, ErrInvalidPasswordHash
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return Argon2idParams{}, nil, nil, ErrInvalidPasswordHash
+	}
+
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil {
+		return Argon2idParams{}, nil, nil, ErrInvalidPasswordHash
+	}
+
+	params.SaltLength = uint32(len(salt))
+	params.KeyLength = uint32(len(key))
+
+	return params, salt, key, nil
+}
+
+func checkArgon2id(hash, password string) error {
+	params, salt, key, err := parseArgon2id(hash)
+	if err != nil {
+		return err
+	}
+
+	otherKey := argon2.IDKey([]byte(password), salt, params.Iterations, params.Memory, params.Parallelism, params.KeyLength)
+	if subtle.ConstantTimeCompare(key, otherKey) != 1 {
+		return ErrHashMismatch
+	}
+
+	return nil
+}
+
+// NeedsRehash reports whether hash was made with a legacy algorithm or with
+// parameters other than the current ones. Callers can re-hash the password
+// after it has been checked successfully.
+func NeedsRehash(hash string) bool {
+	if !strings.HasPrefix(hash, argon2idPrefix) {
+		return true
+	}
+
+	params, _, _, err := parseArgon2id(hash)
+	if err != nil {
+		return true
+	}
+
+	return params != passwordHashParams
+}
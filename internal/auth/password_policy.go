@@ -0,0 +1,190 @@
+package auth
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	DefaultPasswordMinLength = 8
+	// bcrypt ignores everything after 72 bytes, and legacy hashes are still
+	// bcrypt, so longer passwords would silently lose their tail.
+	DefaultPasswordMaxLength = 72
+)
+
+// PasswordPolicy decides which new passwords are acceptable. MinLength
+// counts characters; MaxLength counts bytes.
+type PasswordPolicy struct {
+	MinLength int
+	MaxLength int
+	Breached  *BreachedPasswords
+}
+
+func DefaultPasswordPolicy() PasswordPolicy {
+	return PasswordPolicy{
+		MinLength: DefaultPasswordMinLength,
+		MaxLength: DefaultPasswordMaxLength,
+	}
+}
+
+// PasswordPolicyFromEnv starts from DefaultPasswordPolicy and applies
+// PASSWORD_MIN_LENGTH, PASSWORD_MAX_LENGTH and BREACHED_PASSWORDS_FILE.
+func PasswordPolicyFromEnv() (PasswordPolicy, error) {
+	policy := DefaultPasswordPolicy()
+
+	envLengths := []struct {
+		name   string
+		length *int
+	}{
+		{"PASSWORD_MIN_LENGTH", &policy.MinLength},
+		{"PASSWORD_MAX_LENGTH", &policy.MaxLength},
+	}
+
+	for _, envLength := range envLengths {
+		val := os.Getenv(envLength.name)
+		if val == "" {
+			continue
+		}
+
+		length, err := strconv.Atoi(val)
+		if err != nil || length <= 0 {
+			return PasswordPolicy{}, fmt.Errorf("invalid %s %q: must be a positive integer", envLength.name, val)
+		}
+
+		*envLength.length = length
+	}
+
+	if policy.MinLength > policy.MaxLength {
+		return PasswordPolicy{}, fmt.Errorf("PASSWORD_MIN_LENGTH %d exceeds PASSWORD_MAX_LENGTH %d", policy.MinLength, policy.MaxLength)
+	}
+
+	if path := os.Getenv("BREACHED_PASSWORDS_FILE"); path != "" {
+		breached, err := LoadBreachedPasswords(path)
+		if err != nil {
+			return PasswordPolicy{}, err
+		}
+
+		policy.Breached = breached
+	}
+
+	return policy, nil
+}
+
+// Check returns every rule password breaks, as messages suitable for
+// showing next to the password field. An empty result means it is allowed.
+func (p PasswordPolicy) Check(password, email string) []string {
+	var problems []string
+
+	if utf8.RuneCountInString(password) < p.MinLength {
+		problems = append(problems, fmt.Sprintf("must be at least %d characters", p.MinLength))
+	}
+
+	if len(password) > p.MaxLength {
+		problems = append(problems, fmt.Sprintf("must be at most %d bytes", p.MaxLength))
+	}
+
+	if containsEmail(password, email) {
+		problems = append(problems, "must not contain your email address")
+	}
+
+	if p.Breached != nil && p.Breached.Contains(password) {
+		problems = append(problems, "has appeared in a data breach; choose a different password")
+	}
+
+	return problems
+}
+
+// containsEmail reports whether password contains the email address or, if
+// it is long enough to matter, the part before the @.
+func containsEmail(password, email string) bool {
+	email = strings.ToLower(strings.TrimSpace(email))
+	if email == "" {
+		return false
+	}
+
+	password = strings.ToLower(password)
+	if strings.Contains(password, email) {
+		return true
+	}
+
+	localPart, _, _ := strings.Cut(email, "@")
+
+	return len(localPart) >= 4 && strings.Contains(password, localPart)
+}
+
+// BreachedPasswords is a local corpus of SHA-1 password hashes in the
+// format of the Pwned Passwords downloads: one uppercase hex hash per line,
+// optionally followed by ":count". Hashes are bucketed by their first five
+// hex characters, the same way the k-anonymity range API splits them.
+type BreachedPasswords struct {
+	ranges map[string]map[string]struct{}
+}
+
+const breachedPrefixLength = 5
+
+func LoadBreachedPasswords(path string) (*BreachedPasswords, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("error opening breached password file: %w", err)
+	}
+	defer f.Close()
+
+	breached := &BreachedPasswords{ranges: map[string]map[string]struct{}{}}
+
+	scanner := bufio.NewScanner(f)
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		hash, _, _ := strings.Cut(line, ":")
+		hash = strings.ToUpper(hash)
+
+		if len(hash) != sha1.Size*2 {
+			return nil, fmt.Errorf("breached password file line %d: not a SHA-1 hash", lineNumber)
+		}
+		if _, err := hex.DecodeString(hash); err != nil {
+			return nil, fmt.Errorf("breached password file line %d: not a SHA-1 hash", lineNumber)
+		}
+
+		breached.add(hash)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading breached password file: %w", err)
+	}
+
+	return breached, nil
+}
+
+func (b *BreachedPasswords) add(hash string) {
+	prefix, suffix := hash[:breachedPrefixLength], hash[breachedPrefixLength:]
+
+	suffixes, ok := b.ranges[prefix]
+	if !ok {
+		suffixes = map[string]struct{}{}
+		b.ranges[prefix] = suffixes
+	}
+
+	suffixes[suffix] = struct{}{}
+}
+
+// Range returns the hash suffixes stored under a five character prefix.
+func (b *BreachedPasswords) Range(prefix string) map[string]struct{} {
+	return b.ranges[strings.ToUpper(prefix)]
+}
+
+func (b *BreachedPasswords) Contains(password string) bool {
+	sum := sha1.Sum([]byte(password))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+
+	_, ok := b.Range(hash[:breachedPrefixLength])[hash[breachedPrefixLength:]]
+	return ok
+}
@@ -0,0 +1,91 @@
+package auth
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"sync"
+	"time"
+)
+
+// ThrottlePolicy describes how repeated failures against one key (an
+// account, an IP) slow down further attempts. The first FreeAttempts
+// failures cost nothing; after that each failure doubles the wait, up to
+// MaxDelay. Reaching LockoutThreshold locks the key for LockoutDuration.
+// Failures older than DecayAfter are forgotten.
+type ThrottlePolicy struct {
+	FreeAttempts     int
+	BaseDelay        time.Duration
+	MaxDelay         time.Duration
+	LockoutThreshold int
+	LockoutDuration  time.Duration
+	DecayAfter       time.Duration
+}
+
+var AccountThrottlePolicy = ThrottlePolicy{
+	FreeAttempts:     3,
+	BaseDelay:        time.Second,
+	MaxDelay:         5 * time.Minute,
+	LockoutThreshold: 10,
+	LockoutDuration:  15 * time.Minute,
+	DecayAfter:       time.Hour,
+}
+
+var IPThrottlePolicy = ThrottlePolicy{
+	FreeAttempts:     10,
+	BaseDelay:        time.Second,
+	MaxDelay:         time.Minute,
+	LockoutThreshold: 50,
+	LockoutDuration:  time.Hour,
+	DecayAfter:       time.Hour,
+}
+
+// Delay is how long to wait after the latest of failures failed attempts.
+func (p ThrottlePolicy) Delay(failures int) time.Duration {
+	if failures < p.FreeAttempts {
+		return 0
+	}
+
+	delay := p.BaseDelay
+	for i := p.FreeAttempts; i < failures && delay < p.MaxDelay; i++ {
+		delay *= 2
+	}
+
+	return min(delay, p.MaxDelay)
+}
+
+func (p ThrottlePolicy) ShouldLock(failures int) bool {
+	return p.LockoutThreshold > 0 && failures >= p.LockoutThreshold
+}
+
+// BlockedUntil returns when the next attempt is allowed given the stored
+// throttle state. A zero lastFailure means no failures are recorded.
+func (p ThrottlePolicy) BlockedUntil(failures int, lastFailure, lockedUntil time.Time) time.Time {
+	if lastFailure.IsZero() || time.Since(lastFailure) > p.DecayAfter {
+		return lockedUntil
+	}
+
+	next := lastFailure.Add(p.Delay(failures))
+	if lockedUntil.After(next) {
+		return lockedUntil
+	}
+
+	return next
+}
+
+var (
+	dummyHashOnce sync.Once
+	dummyHash     string
+)
+
+// DummyPasswordHash is a hash of a random password made with the same algorithm
+// and parameters as HashPassword. Checking against it when an account doesn't exist makes a
+// failed login take as long as a wrong password.
+func DummyPasswordHash() string {
+	dummyHashOnce.Do(func() {
+		b := make([]byte, 16)
+		rand.Read(b)
+		dummyHash, _ = HashPassword(hex.EncodeToString(b))
+	})
+
+	return dummyHash
+}
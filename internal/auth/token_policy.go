@@ -0,0 +1,90 @@
+package auth
+
+import (
+	"fmt"
+	"os"
+	"time"
+)
+
+const (
+	DefaultAccessTTL            = time.Hour
+	DefaultMaxAccessTTL         = time.Hour
+	DefaultRefreshTTL           = 60 * 24 * time.Hour
+	DefaultRememberMeRefreshTTL = 180 * 24 * time.Hour
+)
+
+// TokenPolicy decides how long issued access and refresh tokens live.
+type TokenPolicy struct {
+	AccessTTL            time.Duration
+	MaxAccessTTL         time.Duration
+	RefreshTTL           time.Duration
+	RememberMeRefreshTTL time.Duration
+}
+
+func DefaultTokenPolicy() TokenPolicy {
+	return TokenPolicy{
+		AccessTTL:            DefaultAccessTTL,
+		MaxAccessTTL:         DefaultMaxAccessTTL,
+		RefreshTTL:           DefaultRefreshTTL,
+		RememberMeRefreshTTL: DefaultRememberMeRefreshTTL,
+	}
+}
+
+// TokenPolicyFromEnv starts from DefaultTokenPolicy and overrides any TTL
+// set in the environment. Values use time.ParseDuration syntax, e.g. "15m".
+func TokenPolicyFromEnv() (TokenPolicy, error) {
+	policy := DefaultTokenPolicy()
+
+	envTTLs := []struct {
+		name string
+		ttl  *time.Duration
+	}{
+		{"ACCESS_TOKEN_TTL", &policy.AccessTTL},
+		{"ACCESS_TOKEN_MAX_TTL", &policy.MaxAccessTTL},
+		{"REFRESH_TOKEN_TTL", &policy.RefreshTTL},
+		{"REMEMBER_ME_REFRESH_TOKEN_TTL", &policy.RememberMeRefreshTTL},
+	}
+
+	for _, envTTL := range envTTLs {
+		val := os.Getenv(envTTL.name)
+		if val == "" {
+			continue
+		}
+
+		ttl, err := time.ParseDuration(val)
+		if err != nil || ttl <= 0 {
+			return TokenPolicy{}, fmt.Errorf("invalid %s %q: must be a positive duration", envTTL.name, val)
+		}
+
+		*envTTL.ttl = ttl
+	}
+
+	if policy.AccessTTL > policy.MaxAccessTTL {
+		return TokenPolicy{}, fmt.Errorf("ACCESS_TOKEN_TTL %s exceeds ACCESS_TOKEN_MAX_TTL %s", policy.AccessTTL, policy.MaxAccessTTL)
+	}
+
+	return policy, nil
+}
+
+// AccessTTLFor applies a per-request override in seconds. Zero or negative
+// means "use the default"; anything above MaxAccessTTL is clamped.
+func (p TokenPolicy) AccessTTLFor(requestedSeconds int) time.Duration {
+	if requestedSeconds <= 0 {
+		return p.AccessTTL
+	}
+
+	requested := time.Duration(requestedSeconds) * time.Second
+	if requested > p.MaxAccessTTL {
+		return p.MaxAccessTTL
+	}
+
+	return requested
+}
+
+func (p TokenPolicy) RefreshTTLFor(rememberMe bool) time.Duration {
+	if rememberMe {
+		return p.RememberMeRefreshTTL
+	}
+
+	return p.RefreshTTL
+}
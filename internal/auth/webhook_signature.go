@@ -0,0 +1,120 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	WebhookTimestampHeader  = "X-Polka-Timestamp"
+	WebhookSignatureHeader  = "X-Polka-Signature"
+	DefaultWebhookTolerance = 5 * time.Minute
+
+	webhookSignatureVersion = "v1="
+)
+
+var (
+	ErrMissingWebhookSignature = errors.New("missing webhook signature")
+	ErrWebhookTimestamp        = errors.New("webhook timestamp is missing or outside the tolerance window")
+	ErrInvalidWebhookSignature = errors.New("invalid webhook signature")
+)
+
+// WebhookVerifier checks HMAC-SHA256 signatures on incoming webhooks. The
+// sender signs "<timestamp>.<body>" and sends the result as
+// "X-Polka-Signature: v1=<hex>", with the Unix timestamp it used in
+// X-Polka-Timestamp. Any of Secrets may match, so a new secret can be added
+// before the sender switches to it and the old one removed afterwards.
+type WebhookVerifier struct {
+	Secrets   []string
+	Tolerance time.Duration
+}
+
+// WebhookVerifierFromEnv reads POLKA_WEBHOOK_SECRETS (comma-separated) and
+// POLKA_WEBHOOK_TOLERANCE. With no secrets the verifier is disabled.
+func WebhookVerifierFromEnv() (WebhookVerifier, error) {
+	verifier := WebhookVerifier{Tolerance: DefaultWebhookTolerance}
+
+	for _, secret := range strings.Split(os.Getenv("POLKA_WEBHOOK_SECRETS"), ",") {
+		if secret = strings.TrimSpace(secret); secret != "" {
+			verifier.Secrets = append(verifier.Secrets, secret)
+		}
+	}
+
+	if val := os.Getenv("POLKA_WEBHOOK_TOLERANCE"); val != "" {
+		tolerance, err := time.ParseDuration(val)
+		if err != nil || tolerance <= 0 {
+			return WebhookVerifier{}, fmt.Errorf("invalid POLKA_WEBHOOK_TOLERANCE %q: must be a positive duration", val)
+		}
+
+		verifier.Tolerance = tolerance
+	}
+
+	return verifier, nil
+}
+
+func (v WebhookVerifier) Enabled() bool {
+	return len(v.Secrets) > 0
+}
+
+// SignWebhook returns the X-Polka-Signature value for body sent at timestamp.
+func SignWebhook(secret string, timestamp int64, body []byte) string {
+	return webhookSignatureVersion + hex.EncodeToString(webhookMAC(secret, timestamp, body))
+}
+
+func webhookMAC(secret string, timestamp int64, body []byte) []byte {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%d.", timestamp)
+	mac.Write(body)
+
+	return mac.Sum(nil)
+}
+
+// Verify checks the signature headers against body. The signature header
+// may hold several comma-separated signatures, e.g. while the sender signs
+// with both an old and a new secret.
+func (v WebhookVerifier) Verify(headers http.Header, body []byte, now time.Time) error {
+	signatureHeader := headers.Get(WebhookSignatureHeader)
+	if signatureHeader == "" {
+		return ErrMissingWebhookSignature
+	}
+
+	timestamp, err := strconv.ParseInt(headers.Get(WebhookTimestampHeader), 10, 64)
+	if err != nil {
+		return ErrWebhookTimestamp
+	}
+
+	age := now.Sub(time.Unix(timestamp, 0))
+	if age > v.Tolerance || age < -v.Tolerance {
+		return ErrWebhookTimestamp
+	}
+
+	for _, secret := range v.Secrets {
+		expected := webhookMAC(secret, timestamp, body)
+
+		for _, signature := range strings.Split(signatureHeader, ",") {
+			hexSignature, ok := strings.CutPrefix(strings.TrimSpace(signature), webhookSignatureVersion)
+			if !ok {
+				continue
+			}
+
+			got, err := hex.DecodeString(hexSignature)
+			if err != nil {
+				continue
+			}
+
+			if hmac.Equal(got, expected) {
+				return nil
+			}
+		}
+	}
+
+	return ErrInvalidWebhookSignature
+}
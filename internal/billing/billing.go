@@ -0,0 +1,204 @@
+// Package billing models Chirpy Red subscriptions: how Polka events move a
+// subscription between states, and when a lapsed one stops granting access.
+package billing
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"time"
+)
+
+const PlanChirpyRed = "chirpy_red"
+
+const (
+	StatusActive   = "active"
+	StatusPastDue  = "past_due"
+	StatusCanceled = "canceled"
+	StatusExpired  = "expired"
+)
+
+const (
+	EventUpgraded      = "user.upgraded"
+	EventDowngraded    = "user.downgraded"
+	EventRenewed       = "subscription.renewed"
+	EventPaymentFailed = "payment.failed"
+)
+
+const (
+	DefaultPeriod      = 30 * 24 * time.Hour
+	DefaultGracePeriod = 3 * 24 * time.Hour
+)
+
+var (
+	ErrNoSubscription = errors.New("user has no subscription")
+	ErrUnknownEvent   = errors.New("unknown subscription event")
+	ErrStaleEvent     = errors.New("subscription event is older than the last one applied")
+)
+
+// Subscription is the billing state of one user.
+type Subscription struct {
+	Plan              string    `json:"plan"`
+	Status            string    `json:"status"`
+	CurrentPeriodEnd  time.Time `json:"current_period_end"`
+	GracePeriodEndsAt time.Time `json:"grace_period_ends_at"`
+	// LastEventAt is when the newest Polka event applied so far was sent,
+	// or zero if none carried a timestamp.
+	LastEventAt time.Time `json:"last_event_at,omitzero"`
+}
+
+// Event is a Polka event that changes a subscription. PeriodEnd is zero
+// when Polka didn't say when the new period ends, and OccurredAt is zero
+// when it didn't say when the event happened.
+type Event struct {
+	Type       string
+	Plan       string
+	PeriodEnd  time.Time
+	OccurredAt time.Time
+}
+
+// Policy decides how long a period lasts when Polka doesn't say, and how
+// long a subscription keeps its perks after it should have been paid for.
+type Policy struct {
+	Period      time.Duration
+	GracePeriod time.Duration
+}
+
+func DefaultPolicy() Policy {
+	return Policy{
+		Period:      DefaultPeriod,
+		GracePeriod: DefaultGracePeriod,
+	}
+}
+
+// PolicyFromEnv starts from DefaultPolicy and overrides SUBSCRIPTION_PERIOD
+// and SUBSCRIPTION_GRACE_PERIOD when set.
+func PolicyFromEnv() (Policy, error) {
+	policy := DefaultPolicy()
+
+	envDurations := []struct {
+		name     string
+		duration *time.Duration
+	}{
+		{"SUBSCRIPTION_PERIOD", &policy.Period},
+		{"SUBSCRIPTION_GRACE_PERIOD", &policy.GracePeriod},
+	}
+
+	for _, envDuration := range envDurations {
+		val := os.Getenv(envDuration.name)
+		if val == "" {
+			continue
+		}
+
+		duration, err := time.ParseDuration(val)
+		if err != nil || duration < 0 {
+			return Policy{}, fmt.Errorf("invalid %s %q: must be a non-negative duration", envDuration.name, val)
+		}
+
+		*envDuration.duration = duration
+	}
+
+	if policy.Period == 0 {
+		return Policy{}, errors.New("SUBSCRIPTION_PERIOD must be positive")
+	}
+
+	return policy, nil
+}
+
+// Apply returns the subscription after event. current is nil when the user
+// has never subscribed. Events that only make sense for an existing
+// subscription return ErrNoSubscription in that case, and events older
+// than what current already reflects return ErrStaleEvent.
+func (p Policy) Apply(current *Subscription, event Event, now time.Time) (Subscription, error) {
+	var sub Subscription
+	if current != nil {
+		sub = *current
+
+		if event.Stale(sub) {
+			return Subscription{}, ErrStaleEvent
+		}
+	}
+
+	if event.OccurredAt.After(sub.LastEventAt) {
+		sub.LastEventAt = event.OccurredAt
+	}
+
+	switch event.Type {
+	case EventUpgraded, EventRenewed:
+		periodEnd := event.PeriodEnd
+		if periodEnd.IsZero() {
+			// A renewal extends the current period; a fresh upgrade, or a
+			// renewal of one that already ran out, starts from now.
+			start := now
+			if event.Type == EventRenewed && sub.Status == StatusActive && sub.CurrentPeriodEnd.After(now) {
+				start = sub.CurrentPeriodEnd
+			}
+			periodEnd = start.Add(p.Period)
+		}
+
+		if event.Plan != "" {
+			sub.Plan = event.Plan
+		} else if sub.Plan == "" {
+			sub.Plan = PlanChirpyRed
+		}
+
+		sub.Status = StatusActive
+		sub.CurrentPeriodEnd = periodEnd
+		sub.GracePeriodEndsAt = periodEnd.Add(p.GracePeriod)
+	case EventPaymentFailed:
+		if current == nil {
+			return Subscription{}, ErrNoSubscription
+		}
+
+		// A failure on a subscription that is already past due doesn't
+		// extend its grace period.
+		if sub.Status != StatusActive {
+			return sub, nil
+		}
+
+		graceStart := sub.CurrentPeriodEnd
+		if now.After(graceStart) {
+			graceStart = now
+		}
+
+		sub.Status = StatusPastDue
+		sub.GracePeriodEndsAt = graceStart.Add(p.GracePeriod)
+	case EventDowngraded:
+		if current == nil {
+			return Subscription{}, ErrNoSubscription
+		}
+
+		sub.Status = StatusCanceled
+		sub.GracePeriodEndsAt = now
+	default:
+		return Subscription{}, ErrUnknownEvent
+	}
+
+	return sub, nil
+}
+
+// Stale reports whether sub already reflects something newer than event,
+// as happens when Polka delivers events out of order. Events are compared
+// by when they were sent; for events without a timestamp, an upgrade or
+// renewal that ends before the current period does is taken to be old.
+func (e Event) Stale(sub Subscription) bool {
+	if !e.OccurredAt.IsZero() && !sub.LastEventAt.IsZero() {
+		return !e.OccurredAt.After(sub.LastEventAt)
+	}
+
+	switch e.Type {
+	case EventUpgraded, EventRenewed:
+		return !e.PeriodEnd.IsZero() && e.PeriodEnd.Before(sub.CurrentPeriodEnd)
+	}
+
+	return false
+}
+
+// Entitled reports whether the subscription still grants its plan.
+func (s Subscription) Entitled(now time.Time) bool {
+	if s.Status != StatusActive && s.Status != StatusPastDue {
+		return false
+	}
+
+	return now.Before(s.GracePeriodEndsAt)
+}
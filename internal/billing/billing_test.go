@@ -0,0 +1,131 @@
+package billing
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUpgradeStartsPeriod(t *testing.T) {
+	policy := DefaultPolicy()
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	sub, err := policy.Apply(nil, Event{Type: EventUpgraded}, now)
+	if err != nil {
+		t.Fatalf("error applying upgrade: %v", err)
+	}
+
+	assert.Equal(t, PlanChirpyRed, sub.Plan)
+	assert.Equal(t, StatusActive, sub.Status)
+	assert.Equal(t, now.Add(DefaultPeriod), sub.CurrentPeriodEnd)
+	assert.Equal(t, now.Add(DefaultPeriod+DefaultGracePeriod), sub.GracePeriodEndsAt)
+}
+
+func TestRenewal(t *testing.T) {
+	policy := DefaultPolicy()
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	periodEnd := now.Add(24 * time.Hour)
+
+	current := &Subscription{Plan: "chirpy_red_yearly", Status: StatusPastDue, CurrentPeriodEnd: periodEnd, GracePeriodEndsAt: periodEnd.Add(DefaultGracePeriod)}
+
+	sub, err := policy.Apply(current, Event{Type: EventRenewed}, now)
+	assert.NoError(t, err)
+	assert.Equal(t, StatusActive, sub.Status)
+	assert.Equal(t, "chirpy_red_yearly", sub.Plan)
+	assert.Equal(t, now.Add(DefaultPeriod), sub.CurrentPeriodEnd)
+
+	current.Status = StatusActive
+	sub, err = policy.Apply(current, Event{Type: EventRenewed}, now)
+	assert.NoError(t, err)
+	assert.Equal(t, periodEnd.Add(DefaultPeriod), sub.CurrentPeriodEnd)
+
+	explicitEnd := now.Add(365 * 24 * time.Hour)
+	sub, err = policy.Apply(current, Event{Type: EventRenewed, PeriodEnd: explicitEnd}, now)
+	assert.NoError(t, err)
+	assert.Equal(t, explicitEnd, sub.CurrentPeriodEnd)
+	assert.Equal(t, explicitEnd.Add(DefaultGracePeriod), sub.GracePeriodEndsAt)
+}
+
+func TestPaymentFailed(t *testing.T) {
+	policy := DefaultPolicy()
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	_, err := policy.Apply(nil, Event{Type: EventPaymentFailed}, now)
+	assert.ErrorIs(t, err, ErrNoSubscription)
+
+	current := &Subscription{Plan: PlanChirpyRed, Status: StatusActive, CurrentPeriodEnd: now.Add(-time.Hour), GracePeriodEndsAt: now.Add(time.Hour)}
+
+	sub, err := policy.Apply(current, Event{Type: EventPaymentFailed}, now)
+	assert.NoError(t, err)
+	assert.Equal(t, StatusPastDue, sub.Status)
+	assert.Equal(t, now.Add(DefaultGracePeriod), sub.GracePeriodEndsAt)
+
+	again, err := policy.Apply(&sub, Event{Type: EventPaymentFailed}, now.Add(time.Hour))
+	assert.NoError(t, err)
+	assert.Equal(t, sub, again)
+}
+
+func TestDowngrade(t *testing.T) {
+	policy := DefaultPolicy()
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	_, err := policy.Apply(nil, Event{Type: EventDowngraded}, now)
+	assert.ErrorIs(t, err, ErrNoSubscription)
+
+	current := &Subscription{Plan: PlanChirpyRed, Status: StatusActive, CurrentPeriodEnd: now.Add(DefaultPeriod), GracePeriodEndsAt: now.Add(DefaultPeriod + DefaultGracePeriod)}
+
+	sub, err := policy.Apply(current, Event{Type: EventDowngraded}, now)
+	assert.NoError(t, err)
+	assert.Equal(t, StatusCanceled, sub.Status)
+	assert.Equal(t, now, sub.GracePeriodEndsAt)
+
+	_, err = policy.Apply(current, Event{Type: "user.exploded"}, now)
+	assert.ErrorIs(t, err, ErrUnknownEvent)
+}
+
+func TestPolicyFromEnv(t *testing.T) {
+	t.Setenv("SUBSCRIPTION_GRACE_PERIOD", "24h")
+
+	policy, err := PolicyFromEnv()
+	assert.NoError(t, err)
+	assert.Equal(t, DefaultPeriod, policy.Period)
+	assert.Equal(t, 24*time.Hour, policy.GracePeriod)
+
+	t.Setenv("SUBSCRIPTION_PERIOD", "0s")
+
+	_, err = PolicyFromEnv()
+	assert.Error(t, err)
+}
+
+func TestStaleEvent(t *testing.T) {
+	policy := DefaultPolicy()
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	upgraded, err := policy.Apply(nil, Event{Type: EventUpgraded, OccurredAt: now}, now)
+	assert.NoError(t, err)
+	assert.Equal(t, now, upgraded.LastEventAt)
+
+	downgraded, err := policy.Apply(&upgraded, Event{Type: EventDowngraded, OccurredAt: now.Add(2 * time.Minute)}, now)
+	assert.NoError(t, err)
+	assert.Equal(t, StatusCanceled, downgraded.Status)
+
+	// A renewal sent before the downgrade, but delivered after it.
+	_, err = policy.Apply(&downgraded, Event{Type: EventRenewed, OccurredAt: now.Add(time.Minute)}, now)
+	assert.ErrorIs(t, err, ErrStaleEvent)
+
+	// A redelivery of the last event is stale too.
+	_, err = policy.Apply(&downgraded, Event{Type: EventDowngraded, OccurredAt: now.Add(2 * time.Minute)}, now)
+	assert.ErrorIs(t, err, ErrStaleEvent)
+
+	// Without timestamps, a renewal for an earlier period is stale.
+	current := &Subscription{Plan: PlanChirpyRed, Status: StatusActive, CurrentPeriodEnd: now.Add(DefaultPeriod), GracePeriodEndsAt: now.Add(DefaultPeriod + DefaultGracePeriod)}
+
+	_, err = policy.Apply(current, Event{Type: EventRenewed, PeriodEnd: now.Add(time.Hour)}, now)
+	assert.ErrorIs(t, err, ErrStaleEvent)
+
+	sub, err := policy.Apply(current, Event{Type: EventRenewed, PeriodEnd: now.Add(2 * DefaultPeriod)}, now)
+	assert.NoError(t, err)
+	assert.Equal(t, now.Add(2*DefaultPeriod), sub.CurrentPeriodEnd)
+	assert.True(t, sub.LastEventAt.IsZero())
+}
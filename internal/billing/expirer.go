@@ -0,0 +1,40 @@
+package billing
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/Cmolloy36/Chirpy/internal/database"
+)
+
+// Expirer ends subscriptions whose grace period has run out and clears the
+// owner's Chirpy Red flag.
+type Expirer struct {
+	dbQueries *database.Queries
+}
+
+func NewExpirer(dbQueries *database.Queries) *Expirer {
+	return &Expirer{dbQueries: dbQueries}
+}
+
+// Run expires lapsed subscriptions every interval until ctx is cancelled.
+func (e *Expirer) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		expired, err := e.dbQueries.ExpireLapsedSubscriptions(ctx)
+		if err != nil && ctx.Err() == nil {
+			log.Printf("Error expiring subscriptions: %s", err)
+		} else if expired > 0 {
+			log.Printf("Expired %d lapsed subscriptions", expired)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,628 @@
+package billing
+
+import (
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Cmolloy36/Chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+const DefaultReconcileInterval = 24 * time.Hour
+
+// MaxNotInExportShare is the largest share of live subscriptions that a
+// repair will expire for being missing from the export. Past it, the
+// export is more likely truncated than Polka right.
+const MaxNotInExportShare = 0.2
+
+const (
+	MismatchUnknownUser         = "unknown_user"
+	MismatchMissingSubscription = "missing_subscription"
+	MismatchSubscriptionDiffers = "subscription_differs"
+	MismatchNotInExport         = "not_in_export"
+	MismatchFlagDrift           = "flag_drift"
+)
+
+// ExportRecord is one subscription as Polka's billing export reports it.
+type ExportRecord struct {
+	UserID           uuid.UUID `json:"user_id"`
+	Plan             string    `json:"plan"`
+	Status           string    `json:"status"`
+	CurrentPeriodEnd time.Time `json:"current_period_end"`
+}
+
+// LocalState is what Chirpy has stored for one user.
+type LocalState struct {
+	UserExists   bool
+	Subscription *Subscription
+	IsChirpyRed  bool
+}
+
+// Mismatch is a difference between the export and Chirpy. Repair is the
+// subscription to store to fix it, or nil if it can't be fixed here.
+type Mismatch struct {
+	UserID uuid.UUID     `json:"user_id"`
+	Kind   string        `json:"kind"`
+	Detail string        `json:"detail"`
+	Before *Subscription `json:"before"`
+	Repair *Subscription `json:"repair"`
+}
+
+func (m Mismatch) String() string {
+	return fmt.Sprintf("%s %s: %s", m.UserID, m.Kind, m.Detail)
+}
+
+// ParseExport reads a billing export. format is "csv" or "json". CSV
+// exports need a header row naming the user_id, plan, status and
+// current_period_end columns; JSON exports are an array of objects with
+// those keys. Timestamps are RFC 3339.
+func ParseExport(r io.Reader, format string) ([]ExportRecord, error) {
+	var records []ExportRecord
+
+	switch format {
+	case "json":
+		if err := json.NewDecoder(r).Decode(&records); err != nil {
+			return nil, fmt.Errorf("billing export: %w", err)
+		}
+	case "csv":
+		var err error
+		records, err = parseCSVExport(r)
+		if err != nil {
+			return nil, fmt.Errorf("billing export: %w", err)
+		}
+	default:
+		return nil, fmt.Errorf("billing export: unknown format %q", format)
+	}
+
+	seen := map[uuid.UUID]bool{}
+	for i, record := range records {
+		if record.UserID == uuid.Nil {
+			return nil, fmt.Errorf("billing export: record %d has no user_id", i+1)
+		}
+
+		if seen[record.UserID] {
+			return nil, fmt.Errorf("billing export: user %s appears more than once", record.UserID)
+		}
+		seen[record.UserID] = true
+
+		switch record.Status {
+		case StatusActive, StatusPastDue, StatusCanceled, StatusExpired:
+		default:
+			return nil, fmt.Errorf("billing export: user %s has unknown status %q", record.UserID, record.Status)
+		}
+
+		if record.CurrentPeriodEnd.IsZero() {
+			return nil, fmt.Errorf("billing export: user %s has no current_period_end", record.UserID)
+		}
+
+		if record.Plan == "" {
+			records[i].Plan = PlanChirpyRed
+		}
+	}
+
+	return records, nil
+}
+
+func parseCSVExport(r io.Reader) ([]ExportRecord, error) {
+	rows, err := csv.NewReader(r).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(rows) == 0 {
+		return nil, errors.New("missing header row")
+	}
+
+	columns := map[string]int{}
+	for i, name := range rows[0] {
+		columns[strings.TrimSpace(name)] = i
+	}
+
+	for _, name := range []string{"user_id", "plan", "status", "current_period_end"} {
+		if _, ok := columns[name]; !ok {
+			return nil, fmt.Errorf("missing %s column", name)
+		}
+	}
+
+	records := make([]ExportRecord, 0, len(rows)-1)
+	for line, row := range rows[1:] {
+		userID, err := uuid.Parse(strings.TrimSpace(row[columns["user_id"]]))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line+2, err)
+		}
+
+		periodEnd, err := time.Parse(time.RFC3339, strings.TrimSpace(row[columns["current_period_end"]]))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line+2, err)
+		}
+
+		records = append(records, ExportRecord{
+			UserID:           userID,
+			Plan:             strings.TrimSpace(row[columns["plan"]]),
+			Status:           strings.TrimSpace(row[columns["status"]]),
+			CurrentPeriodEnd: periodEnd,
+		})
+	}
+
+	return records, nil
+}
+
+// LoadExport reads an export from a file path or an http(s) URL. The
+// format comes from the file extension or the Content-Type, defaulting
+// to JSON.
+func LoadExport(ctx context.Context, source string, httpClient *http.Client) ([]ExportRecord, error) {
+	if !strings.HasPrefix(source, "http://") && !strings.HasPrefix(source, "https://") {
+		f, err := os.Open(source)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+
+		return ParseExport(f, exportFormat(filepath.Ext(source), ""))
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, source, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GET %s: %s", source, res.Status)
+	}
+
+	return ParseExport(res.Body, exportFormat(filepath.Ext(req.URL.Path), res.Header.Get("Content-Type")))
+}
+
+func exportFormat(ext, contentType string) string {
+	if strings.EqualFold(ext, ".csv") || strings.HasPrefix(contentType, "text/csv") {
+		return "csv"
+	}
+
+	return "json"
+}
+
+// Diff compares the export, which is taken to list every subscription
+// Polka knows about, with Chirpy's local state. Results are sorted by
+// user ID.
+func (p Policy) Diff(export []ExportRecord, local map[uuid.UUID]LocalState, now time.Time) []Mismatch {
+	var mismatches []Mismatch
+
+	inExport := map[uuid.UUID]bool{}
+	for _, record := range export {
+		inExport[record.UserID] = true
+
+		state := local[record.UserID]
+		if !state.UserExists {
+			mismatches = append(mismatches, Mismatch{
+				UserID: record.UserID,
+				Kind:   MismatchUnknownUser,
+				Detail: "the export has a " + record.Status + " subscription for a user Chirpy doesn't have",
+			})
+			continue
+		}
+
+		want := p.fromExport(record, state.Subscription, now)
+
+		if state.Subscription == nil {
+			mismatches = append(mismatches, Mismatch{
+				UserID: record.UserID,
+				Kind:   MismatchMissingSubscription,
+				Detail: "the export has a " + record.Status + " subscription that Chirpy has no record of",
+				Repair: &want,
+			})
+			continue
+		}
+
+		if detail := subscriptionDifference(*state.Subscription, want); detail != "" {
+			mismatches = append(mismatches, Mismatch{
+				UserID: record.UserID,
+				Kind:   MismatchSubscriptionDiffers,
+				Detail: detail,
+				Before: state.Subscription,
+				Repair: &want,
+			})
+			continue
+		}
+
+		if mismatch, ok := flagDrift(record.UserID, state, now); ok {
+			mismatches = append(mismatches, mismatch)
+		}
+	}
+
+	for userID, state := range local {
+		if inExport[userID] {
+			continue
+		}
+
+		if state.Subscription != nil && (state.Subscription.Status == StatusActive || state.Subscription.Status == StatusPastDue) {
+			repair := *state.Subscription
+			repair.Status = StatusExpired
+			repair.GracePeriodEndsAt = now
+
+			mismatches = append(mismatches, Mismatch{
+				UserID: userID,
+				Kind:   MismatchNotInExport,
+				Detail: "Chirpy has a " + state.Subscription.Status + " subscription that the export doesn't list",
+				Before: state.Subscription,
+				Repair: &repair,
+			})
+			continue
+		}
+
+		if mismatch, ok := flagDrift(userID, state, now); ok {
+			mismatches = append(mismatches, mismatch)
+		}
+	}
+
+	slices.SortFunc(mismatches, func(a, b Mismatch) int {
+		return strings.Compare(a.UserID.String(), b.UserID.String())
+	})
+
+	return mismatches
+}
+
+// fromExport is the subscription Chirpy should store for record. The
+// export has no grace period, so it is worked out the same way Apply
+// would.
+func (p Policy) fromExport(record ExportRecord, current *Subscription, now time.Time) Subscription {
+	sub := Subscription{
+		Plan:             record.Plan,
+		Status:           record.Status,
+		CurrentPeriodEnd: record.CurrentPeriodEnd,
+	}
+
+	switch record.Status {
+	case StatusActive:
+		sub.GracePeriodEndsAt = record.CurrentPeriodEnd.Add(p.GracePeriod)
+	case StatusPastDue:
+		if current != nil && current.Status == StatusPastDue {
+			sub.GracePeriodEndsAt = current.GracePeriodEndsAt
+			break
+		}
+
+		graceStart := record.CurrentPeriodEnd
+		if now.After(graceStart) {
+			graceStart = now
+		}
+		sub.GracePeriodEndsAt = graceStart.Add(p.GracePeriod)
+	default:
+		sub.GracePeriodEndsAt = now
+		if current != nil && current.GracePeriodEndsAt.Before(now) {
+			sub.GracePeriodEndsAt = current.GracePeriodEndsAt
+		}
+	}
+
+	return sub
+}
+
+func subscriptionDifference(have, want Subscription) string {
+	var differences []string
+
+	if have.Plan != want.Plan {
+		differences = append(differences, fmt.Sprintf("plan is %s, export says %s", have.Plan, want.Plan))
+	}
+
+	if have.Status != want.Status {
+		differences = append(differences, fmt.Sprintf("status is %s, export says %s", have.Status, want.Status))
+	}
+
+	if !have.CurrentPeriodEnd.Truncate(time.Second).Equal(want.CurrentPeriodEnd.Truncate(time.Second)) {
+		differences = append(differences, fmt.Sprintf("period ends %s, export says %s", have.CurrentPeriodEnd.Format(time.RFC3339), want.CurrentPeriodEnd.Format(time.RFC3339)))
+	}
+
+	return strings.Join(differences, "; ")
+}
+
+// flagDrift catches an is_chirpy_red flag that disagrees with a correct
+// subscription, e.g. after a manual database edit.
+func flagDrift(userID uuid.UUID, state LocalState, now time.Time) (Mismatch, bool) {
+	entitled := state.Subscription != nil && state.Subscription.Entitled(now)
+	if state.IsChirpyRed == entitled {
+		return Mismatch{}, false
+	}
+
+	repair := Subscription{Plan: PlanChirpyRed, Status: StatusExpired, CurrentPeriodEnd: now, GracePeriodEndsAt: now}
+	if state.Subscription != nil {
+		repair = *state.Subscription
+	}
+
+	return Mismatch{
+		UserID: userID,
+		Kind:   MismatchFlagDrift,
+		Detail: "is_chirpy_red is " + strconv.FormatBool(state.IsChirpyRed) + " but the subscription says " + strconv.FormatBool(entitled),
+		Before: state.Subscription,
+		Repair: &repair,
+	}, true
+}
+
+// ReconcileConfig is the scheduled reconciliation job's settings.
+type ReconcileConfig struct {
+	Source   string
+	Interval time.Duration
+	Repair   bool
+}
+
+// ReconcileConfigFromEnv reads BILLING_EXPORT (a path or URL),
+// BILLING_RECONCILE_INTERVAL and BILLING_RECONCILE_REPAIR. The job is off
+// when BILLING_EXPORT is empty.
+func ReconcileConfigFromEnv() (ReconcileConfig, error) {
+	config := ReconcileConfig{
+		Source:   os.Getenv("BILLING_EXPORT"),
+		Interval: DefaultReconcileInterval,
+	}
+
+	if val := os.Getenv("BILLING_RECONCILE_INTERVAL"); val != "" {
+		interval, err := time.ParseDuration(val)
+		if err != nil || interval <= 0 {
+			return ReconcileConfig{}, fmt.Errorf("invalid BILLING_RECONCILE_INTERVAL %q: must be a positive duration", val)
+		}
+
+		config.Interval = interval
+	}
+
+	if val := os.Getenv("BILLING_RECONCILE_REPAIR"); val != "" {
+		repair, err := strconv.ParseBool(val)
+		if err != nil {
+			return ReconcileConfig{}, fmt.Errorf("invalid BILLING_RECONCILE_REPAIR %q: must be true or false", val)
+		}
+
+		config.Repair = repair
+	}
+
+	return config, nil
+}
+
+// Report is the outcome of one reconciliation run. RepairRefused says why
+// nothing was repaired when the export looked too incomplete to trust.
+type Report struct {
+	Checked       int        `json:"checked"`
+	Mismatches    []Mismatch `json:"mismatches"`
+	Repaired      int        `json:"repaired"`
+	Skipped       int        `json:"skipped"`
+	RepairRefused string     `json:"repair_refused,omitempty"`
+}
+
+// Reconciler compares Polka's billing export with the subscriptions table
+// and, when asked, repairs the differences.
+type Reconciler struct {
+	db         *sql.DB
+	dbQueries  *database.Queries
+	policy     Policy
+	source     string
+	httpClient *http.Client
+}
+
+func NewReconciler(db *sql.DB, dbQueries *database.Queries, policy Policy, source string) *Reconciler {
+	return &Reconciler{
+		db:         db,
+		dbQueries:  dbQueries,
+		policy:     policy,
+		source:     source,
+		httpClient: &http.Client{Timeout: time.Minute},
+	}
+}
+
+// Run reconciles every interval until ctx is cancelled.
+func (r *Reconciler) Run(ctx context.Context, interval time.Duration, repair bool) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		report, err := r.Reconcile(ctx, repair)
+		if err != nil && ctx.Err() == nil {
+			log.Printf("Error reconciling subscriptions: %s", err)
+		} else if len(report.Mismatches) > 0 {
+			for _, mismatch := range report.Mismatches {
+				log.Printf("Subscription mismatch: %s", mismatch)
+			}
+			if report.RepairRefused != "" {
+				log.Printf("Not repairing subscriptions: %s", report.RepairRefused)
+			}
+			log.Printf("Reconciled %d subscriptions: %d mismatches, %d repaired, %d skipped", report.Checked, len(report.Mismatches), report.Repaired, report.Skipped)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Reconcile diffs the export against the database. With repair, each
+// fixable mismatch is written through Save, so it lands in the audit log.
+// A user whose subscription changed since the diff was taken, e.g. by a
+// webhook arriving mid-run, is skipped. Nothing is repaired if the export
+// is empty or leaves out too many live subscriptions; the report says so
+// instead.
+func (r *Reconciler) Reconcile(ctx context.Context, repair bool) (Report, error) {
+	export, err := LoadExport(ctx, r.source, r.httpClient)
+	if err != nil {
+		return Report{}, err
+	}
+
+	local, err := r.loadLocal(ctx, export)
+	if err != nil {
+		return Report{}, err
+	}
+
+	now := time.Now()
+
+	report := Report{
+		Checked:    len(local),
+		Mismatches: r.policy.Diff(export, local, now),
+	}
+
+	if !repair {
+		return report, nil
+	}
+
+	if reason := repairRefusal(export, local, report.Mismatches); reason != "" {
+		report.RepairRefused = reason
+		return report, nil
+	}
+
+	for _, mismatch := range report.Mismatches {
+		if mismatch.Repair == nil {
+			continue
+		}
+
+		repaired, err := r.repair(ctx, mismatch)
+		if err != nil {
+			return report, err
+		}
+
+		if repaired {
+			report.Repaired++
+		} else {
+			report.Skipped++
+		}
+	}
+
+	return report, nil
+}
+
+// repairRefusal returns why mismatches shouldn't be repaired, or "" if
+// they can be. An empty or cut-short export would otherwise expire every
+// subscription it leaves out.
+func repairRefusal(export []ExportRecord, local map[uuid.UUID]LocalState, mismatches []Mismatch) string {
+	var live int
+	for _, state := range local {
+		if state.Subscription != nil && (state.Subscription.Status == StatusActive || state.Subscription.Status == StatusPastDue) {
+			live++
+		}
+	}
+
+	if len(export) == 0 {
+		if live == 0 {
+			return ""
+		}
+
+		return fmt.Sprintf("the export is empty but Chirpy has %d live subscriptions", live)
+	}
+
+	var notInExport int
+	for _, mismatch := range mismatches {
+		if mismatch.Kind == MismatchNotInExport {
+			notInExport++
+		}
+	}
+
+	if float64(notInExport) > MaxNotInExportShare*float64(live) {
+		return fmt.Sprintf("the export leaves out %d of %d live subscriptions, more than %.0f%%", notInExport, live, MaxNotInExportShare*100)
+	}
+
+	return ""
+}
+
+func (r *Reconciler) loadLocal(ctx context.Context, export []ExportRecord) (map[uuid.UUID]LocalState, error) {
+	local := map[uuid.UUID]LocalState{}
+
+	dbSubscriptions, err := r.dbQueries.ListSubscriptions(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, dbSubscription := range dbSubscriptions {
+		sub := FromDatabase(dbSubscription)
+		local[dbSubscription.UserID] = LocalState{UserExists: true, Subscription: &sub}
+	}
+
+	chirpyRedUserIDs, err := r.dbQueries.ListChirpyRedUserIDs(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, userID := range chirpyRedUserIDs {
+		state := local[userID]
+		state.UserExists = true
+		state.IsChirpyRed = true
+		local[userID] = state
+	}
+
+	for _, record := range export {
+		if _, ok := local[record.UserID]; ok {
+			continue
+		}
+
+		_, err := r.dbQueries.GetUserFromID(ctx, record.UserID)
+		if errors.Is(err, sql.ErrNoRows) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+
+		local[record.UserID] = LocalState{UserExists: true}
+	}
+
+	return local, nil
+}
+
+func (r *Reconciler) repair(ctx context.Context, mismatch Mismatch) (bool, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	qtx := r.dbQueries.WithTx(tx)
+
+	var current *Subscription
+
+	dbSubscription, err := qtx.GetSubscriptionForUserForUpdate(ctx, mismatch.UserID)
+	if err == nil {
+		sub := FromDatabase(dbSubscription)
+		current = &sub
+	} else if !errors.Is(err, sql.ErrNoRows) {
+		return false, err
+	}
+
+	if !sameSubscription(current, mismatch.Before) {
+		return false, nil
+	}
+
+	change := Change{
+		UserID: mismatch.UserID,
+		Source: SourceReconciliation,
+		Action: mismatch.Kind,
+		Detail: mismatch.Detail,
+		Before: current,
+		After:  *mismatch.Repair,
+	}
+
+	if err := Save(ctx, qtx, change); err != nil {
+		return false, err
+	}
+
+	return true, tx.Commit()
+}
+
+func sameSubscription(a, b *Subscription) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+
+	return a.Plan == b.Plan &&
+		a.Status == b.Status &&
+		a.CurrentPeriodEnd.Equal(b.CurrentPeriodEnd) &&
+		a.GracePeriodEndsAt.Equal(b.GracePeriodEndsAt)
+}
@@ -0,0 +1,126 @@
+package billing
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseExportCSV(t *testing.T) {
+	userID := uuid.New()
+	csv := "status,user_id,current_period_end,plan\nactive," + userID.String() + ",2026-11-01T00:00:00Z,\n"
+
+	records, err := ParseExport(strings.NewReader(csv), "csv")
+	if err != nil {
+		t.Fatalf("error parsing export: %v", err)
+	}
+
+	assert.Equal(t, []ExportRecord{{
+		UserID:           userID,
+		Plan:             PlanChirpyRed,
+		Status:           StatusActive,
+		CurrentPeriodEnd: time.Date(2026, 11, 1, 0, 0, 0, 0, time.UTC),
+	}}, records)
+}
+
+func TestParseExportRejectsBadRecords(t *testing.T) {
+	userID := uuid.New().String()
+
+	exports := map[string]string{
+		"unknown status": `[{"user_id": "` + userID + `", "status": "trialing", "current_period_end": "2026-11-01T00:00:00Z"}]`,
+		"duplicate user": `[{"user_id": "` + userID + `", "status": "active", "current_period_end": "2026-11-01T00:00:00Z"}, {"user_id": "` + userID + `", "status": "active", "current_period_end": "2026-11-01T00:00:00Z"}]`,
+		"no period end":  `[{"user_id": "` + userID + `", "status": "active"}]`,
+	}
+
+	for name, export := range exports {
+		_, err := ParseExport(strings.NewReader(export), "json")
+		assert.Error(t, err, name)
+	}
+
+	_, err := ParseExport(strings.NewReader("user_id,status\n"), "csv")
+	assert.Error(t, err)
+}
+
+func TestDiff(t *testing.T) {
+	policy := DefaultPolicy()
+	now := time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)
+	periodEnd := now.Add(10 * 24 * time.Hour)
+
+	active := Subscription{Plan: PlanChirpyRed, Status: StatusActive, CurrentPeriodEnd: periodEnd, GracePeriodEndsAt: periodEnd.Add(DefaultGracePeriod)}
+
+	inSync, unknown, missing, differs, orphaned, drifted, freeUser := uuid.New(), uuid.New(), uuid.New(), uuid.New(), uuid.New(), uuid.New(), uuid.New()
+
+	export := []ExportRecord{
+		{UserID: inSync, Plan: PlanChirpyRed, Status: StatusActive, CurrentPeriodEnd: periodEnd},
+		{UserID: unknown, Plan: PlanChirpyRed, Status: StatusActive, CurrentPeriodEnd: periodEnd},
+		{UserID: missing, Plan: PlanChirpyRed, Status: StatusActive, CurrentPeriodEnd: periodEnd},
+		{UserID: differs, Plan: PlanChirpyRed, Status: StatusCanceled, CurrentPeriodEnd: periodEnd},
+		{UserID: drifted, Plan: PlanChirpyRed, Status: StatusActive, CurrentPeriodEnd: periodEnd},
+	}
+
+	local := map[uuid.UUID]LocalState{
+		inSync:   {UserExists: true, Subscription: &active, IsChirpyRed: true},
+		missing:  {UserExists: true},
+		differs:  {UserExists: true, Subscription: &active, IsChirpyRed: true},
+		orphaned: {UserExists: true, Subscription: &active, IsChirpyRed: true},
+		drifted:  {UserExists: true, Subscription: &active, IsChirpyRed: false},
+		freeUser: {UserExists: true},
+	}
+
+	kinds := map[uuid.UUID]Mismatch{}
+	for _, mismatch := range policy.Diff(export, local, now) {
+		kinds[mismatch.UserID] = mismatch
+	}
+
+	assert.Len(t, kinds, 5)
+	assert.Equal(t, MismatchUnknownUser, kinds[unknown].Kind)
+	assert.Nil(t, kinds[unknown].Repair)
+
+	assert.Equal(t, MismatchMissingSubscription, kinds[missing].Kind)
+	assert.Equal(t, active, *kinds[missing].Repair)
+
+	assert.Equal(t, MismatchSubscriptionDiffers, kinds[differs].Kind)
+	assert.Equal(t, StatusCanceled, kinds[differs].Repair.Status)
+	assert.False(t, kinds[differs].Repair.Entitled(now))
+
+	assert.Equal(t, MismatchNotInExport, kinds[orphaned].Kind)
+	assert.Equal(t, StatusExpired, kinds[orphaned].Repair.Status)
+
+	assert.Equal(t, MismatchFlagDrift, kinds[drifted].Kind)
+	assert.Equal(t, active, *kinds[drifted].Repair)
+}
+
+func TestRepairRefusal(t *testing.T) {
+	policy := DefaultPolicy()
+	now := time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)
+	periodEnd := now.Add(10 * 24 * time.Hour)
+
+	active := Subscription{Plan: PlanChirpyRed, Status: StatusActive, CurrentPeriodEnd: periodEnd, GracePeriodEndsAt: periodEnd.Add(DefaultGracePeriod)}
+
+	local := map[uuid.UUID]LocalState{}
+	var export []ExportRecord
+	for range 10 {
+		userID := uuid.New()
+		local[userID] = LocalState{UserExists: true, Subscription: &active, IsChirpyRed: true}
+		export = append(export, ExportRecord{UserID: userID, Plan: PlanChirpyRed, Status: StatusActive, CurrentPeriodEnd: periodEnd})
+	}
+
+	assert.Empty(t, repairRefusal(export, local, policy.Diff(export, local, now)))
+
+	// Two of ten missing is within the limit.
+	assert.Empty(t, repairRefusal(export[2:], local, policy.Diff(export[2:], local, now)))
+
+	// Three of ten is not.
+	mismatches := policy.Diff(export[3:], local, now)
+	assert.Len(t, mismatches, 3)
+	assert.Contains(t, repairRefusal(export[3:], local, mismatches), "leaves out 3 of 10")
+
+	mismatches = policy.Diff(nil, local, now)
+	assert.Contains(t, repairRefusal(nil, local, mismatches), "export is empty")
+
+	// An empty export is fine when there is nothing to expire.
+	assert.Empty(t, repairRefusal(nil, map[uuid.UUID]LocalState{}, nil))
+}
@@ -0,0 +1,83 @@
+package billing
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+
+	"github.com/Cmolloy36/Chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+const (
+	SourcePolka          = "polka"
+	SourceReconciliation = "reconciliation"
+)
+
+// Change is one write to a user's subscription, with enough context for
+// the audit log to explain it.
+type Change struct {
+	UserID uuid.UUID
+	Source string
+	Action string
+	Detail string
+	Before *Subscription
+	After  Subscription
+}
+
+func FromDatabase(dbSubscription database.Subscription) Subscription {
+	return Subscription{
+		Plan:              dbSubscription.Plan,
+		Status:            dbSubscription.Status,
+		CurrentPeriodEnd:  dbSubscription.CurrentPeriodEnd,
+		GracePeriodEndsAt: dbSubscription.GracePeriodEndsAt,
+		LastEventAt:       dbSubscription.LastEventAt.Time,
+	}
+}
+
+// Save writes change.After, re-derives the user's is_chirpy_red flag and
+// records the change in the audit log. qtx should be in a transaction so
+// the three writes land together.
+func Save(ctx context.Context, qtx *database.Queries, change Change) error {
+	upsertSubscriptionParams := database.UpsertSubscriptionParams{
+		UserID:            change.UserID,
+		Plan:              change.After.Plan,
+		Status:            change.After.Status,
+		CurrentPeriodEnd:  change.After.CurrentPeriodEnd,
+		GracePeriodEndsAt: change.After.GracePeriodEndsAt,
+		LastEventAt:       sql.NullTime{Time: change.After.LastEventAt, Valid: !change.After.LastEventAt.IsZero()},
+	}
+
+	if _, err := qtx.UpsertSubscription(ctx, upsertSubscriptionParams); err != nil {
+		return err
+	}
+
+	if err := qtx.SyncUserChirpyRed(ctx, change.UserID); err != nil {
+		return err
+	}
+
+	after, err := json.Marshal(change.After)
+	if err != nil {
+		return err
+	}
+
+	createSubscriptionAuditEntryParams := database.CreateSubscriptionAuditEntryParams{
+		UserID: change.UserID,
+		Source: change.Source,
+		Action: change.Action,
+		Detail: change.Detail,
+		After:  string(after),
+	}
+
+	if change.Before != nil {
+		before, err := json.Marshal(change.Before)
+		if err != nil {
+			return err
+		}
+
+		createSubscriptionAuditEntryParams.Before = sql.NullString{String: string(before), Valid: true}
+	}
+
+	_, err = qtx.CreateSubscriptionAuditEntry(ctx, createSubscriptionAuditEntryParams)
+	return err
+}
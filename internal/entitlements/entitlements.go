@@ -0,0 +1,374 @@
+// Package entitlements maps subscription plans to what their users may do:
+// boolean capabilities and numeric limits. Handlers ask it rather than
+// checking is_chirpy_red themselves, so every plan rule lives in one
+// config file.
+package entitlements
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"slices"
+	"time"
+
+	"github.com/Cmolloy36/Chirpy/internal/billing"
+)
+
+const PlanFree = "free"
+
+const (
+	CapabilityEditChirps   = "edit_chirps"
+	CapabilityMediaUploads = "media_uploads"
+)
+
+// Metrics are what usage quotas count.
+const (
+	MetricChirps   = "chirps"
+	MetricMedia    = "media"
+	MetricAPICalls = "api_calls"
+)
+
+const (
+	WindowDay   = "day"
+	WindowMonth = "month"
+)
+
+// Unlimited as a count limit means the plan has no cap.
+const Unlimited = -1
+
+// Limits are the numeric caps of a plan. Counts set to Unlimited have no
+// cap; EditWindow only matters with the edit_chirps capability. A metric
+// missing from Quotas is unlimited.
+type Limits struct {
+	MaxChirpLength int              `json:"max_chirp_length"`
+	EditWindow     Duration         `json:"edit_window"`
+	MaxMedia       int              `json:"max_media"`
+	Quotas         map[string]Quota `json:"quotas"`
+}
+
+// Quota caps how often a metric may be used per calendar day and month
+// (UTC).
+type Quota struct {
+	Daily   int `json:"daily"`
+	Monthly int `json:"monthly"`
+}
+
+// For returns the limit for window, WindowDay or WindowMonth.
+func (q Quota) For(window string) int {
+	if window == WindowMonth {
+		return q.Monthly
+	}
+
+	return q.Daily
+}
+
+type Plan struct {
+	Name         string   `json:"-"`
+	Capabilities []string `json:"capabilities"`
+	Limits       Limits   `json:"limits"`
+}
+
+// Duration reads time.ParseDuration strings such as "15m" from JSON.
+type Duration time.Duration
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+
+	*d = Duration(parsed)
+	return nil
+}
+
+// Denial explains why a plan doesn't allow something. It answers 402 when
+// another plan would allow it, so clients can offer an upgrade. Otherwise
+// an exhausted quota answers 429, to be retried after ResetsAt, and
+// anything else 403.
+type Denial struct {
+	Plan             string
+	Reason           string
+	UpgradeAvailable bool
+	QuotaExceeded    bool
+	ResetsAt         time.Time
+}
+
+func (d *Denial) Error() string {
+	return d.Reason
+}
+
+func (d *Denial) Status() int {
+	if d.UpgradeAvailable {
+		return http.StatusPaymentRequired
+	}
+
+	if d.QuotaExceeded {
+		return http.StatusTooManyRequests
+	}
+
+	return http.StatusForbidden
+}
+
+// Engine answers "can a user on this plan do X" from a fixed set of plans.
+type Engine struct {
+	defaultPlan string
+	plans       map[string]Plan
+}
+
+type config struct {
+	DefaultPlan string          `json:"default_plan"`
+	Plans       map[string]Plan `json:"plans"`
+}
+
+// Default is the built-in configuration, used when ENTITLEMENTS_FILE is
+// not set.
+func Default() *Engine {
+	engine, err := New(PlanFree, map[string]Plan{
+		PlanFree: {
+			Limits: Limits{
+				MaxChirpLength: 140,
+				MaxMedia:       0,
+				Quotas: map[string]Quota{
+					MetricChirps:   {Daily: 100, Monthly: 1000},
+					MetricMedia:    {Daily: 0, Monthly: 0},
+					MetricAPICalls: {Daily: 1000, Monthly: 20000},
+				},
+			},
+		},
+		billing.PlanChirpyRed: {
+			Capabilities: []string{CapabilityEditChirps, CapabilityMediaUploads},
+			Limits: Limits{
+				MaxChirpLength: 280,
+				EditWindow:     Duration(15 * time.Minute),
+				MaxMedia:       4,
+				Quotas: map[string]Quota{
+					MetricChirps:   {Daily: Unlimited, Monthly: Unlimited},
+					MetricMedia:    {Daily: 50, Monthly: 1000},
+					MetricAPICalls: {Daily: 10000, Monthly: 200000},
+				},
+			},
+		},
+	})
+	if err != nil {
+		panic(err)
+	}
+
+	return engine
+}
+
+// New builds an engine from plans. A chirpy_red plan is required: it is
+// what subscribers on a plan name that isn't configured fall back to.
+func New(defaultPlan string, plans map[string]Plan) (*Engine, error) {
+	if _, ok := plans[defaultPlan]; !ok {
+		return nil, fmt.Errorf("default plan %q is not defined", defaultPlan)
+	}
+
+	if _, ok := plans[billing.PlanChirpyRed]; !ok {
+		return nil, fmt.Errorf("plan %q is not defined", billing.PlanChirpyRed)
+	}
+
+	engine := &Engine{defaultPlan: defaultPlan, plans: map[string]Plan{}}
+	for name, plan := range plans {
+		if plan.Limits.MaxChirpLength <= 0 {
+			return nil, fmt.Errorf("plan %q: max_chirp_length must be positive", name)
+		}
+
+		if plan.Limits.MaxMedia < Unlimited {
+			return nil, fmt.Errorf("plan %q: max_media must be non-negative or %d for unlimited", name, Unlimited)
+		}
+
+		for metric, quota := range plan.Limits.Quotas {
+			if quota.Daily < Unlimited || quota.Monthly < Unlimited {
+				return nil, fmt.Errorf("plan %q: %s quota must be non-negative or %d for unlimited", name, metric, Unlimited)
+			}
+		}
+
+		if plan.Limits.EditWindow < 0 {
+			return nil, fmt.Errorf("plan %q: edit_window must not be negative", name)
+		}
+
+		if plan.Capabilities == nil {
+			plan.Capabilities = []string{}
+		}
+
+		plan.Name = name
+		engine.plans[name] = plan
+	}
+
+	return engine, nil
+}
+
+// Load reads plans from a JSON file.
+func Load(path string) (*Engine, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var cfg config
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	if cfg.DefaultPlan == "" {
+		cfg.DefaultPlan = PlanFree
+	}
+
+	engine, err := New(cfg.DefaultPlan, cfg.Plans)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	return engine, nil
+}
+
+// FromEnv loads ENTITLEMENTS_FILE, or returns Default if it isn't set.
+func FromEnv() (*Engine, error) {
+	path := os.Getenv("ENTITLEMENTS_FILE")
+	if path == "" {
+		return Default(), nil
+	}
+
+	return Load(path)
+}
+
+// HasPlan reports whether name is configured.
+func (e *Engine) HasPlan(name string) bool {
+	_, ok := e.plans[name]
+	return ok
+}
+
+// Plan returns the named plan, or the default plan if it isn't configured.
+func (e *Engine) Plan(name string) Plan {
+	if plan, ok := e.plans[name]; ok {
+		return plan
+	}
+
+	return e.plans[e.defaultPlan]
+}
+
+// DefaultPlan is the plan of users without a subscription.
+func (e *Engine) DefaultPlan() string {
+	return e.defaultPlan
+}
+
+// Can checks a boolean capability.
+func (e *Engine) Can(planName, capability string) error {
+	plan := e.Plan(planName)
+	if slices.Contains(plan.Capabilities, capability) {
+		return nil
+	}
+
+	return e.deny(plan, "your plan does not include "+capability, func(other Plan) bool {
+		return slices.Contains(other.Capabilities, capability)
+	})
+}
+
+// AllowChirpLength checks a chirp body of length characters.
+func (e *Engine) AllowChirpLength(planName string, length int) error {
+	plan := e.Plan(planName)
+	if length <= plan.Limits.MaxChirpLength {
+		return nil
+	}
+
+	reason := fmt.Sprintf("Chirp is too long: your plan allows %d characters", plan.Limits.MaxChirpLength)
+	return e.deny(plan, reason, func(other Plan) bool {
+		return length <= other.Limits.MaxChirpLength
+	})
+}
+
+// Quota returns the plan's quota for metric.
+func (e *Engine) Quota(planName, metric string) Quota {
+	quota, ok := e.Plan(planName).Limits.Quotas[metric]
+	if !ok {
+		return Quota{Daily: Unlimited, Monthly: Unlimited}
+	}
+
+	return quota
+}
+
+// QuotaExceeded is the denial for a used-up quota. It offers an upgrade
+// if another plan's limit for the window is higher.
+func (e *Engine) QuotaExceeded(planName, metric, window string, resetsAt time.Time) *Denial {
+	plan := e.Plan(planName)
+	limit := e.Quota(planName, metric).For(window)
+
+	denial := e.deny(plan, fmt.Sprintf("%s quota of %d per %s reached", metric, limit, window), func(other Plan) bool {
+		otherLimit := e.Quota(other.Name, metric).For(window)
+		return otherLimit == Unlimited || otherLimit > limit
+	})
+	denial.QuotaExceeded = true
+	denial.ResetsAt = resetsAt
+
+	return denial
+}
+
+// AllowEdit checks whether a chirp created at createdAt may still be
+// edited.
+func (e *Engine) AllowEdit(planName string, createdAt, now time.Time) error {
+	if err := e.Can(planName, CapabilityEditChirps); err != nil {
+		return err
+	}
+
+	plan := e.Plan(planName)
+	if now.Sub(createdAt) <= time.Duration(plan.Limits.EditWindow) {
+		return nil
+	}
+
+	return &Denial{Plan: plan.Name, Reason: "the edit window for this Chirp has closed"}
+}
+
+// AllowMedia checks attaching count media items to one chirp.
+func (e *Engine) AllowMedia(planName string, count int) error {
+	if count == 0 {
+		return nil
+	}
+
+	if err := e.Can(planName, CapabilityMediaUploads); err != nil {
+		return err
+	}
+
+	plan := e.Plan(planName)
+	if withinCount(plan.Limits.MaxMedia, count) {
+		return nil
+	}
+
+	reason := fmt.Sprintf("your plan allows %d media items per Chirp", plan.Limits.MaxMedia)
+	return e.deny(plan, reason, func(other Plan) bool {
+		return slices.Contains(other.Capabilities, CapabilityMediaUploads) && withinCount(other.Limits.MaxMedia, count)
+	})
+}
+
+func (e *Engine) deny(plan Plan, reason string, allows func(Plan) bool) *Denial {
+	denial := &Denial{Plan: plan.Name, Reason: reason}
+	for name, other := range e.plans {
+		if name != plan.Name && allows(other) {
+			denial.UpgradeAvailable = true
+			break
+		}
+	}
+
+	return denial
+}
+
+func withinCount(limit, count int) bool {
+	return limit == Unlimited || count <= limit
+}
+
+// AsDenial unwraps a Denial from err.
+func AsDenial(err error) (*Denial, bool) {
+	var denial *Denial
+	ok := errors.As(err, &denial)
+	return denial, ok
+}
@@ -0,0 +1,107 @@
+package entitlements
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestChirpLength(t *testing.T) {
+	engine := Default()
+
+	assert.NoError(t, engine.AllowChirpLength(PlanFree, 140))
+	assert.NoError(t, engine.AllowChirpLength("chirpy_red", 280))
+
+	err := engine.AllowChirpLength(PlanFree, 200)
+	denial, ok := AsDenial(err)
+	if !ok {
+		t.Fatalf("expected a denial, got %v", err)
+	}
+	assert.Equal(t, http.StatusPaymentRequired, denial.Status())
+
+	err = engine.AllowChirpLength("chirpy_red", 281)
+	denial, ok = AsDenial(err)
+	if !ok {
+		t.Fatalf("expected a denial, got %v", err)
+	}
+	assert.Equal(t, http.StatusForbidden, denial.Status())
+}
+
+func TestUnknownPlanFallsBackToDefault(t *testing.T) {
+	engine := Default()
+
+	assert.Equal(t, PlanFree, engine.Plan("platinum").Name)
+	assert.False(t, engine.HasPlan("platinum"))
+	assert.Error(t, engine.AllowChirpLength("platinum", 141))
+}
+
+func TestQuotas(t *testing.T) {
+	engine := Default()
+	resetsAt := time.Now().Add(time.Hour)
+
+	assert.Equal(t, Quota{Daily: 100, Monthly: 1000}, engine.Quota(PlanFree, MetricChirps))
+	assert.Equal(t, Unlimited, engine.Quota("chirpy_red", MetricChirps).For(WindowMonth))
+	assert.Equal(t, Quota{Daily: Unlimited, Monthly: Unlimited}, engine.Quota(PlanFree, "uploads"))
+
+	denial := engine.QuotaExceeded(PlanFree, MetricChirps, WindowDay, resetsAt)
+	assert.Equal(t, http.StatusPaymentRequired, denial.Status())
+	assert.Equal(t, resetsAt, denial.ResetsAt)
+
+	denial = engine.QuotaExceeded("chirpy_red", MetricAPICalls, WindowMonth, resetsAt)
+	assert.Equal(t, http.StatusTooManyRequests, denial.Status())
+}
+
+func TestCapabilities(t *testing.T) {
+	engine := Default()
+	now := time.Now()
+
+	err := engine.AllowEdit(PlanFree, now, now)
+	denial, ok := AsDenial(err)
+	if !ok {
+		t.Fatalf("expected a denial, got %v", err)
+	}
+	assert.Equal(t, http.StatusPaymentRequired, denial.Status())
+
+	assert.NoError(t, engine.AllowEdit("chirpy_red", now.Add(-time.Minute), now))
+	assert.Error(t, engine.AllowEdit("chirpy_red", now.Add(-time.Hour), now))
+
+	assert.NoError(t, engine.AllowMedia(PlanFree, 0))
+	assert.Error(t, engine.AllowMedia(PlanFree, 1))
+	assert.NoError(t, engine.AllowMedia("chirpy_red", 4))
+	assert.Error(t, engine.AllowMedia("chirpy_red", 5))
+}
+
+func TestLoad(t *testing.T) {
+	engine, err := Load(filepath.Join("..", "..", "entitlements.example.json"))
+	if err != nil {
+		t.Fatalf("error loading example config: %v", err)
+	}
+	assert.Equal(t, Default().plans, engine.plans)
+
+	path := filepath.Join(t.TempDir(), "entitlements.json")
+	os.WriteFile(path, []byte(`{"default_plan": "basic", "plans": {"free": {"limits": {"max_chirp_length": 140}}}}`), 0o600)
+
+	_, err = Load(path)
+	assert.Error(t, err)
+
+	os.WriteFile(path, []byte(`{"plans": {"free": {"limits": {"max_chirp_length": 0}}, "chirpy_red": {"limits": {"max_chirp_length": 280}}}}`), 0o600)
+
+	_, err = Load(path)
+	assert.Error(t, err)
+
+	// Subscribers on unconfigured plans fall back to chirpy_red, so it
+	// must exist.
+	os.WriteFile(path, []byte(`{"plans": {"free": {"limits": {"max_chirp_length": 140}}}}`), 0o600)
+
+	_, err = Load(path)
+	assert.ErrorContains(t, err, "chirpy_red")
+
+	os.WriteFile(path, []byte(`{"plans": {"free": {"limits": {"max_chirp_length": 140}}, "chirpy_red": {"limits": {"max_chirp_length": 280}}}}`), 0o600)
+
+	_, err = Load(path)
+	assert.NoError(t, err)
+}
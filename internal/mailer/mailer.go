@@ -0,0 +1,140 @@
+// Package mailer sends transactional email. Handlers enqueue messages in the
+// email_outbox table through Outbox; a background worker delivers them with
+// a Sender so a slow or down mail server never blocks a request.
+package mailer
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer is what handlers depend on to send email.
+type Mailer interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// Sender delivers a message immediately.
+type Sender interface {
+	Deliver(ctx context.Context, msg Message) error
+}
+
+// SMTPSender delivers through an SMTP server. Username may be empty for
+// servers (or local stand-ins) that don't require auth.
+type SMTPSender struct {
+	Addr     string
+	From     string
+	Username string
+	Password string
+}
+
+func (s SMTPSender) Deliver(ctx context.Context, msg Message) error {
+	var auth smtp.Auth
+	if s.Username != "" {
+		host, _, _ := strings.Cut(s.Addr, ":")
+		auth = smtp.PlainAuth("", s.Username, s.Password, host)
+	}
+
+	if err := smtp.SendMail(s.Addr, auth, s.From, []string{msg.To}, formatMessage(s.From, msg)); err != nil {
+		return fmt.Errorf("error sending mail to %s: %w", msg.To, err)
+	}
+
+	return nil
+}
+
+// FileSender writes each message to Dir as an .eml file, for local
+// development without a mail server.
+type FileSender struct {
+	Dir  string
+	From string
+}
+
+func (s FileSender) Deliver(ctx context.Context, msg Message) error {
+	if err := os.MkdirAll(s.Dir, 0o755); err != nil {
+		return err
+	}
+
+	name := fmt.Sprintf("%s-%s.eml", time.Now().UTC().Format("20060102T150405"), uuid.NewString())
+
+	return os.WriteFile(filepath.Join(s.Dir, name), formatMessage(s.From, msg), 0o644)
+}
+
+// ConsoleSender prints messages to W.
+type ConsoleSender struct {
+	W    io.Writer
+	From string
+
+	mu sync.Mutex
+}
+
+func (s *ConsoleSender) Deliver(ctx context.Context, msg Message) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, err := fmt.Fprintf(s.W, "----- email -----\n%s\n-----------------\n", formatMessage(s.From, msg))
+	return err
+}
+
+func formatMessage(from string, msg Message) []byte {
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\n", from)
+	fmt.Fprintf(&b, "To: %s\r\n", msg.To)
+	fmt.Fprintf(&b, "Subject: %s\r\n", msg.Subject)
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().UTC().Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	b.WriteString("\r\n")
+	b.WriteString(strings.ReplaceAll(msg.Body, "\n", "\r\n"))
+	b.WriteString("\r\n")
+
+	return []byte(b.String())
+}
+
+// SenderFromEnv picks a Sender from MAIL_SENDER ("smtp", "file" or
+// "console", the default).
+func SenderFromEnv() (Sender, error) {
+	from := os.Getenv("MAIL_FROM")
+	if from == "" {
+		from = "Chirpy <no-reply@chirpy.local>"
+	}
+
+	switch os.Getenv("MAIL_SENDER") {
+	case "smtp":
+		addr := os.Getenv("SMTP_ADDR")
+		if addr == "" {
+			return nil, fmt.Errorf("MAIL_SENDER=smtp requires SMTP_ADDR")
+		}
+
+		return SMTPSender{
+			Addr:     addr,
+			From:     from,
+			Username: os.Getenv("SMTP_USERNAME"),
+			Password: os.Getenv("SMTP_PASSWORD"),
+		}, nil
+	case "file":
+		dir := os.Getenv("MAIL_DIR")
+		if dir == "" {
+			dir = "mail"
+		}
+
+		return FileSender{Dir: dir, From: from}, nil
+	case "", "console":
+		return &ConsoleSender{W: os.Stdout, From: from}, nil
+	default:
+		return nil, fmt.Errorf("unknown MAIL_SENDER %q", os.Getenv("MAIL_SENDER"))
+	}
+}
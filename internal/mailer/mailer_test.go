@@ -0,0 +1,135 @@
+package mailer
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeSMTPServer is a local SMTP stand-in that accepts one message per
+// connection and records the DATA section.
+type fakeSMTPServer struct {
+	listener net.Listener
+	received chan string
+}
+
+func newFakeSMTPServer(t *testing.T) *fakeSMTPServer {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("error listening: %v", err)
+	}
+
+	s := &fakeSMTPServer{listener: listener, received: make(chan string, 1)}
+	go s.serve()
+	t.Cleanup(func() { listener.Close() })
+
+	return s
+}
+
+func (s *fakeSMTPServer) serve() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		go s.handle(conn)
+	}
+}
+
+func (s *fakeSMTPServer) handle(conn net.Conn) {
+	defer conn.Close()
+
+	r := bufio.NewReader(conn)
+	reply := func(line string) { conn.Write([]byte(line + "\r\n")) }
+
+	reply("220 localhost ESMTP")
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+
+		cmd := strings.ToUpper(strings.TrimSpace(line))
+		switch {
+		case strings.HasPrefix(cmd, "EHLO"), strings.HasPrefix(cmd, "HELO"):
+			reply("250 localhost")
+		case strings.HasPrefix(cmd, "MAIL"), strings.HasPrefix(cmd, "RCPT"), strings.HasPrefix(cmd, "RSET"):
+			reply("250 OK")
+		case cmd == "DATA":
+			reply("354 go ahead")
+			var data bytes.Buffer
+			for {
+				dataLine, err := r.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if dataLine == ".\r\n" {
+					break
+				}
+				data.WriteString(dataLine)
+			}
+			s.received <- data.String()
+			reply("250 OK")
+		case cmd == "QUIT":
+			reply("221 bye")
+			return
+		default:
+			reply("502 not implemented")
+		}
+	}
+}
+
+func TestSMTPSender(t *testing.T) {
+	server := newFakeSMTPServer(t)
+
+	sender := SMTPSender{
+		Addr: server.listener.Addr().String(),
+		From: "no-reply@chirpy.local",
+	}
+
+	msg := Message{
+		To:      "saul@bettercall.com",
+		Subject: "Verify your email",
+		Body:    "Your token is abc",
+	}
+
+	if err := sender.Deliver(context.Background(), msg); err != nil {
+		t.Fatalf("error delivering: %v", err)
+	}
+
+	data := <-server.received
+	assert.Contains(t, data, "To: saul@bettercall.com\r\n")
+	assert.Contains(t, data, "Subject: Verify your email\r\n")
+	assert.Contains(t, data, "Your token is abc")
+}
+
+func TestFileSender(t *testing.T) {
+	dir := t.TempDir()
+	sender := FileSender{Dir: dir, From: "no-reply@chirpy.local"}
+
+	msg := Message{To: "saul@bettercall.com", Subject: "Hi", Body: "hello"}
+	if err := sender.Deliver(context.Background(), msg); err != nil {
+		t.Fatalf("error delivering: %v", err)
+	}
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.eml"))
+	if err != nil || len(files) != 1 {
+		t.Fatalf("expected one .eml file, got %v (%v)", files, err)
+	}
+
+	dat, err := os.ReadFile(files[0])
+	if err != nil {
+		t.Fatalf("error reading file: %v", err)
+	}
+
+	assert.Contains(t, string(dat), "Subject: Hi\r\n")
+}
@@ -0,0 +1,98 @@
+package mailer
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"time"
+
+	"github.com/Cmolloy36/Chirpy/internal/database"
+)
+
+const (
+	outboxBatchSize   = 10
+	outboxMaxAttempts = 8
+	outboxBaseBackoff = 30 * time.Second
+)
+
+// Outbox is the durable Mailer: Send only records the message, and Run
+// delivers it later, retrying failures with exponential backoff.
+type Outbox struct {
+	dbQueries *database.Queries
+	sender    Sender
+}
+
+func NewOutbox(dbQueries *database.Queries, sender Sender) *Outbox {
+	return &Outbox{dbQueries: dbQueries, sender: sender}
+}
+
+func (o *Outbox) Send(ctx context.Context, msg Message) error {
+	enqueueEmailParams := database.EnqueueEmailParams{
+		ToAddress: msg.To,
+		Subject:   msg.Subject,
+		Body:      msg.Body,
+	}
+
+	_, err := o.dbQueries.EnqueueEmail(ctx, enqueueEmailParams)
+	return err
+}
+
+// Run polls the outbox every interval until ctx is cancelled.
+func (o *Outbox) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := o.DeliverPending(ctx); err != nil && ctx.Err() == nil {
+			log.Printf("Error delivering outbox email: %s", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// DeliverPending claims a batch of due messages and tries to send each one.
+func (o *Outbox) DeliverPending(ctx context.Context) error {
+	emails, err := o.dbQueries.ClaimPendingEmails(ctx, outboxBatchSize)
+	if err != nil {
+		return err
+	}
+
+	for _, email := range emails {
+		msg := Message{
+			To:      email.ToAddress,
+			Subject: email.Subject,
+			Body:    email.Body,
+		}
+
+		deliverErr := o.sender.Deliver(ctx, msg)
+		if deliverErr == nil {
+			if err := o.dbQueries.MarkEmailSent(ctx, email.ID); err != nil {
+				return err
+			}
+			continue
+		}
+
+		status := "pending"
+		if email.Attempts >= outboxMaxAttempts {
+			status = "failed"
+		}
+
+		markEmailFailedParams := database.MarkEmailFailedParams{
+			ID:        email.ID,
+			Status:    status,
+			LastError: sql.NullString{String: deliverErr.Error(), Valid: true},
+			SendAfter: time.Now().Add(outboxBaseBackoff << (email.Attempts - 1)),
+		}
+
+		if err := o.dbQueries.MarkEmailFailed(ctx, markEmailFailedParams); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
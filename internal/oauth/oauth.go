@@ -0,0 +1,219 @@
+// Package oauth holds the protocol pieces of Chirpy's OAuth 2.0
+// authorization server: PKCE (RFC 7636), scope and redirect URI checks,
+// client authentication and the error responses of RFC 6749.
+package oauth
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+)
+
+const (
+	GrantTypeAuthorizationCode = "authorization_code"
+	GrantTypeClientCredentials = "client_credentials"
+	GrantTypeRefreshToken      = "refresh_token"
+
+	ResponseTypeCode = "code"
+
+	// CodeChallengeMethodS256 is the only PKCE method accepted; "plain"
+	// offers no protection if the authorization request leaks.
+	CodeChallengeMethodS256 = "S256"
+
+	AuthorizationCodeTTL = 10 * time.Minute
+)
+
+// Error is an OAuth error response. Code is one of the RFC 6749 error codes
+// and is what clients branch on; Description is for humans.
+type Error struct {
+	Code        string `json:"error"`
+	Description string `json:"error_description,omitempty"`
+}
+
+func (e *Error) Error() string {
+	if e.Description == "" {
+		return e.Code
+	}
+
+	return e.Code + ": " + e.Description
+}
+
+// Status is the HTTP status the token endpoint answers with for e.
+func (e *Error) Status() int {
+	if e.Code == "invalid_client" {
+		return http.StatusUnauthorized
+	}
+
+	return http.StatusBadRequest
+}
+
+func InvalidRequest(description string) *Error {
+	return &Error{Code: "invalid_request", Description: description}
+}
+
+func InvalidClient(description string) *Error {
+	return &Error{Code: "invalid_client", Description: description}
+}
+
+func InvalidGrant(description string) *Error {
+	return &Error{Code: "invalid_grant", Description: description}
+}
+
+func InvalidScope(description string) *Error {
+	return &Error{Code: "invalid_scope", Description: description}
+}
+
+func UnauthorizedClient(description string) *Error {
+	return &Error{Code: "unauthorized_client", Description: description}
+}
+
+func UnsupportedGrantType(grantType string) *Error {
+	return &Error{Code: "unsupported_grant_type", Description: "grant type " + grantType + " is not supported"}
+}
+
+func UnsupportedResponseType(responseType string) *Error {
+	return &Error{Code: "unsupported_response_type", Description: "response type " + responseType + " is not supported"}
+}
+
+func AccessDenied(description string) *Error {
+	return &Error{Code: "access_denied", Description: description}
+}
+
+// ValidateCodeChallenge checks the code_challenge sent with an
+// authorization request: a base64url SHA-256 digest, so 43 characters.
+func ValidateCodeChallenge(challenge, method string) *Error {
+	if challenge == "" {
+		return InvalidRequest("code_challenge is required")
+	}
+
+	if method != CodeChallengeMethodS256 {
+		return InvalidRequest("code_challenge_method must be S256")
+	}
+
+	if decoded, err := base64.RawURLEncoding.DecodeString(challenge); err != nil || len(decoded) != sha256.Size {
+		return InvalidRequest("code_challenge is not a base64url SHA-256 digest")
+	}
+
+	return nil
+}
+
+// VerifyPKCE checks a code_verifier against the stored S256 challenge.
+func VerifyPKCE(verifier, challenge string) *Error {
+	if len(verifier) < 43 || len(verifier) > 128 || strings.IndexFunc(verifier, isNotUnreserved) >= 0 {
+		return InvalidGrant("code_verifier is malformed")
+	}
+
+	sum := sha256.Sum256([]byte(verifier))
+	computed := base64.RawURLEncoding.EncodeToString(sum[:])
+
+	if subtle.ConstantTimeCompare([]byte(computed), []byte(challenge)) != 1 {
+		return InvalidGrant("code_verifier does not match code_challenge")
+	}
+
+	return nil
+}
+
+// isNotUnreserved reports runes outside the RFC 3986 unreserved set that
+// code verifiers are drawn from.
+func isNotUnreserved(r rune) bool {
+	switch {
+	case 'A' <= r && r <= 'Z', 'a' <= r && r <= 'z', '0' <= r && r <= '9':
+		return false
+	case r == '-' || r == '.' || r == '_' || r == '~':
+		return false
+	}
+
+	return true
+}
+
+// HashCode returns the value authorization codes are stored under, so a
+// database leak doesn't hand out usable codes.
+func HashCode(code string) string {
+	sum := sha256.Sum256([]byte(code))
+	return hex.EncodeToString(sum[:])
+}
+
+// ResolveScope turns a requested scope string into the list to grant. An
+// empty request means every scope the client is allowed; asking for any
+// scope outside allowed is an error.
+func ResolveScope(requested string, allowed []string) ([]string, *Error) {
+	if strings.TrimSpace(requested) == "" {
+		return slices.Clone(allowed), nil
+	}
+
+	var scopes []string
+	for _, scope := range strings.Fields(requested) {
+		if !slices.Contains(allowed, scope) {
+			return nil, InvalidScope("scope " + scope + " is not allowed for this client")
+		}
+
+		if !slices.Contains(scopes, scope) {
+			scopes = append(scopes, scope)
+		}
+	}
+
+	return scopes, nil
+}
+
+// ValidateRedirectURI checks a redirect URI at client registration. It must
+// be absolute, without a fragment, and use https unless it points at the
+// local machine.
+func ValidateRedirectURI(rawURI string) *Error {
+	u, err := url.Parse(rawURI)
+	if err != nil || !u.IsAbs() || u.Host == "" {
+		return InvalidRequest("redirect URI " + rawURI + " must be an absolute URL")
+	}
+
+	if u.Fragment != "" || strings.Contains(rawURI, "#") {
+		return InvalidRequest("redirect URI " + rawURI + " must not contain a fragment")
+	}
+
+	switch u.Scheme {
+	case "https":
+		return nil
+	case "http":
+		if host := u.Hostname(); host == "localhost" || host == "127.0.0.1" || host == "::1" {
+			return nil
+		}
+	}
+
+	return InvalidRequest("redirect URI " + rawURI + " must use https")
+}
+
+// RedirectURL appends params to redirectURI's query string.
+func RedirectURL(redirectURI string, params url.Values) string {
+	u, err := url.Parse(redirectURI)
+	if err != nil {
+		return redirectURI
+	}
+
+	query := u.Query()
+	for key, values := range params {
+		for _, value := range values {
+			query.Add(key, value)
+		}
+	}
+	u.RawQuery = query.Encode()
+
+	return u.String()
+}
+
+// ClientCredentials reads client authentication from HTTP Basic auth or,
+// failing that, the client_id and client_secret form fields. r.ParseForm
+// must have been called.
+func ClientCredentials(r *http.Request) (clientID, clientSecret string, ok bool) {
+	if clientID, clientSecret, ok := r.BasicAuth(); ok {
+		clientID, _ = url.QueryUnescape(clientID)
+		clientSecret, _ = url.QueryUnescape(clientSecret)
+		return clientID, clientSecret, true
+	}
+
+	clientID = r.PostForm.Get("client_id")
+	return clientID, r.PostForm.Get("client_secret"), clientID != ""
+}
@@ -0,0 +1,96 @@
+package oauth
+
+import (
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Example from RFC 7636 appendix B.
+const (
+	rfcVerifier  = "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+	rfcChallenge = "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM"
+)
+
+func TestPKCE(t *testing.T) {
+	assert.Nil(t, ValidateCodeChallenge(rfcChallenge, CodeChallengeMethodS256))
+	assert.NotNil(t, ValidateCodeChallenge(rfcChallenge, "plain"))
+	assert.NotNil(t, ValidateCodeChallenge("", CodeChallengeMethodS256))
+	assert.NotNil(t, ValidateCodeChallenge("too-short", CodeChallengeMethodS256))
+
+	assert.Nil(t, VerifyPKCE(rfcVerifier, rfcChallenge))
+
+	err := VerifyPKCE(strings.Repeat("a", 43), rfcChallenge)
+	if assert.NotNil(t, err) {
+		assert.Equal(t, "invalid_grant", err.Code)
+	}
+
+	assert.NotNil(t, VerifyPKCE("short", rfcChallenge))
+	assert.NotNil(t, VerifyPKCE(rfcVerifier+"!", rfcChallenge))
+}
+
+func TestResolveScope(t *testing.T) {
+	allowed := []string{"chirps:read", "chirps:write"}
+
+	scopes, err := ResolveScope("", allowed)
+	assert.Nil(t, err)
+	assert.Equal(t, allowed, scopes)
+
+	scopes, err = ResolveScope("chirps:read chirps:read", allowed)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"chirps:read"}, scopes)
+
+	_, err = ResolveScope("chirps:read profile:write", allowed)
+	if assert.NotNil(t, err) {
+		assert.Equal(t, "invalid_scope", err.Code)
+	}
+}
+
+func TestValidateRedirectURI(t *testing.T) {
+	assert.Nil(t, ValidateRedirectURI("https://app.example.com/callback"))
+	assert.Nil(t, ValidateRedirectURI("http://localhost:3000/callback"))
+	assert.Nil(t, ValidateRedirectURI("http://127.0.0.1/cb"))
+
+	assert.NotNil(t, ValidateRedirectURI("http://app.example.com/callback"))
+	assert.NotNil(t, ValidateRedirectURI("https://app.example.com/callback#frag"))
+	assert.NotNil(t, ValidateRedirectURI("/callback"))
+}
+
+func TestRedirectURL(t *testing.T) {
+	got := RedirectURL("https://app.example.com/cb?x=1", url.Values{"code": {"abc"}, "state": {"s t"}})
+
+	u, err := url.Parse(got)
+	assert.NoError(t, err)
+	assert.Equal(t, "1", u.Query().Get("x"))
+	assert.Equal(t, "abc", u.Query().Get("code"))
+	assert.Equal(t, "s t", u.Query().Get("state"))
+}
+
+func TestClientCredentials(t *testing.T) {
+	r := httptest.NewRequest("POST", "/oauth/token", nil)
+	r.SetBasicAuth("client%201", "secret")
+	r.ParseForm()
+
+	clientID, clientSecret, ok := ClientCredentials(r)
+	assert.True(t, ok)
+	assert.Equal(t, "client 1", clientID)
+	assert.Equal(t, "secret", clientSecret)
+
+	r = httptest.NewRequest("POST", "/oauth/token", strings.NewReader("client_id=c&client_secret=s"))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	r.ParseForm()
+
+	clientID, clientSecret, ok = ClientCredentials(r)
+	assert.True(t, ok)
+	assert.Equal(t, "c", clientID)
+	assert.Equal(t, "s", clientSecret)
+}
+
+func TestErrorStatus(t *testing.T) {
+	assert.Equal(t, 401, InvalidClient("").Status())
+	assert.Equal(t, 400, InvalidGrant("").Status())
+	assert.Equal(t, "invalid_grant: expired", InvalidGrant("expired").Error())
+}
@@ -0,0 +1,161 @@
+package oidc_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Cmolloy36/Chirpy/internal/oidc"
+	"github.com/Cmolloy36/Chirpy/internal/oidc/oidctest"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestProvider(t *testing.T) (*oidctest.Provider, *oidc.Provider) {
+	mock := oidctest.NewProvider(t, "chirpy", "s3cret")
+
+	provider := oidc.NewProvider(oidc.Config{
+		Issuer:       mock.Issuer(),
+		ClientID:     "chirpy",
+		ClientSecret: "s3cret",
+		RedirectURL:  "http://localhost:8080/api/login/oidc/callback",
+	}, nil)
+
+	return mock, provider
+}
+
+func idTokenClaims(mock *oidctest.Provider) jwt.MapClaims {
+	now := time.Now()
+
+	return jwt.MapClaims{
+		"iss":   mock.Issuer(),
+		"sub":   "user-1",
+		"aud":   "chirpy",
+		"iat":   now.Unix(),
+		"exp":   now.Add(5 * time.Minute).Unix(),
+		"nonce": "n-0S6_WzA2Mj",
+	}
+}
+
+func TestAuthorizationCodeFlow(t *testing.T) {
+	mock, provider := newTestProvider(t)
+	mock.SetUser(oidctest.User{Subject: "abc123", Email: "jane@example.com", EmailVerified: true, Name: "Jane"})
+
+	ctx := context.Background()
+
+	authURL, err := provider.AuthCodeURL(ctx, "state-1", "nonce-1", "verifier-that-is-long-enough-for-pkce-xxxxx")
+	assert.NoError(t, err)
+
+	redirect, err := mock.Authorize(authURL)
+	assert.NoError(t, err)
+	assert.Equal(t, "state-1", redirect.Query().Get("state"))
+
+	claims, err := provider.Exchange(ctx, redirect.Query().Get("code"), "verifier-that-is-long-enough-for-pkce-xxxxx", "nonce-1")
+	assert.NoError(t, err)
+	assert.Equal(t, "abc123", claims.Subject)
+	assert.Equal(t, "jane@example.com", claims.VerifiedEmail())
+	assert.Equal(t, "Jane", claims.Name)
+}
+
+func TestExchangeRejectsWrongVerifier(t *testing.T) {
+	mock, provider := newTestProvider(t)
+	ctx := context.Background()
+
+	authURL, err := provider.AuthCodeURL(ctx, "state", "nonce", "right-verifier")
+	assert.NoError(t, err)
+
+	redirect, err := mock.Authorize(authURL)
+	assert.NoError(t, err)
+
+	_, err = provider.Exchange(ctx, redirect.Query().Get("code"), "wrong-verifier", "nonce")
+	assert.Error(t, err)
+}
+
+func TestExchangeRejectsWrongNonce(t *testing.T) {
+	mock, provider := newTestProvider(t)
+	ctx := context.Background()
+
+	authURL, err := provider.AuthCodeURL(ctx, "state", "nonce-a", "verifier")
+	assert.NoError(t, err)
+
+	redirect, err := mock.Authorize(authURL)
+	assert.NoError(t, err)
+
+	_, err = provider.Exchange(ctx, redirect.Query().Get("code"), "verifier", "nonce-b")
+	assert.ErrorIs(t, err, oidc.ErrNonceMismatch)
+}
+
+func TestVerifyIDToken(t *testing.T) {
+	mock, provider := newTestProvider(t)
+	ctx := context.Background()
+
+	claims, err := provider.VerifyIDToken(ctx, mock.SignIDToken(idTokenClaims(mock)), "n-0S6_WzA2Mj")
+	assert.NoError(t, err)
+	assert.Equal(t, "user-1", claims.Subject)
+	assert.Equal(t, "", claims.VerifiedEmail())
+
+	tests := map[string]func(jwt.MapClaims){
+		"wrong audience": func(c jwt.MapClaims) { c["aud"] = "someone-else" },
+		"wrong issuer":   func(c jwt.MapClaims) { c["iss"] = "https://evil.example.com" },
+		"expired":        func(c jwt.MapClaims) { c["exp"] = time.Now().Add(-time.Hour).Unix() },
+		"no expiry":      func(c jwt.MapClaims) { delete(c, "exp") },
+		"no subject":     func(c jwt.MapClaims) { delete(c, "sub") },
+		"foreign azp": func(c jwt.MapClaims) {
+			c["aud"] = []string{"chirpy", "other"}
+			c["azp"] = "other"
+		},
+	}
+
+	for name, mutate := range tests {
+		t.Run(name, func(t *testing.T) {
+			c := idTokenClaims(mock)
+			mutate(c)
+
+			_, err := provider.VerifyIDToken(ctx, mock.SignIDToken(c), "n-0S6_WzA2Mj")
+			assert.ErrorIs(t, err, oidc.ErrInvalidIDToken)
+		})
+	}
+}
+
+func TestVerifyIDTokenRejectsBadSignature(t *testing.T) {
+	mock, provider := newTestProvider(t)
+	ctx := context.Background()
+
+	signed := mock.SignIDToken(idTokenClaims(mock))
+	tampered := signed[:len(signed)-4] + "AAAA"
+
+	_, err := provider.VerifyIDToken(ctx, tampered, "n-0S6_WzA2Mj")
+	assert.ErrorIs(t, err, oidc.ErrInvalidIDToken)
+
+	unsigned := jwt.NewWithClaims(jwt.SigningMethodNone, idTokenClaims(mock))
+	raw, err := unsigned.SignedString(jwt.UnsafeAllowNoneSignatureType)
+	assert.NoError(t, err)
+
+	_, err = provider.VerifyIDToken(ctx, raw, "n-0S6_WzA2Mj")
+	assert.ErrorIs(t, err, oidc.ErrInvalidIDToken)
+}
+
+func TestVerifyIDTokenRefetchesRotatedKeys(t *testing.T) {
+	mock, provider := newTestProvider(t)
+	ctx := context.Background()
+
+	_, err := provider.VerifyIDToken(ctx, mock.SignIDToken(idTokenClaims(mock)), "n-0S6_WzA2Mj")
+	assert.NoError(t, err)
+
+	mock.RotateKey()
+
+	_, err = provider.VerifyIDToken(ctx, mock.SignIDToken(idTokenClaims(mock)), "n-0S6_WzA2Mj")
+	assert.NoError(t, err)
+}
+
+func TestDiscoveryIssuerMismatch(t *testing.T) {
+	mock := oidctest.NewProvider(t, "chirpy", "s3cret")
+
+	provider := oidc.NewProvider(oidc.Config{
+		Issuer:   mock.Issuer() + "/",
+		ClientID: "chirpy",
+	}, nil)
+
+	_, err := provider.AuthCodeURL(context.Background(), "state", "nonce", "verifier")
+	assert.Error(t, err)
+}
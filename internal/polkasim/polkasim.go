@@ -0,0 +1,276 @@
+// Package polkasim imitates Polka's webhook delivery so the Chirpy webhook
+// handler can be exercised without the real service. Like Polka, it signs
+// each delivery and retries ones that fail. It can also send duplicates
+// and deliver events out of order.
+package polkasim
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	mathrand "math/rand/v2"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Cmolloy36/Chirpy/internal/auth"
+	"github.com/google/uuid"
+)
+
+const (
+	DefaultMaxAttempts  = 3
+	DefaultRetryBackoff = time.Second
+)
+
+type Data struct {
+	UserID           uuid.UUID  `json:"user_id"`
+	Plan             string     `json:"plan,omitempty"`
+	CurrentPeriodEnd *time.Time `json:"current_period_end,omitempty"`
+}
+
+// Event is a webhook body in Polka's format.
+type Event struct {
+	ID        string    `json:"id"`
+	Event     string    `json:"event"`
+	CreatedAt time.Time `json:"created_at"`
+	Data      Data      `json:"data"`
+}
+
+var (
+	clockMu       sync.Mutex
+	lastCreatedAt time.Time
+)
+
+// nextCreatedAt is the current time to the microsecond, the precision
+// Chirpy stores, moved on if needed so that events made in a row keep
+// their order.
+func nextCreatedAt() time.Time {
+	clockMu.Lock()
+	defer clockMu.Unlock()
+
+	now := time.Now().UTC().Truncate(time.Microsecond)
+	if !now.After(lastCreatedAt) {
+		now = lastCreatedAt.Add(time.Microsecond)
+	}
+	lastCreatedAt = now
+
+	return now
+}
+
+// NewEvent returns an event of type eventType for userID with a fresh ID,
+// stamped with the current time. Each event is stamped later than the one
+// made before it.
+func NewEvent(eventType string, userID uuid.UUID) Event {
+	b := make([]byte, 12)
+	rand.Read(b)
+
+	return Event{
+		ID:        "evt_" + hex.EncodeToString(b),
+		Event:     eventType,
+		CreatedAt: nextCreatedAt(),
+		Data:      Data{UserID: userID},
+	}
+}
+
+type Config struct {
+	// URL is Chirpy's webhook endpoint.
+	URL string
+	// Secrets sign each delivery; with several, the signature header
+	// carries one signature per secret, as during a rotation. Without
+	// secrets the legacy "Authorization: ApiKey" header is sent instead.
+	Secrets []string
+	APIKey  string
+
+	// MaxAttempts is how many times a delivery is tried before Polka gives
+	// up on it. Anything other than a 2xx response counts as a failure.
+	MaxAttempts  int
+	RetryBackoff time.Duration
+
+	// DuplicateRate is the chance that an event is delivered a second
+	// time after it succeeded.
+	DuplicateRate float64
+	// OutOfOrder shuffles the events before delivery.
+	OutOfOrder bool
+	// Seed makes duplicates and shuffling repeatable. Zero picks a random
+	// seed.
+	Seed uint64
+
+	HTTPClient *http.Client
+	// Now is the clock used for signature timestamps.
+	Now func() time.Time
+}
+
+// Attempt is the outcome of one HTTP request.
+type Attempt struct {
+	Event      Event
+	Number     int
+	Duplicate  bool
+	StatusCode int
+	Err        error
+}
+
+func (a Attempt) Succeeded() bool {
+	return a.Err == nil && a.StatusCode >= 200 && a.StatusCode < 300
+}
+
+func (a Attempt) String() string {
+	label := ""
+	if a.Duplicate {
+		label = " (duplicate)"
+	}
+
+	result := strconv.Itoa(a.StatusCode)
+	if a.Err != nil {
+		result = a.Err.Error()
+	}
+
+	return fmt.Sprintf("%s %s%s attempt %d: %s", a.Event.ID, a.Event.Event, label, a.Number, result)
+}
+
+type Simulator struct {
+	config Config
+	rand   *mathrand.Rand
+}
+
+func New(config Config) *Simulator {
+	if config.MaxAttempts <= 0 {
+		config.MaxAttempts = DefaultMaxAttempts
+	}
+	if config.RetryBackoff < 0 {
+		config.RetryBackoff = 0
+	}
+	if config.HTTPClient == nil {
+		config.HTTPClient = &http.Client{Timeout: 10 * time.Second}
+	}
+	if config.Now == nil {
+		config.Now = time.Now
+	}
+	if config.Seed == 0 {
+		config.Seed = mathrand.Uint64()
+	}
+
+	return &Simulator{
+		config: config,
+		rand:   mathrand.New(mathrand.NewPCG(config.Seed, config.Seed)),
+	}
+}
+
+type delivery struct {
+	event     Event
+	duplicate bool
+}
+
+// Send delivers events, retrying each until it succeeds or runs out of
+// attempts, and returns every attempt made in order. It stops early only
+// if ctx is cancelled.
+func (s *Simulator) Send(ctx context.Context, events ...Event) []Attempt {
+	var attempts []Attempt
+
+	for _, d := range s.schedule(events) {
+		for number := 1; number <= s.config.MaxAttempts; number++ {
+			if number > 1 {
+				select {
+				case <-ctx.Done():
+					return attempts
+				case <-time.After(s.config.RetryBackoff << (number - 2)):
+				}
+			}
+
+			statusCode, err := s.deliver(ctx, d.event)
+
+			attempt := Attempt{
+				Event:      d.event,
+				Number:     number,
+				Duplicate:  d.duplicate,
+				StatusCode: statusCode,
+				Err:        err,
+			}
+			attempts = append(attempts, attempt)
+
+			if attempt.Succeeded() || ctx.Err() != nil {
+				break
+			}
+		}
+	}
+
+	return attempts
+}
+
+// schedule decides the delivery order. Duplicates are scheduled after the
+// original so that, as with Polka, they look like redeliveries.
+func (s *Simulator) schedule(events []Event) []delivery {
+	deliveries := make([]delivery, 0, len(events))
+	for _, event := range events {
+		deliveries = append(deliveries, delivery{event: event})
+	}
+
+	if s.config.OutOfOrder {
+		s.rand.Shuffle(len(deliveries), func(i, j int) {
+			deliveries[i], deliveries[j] = deliveries[j], deliveries[i]
+		})
+	}
+
+	for _, event := range events {
+		if s.rand.Float64() >= s.config.DuplicateRate {
+			continue
+		}
+
+		// Insert somewhere after the original delivery.
+		original := 0
+		for i, d := range deliveries {
+			if !d.duplicate && d.event.ID == event.ID {
+				original = i
+				break
+			}
+		}
+
+		at := original + 1 + s.rand.IntN(len(deliveries)-original)
+		deliveries = append(deliveries[:at], append([]delivery{{event: event, duplicate: true}}, deliveries[at:]...)...)
+	}
+
+	return deliveries
+}
+
+func (s *Simulator) deliver(ctx context.Context, event Event) (int, error) {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return 0, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.config.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Polka-Event-ID", event.ID)
+
+	if len(s.config.Secrets) > 0 {
+		timestamp := s.config.Now().Unix()
+
+		signatures := make([]string, len(s.config.Secrets))
+		for i, secret := range s.config.Secrets {
+			signatures[i] = auth.SignWebhook(secret, timestamp, body)
+		}
+
+		req.Header.Set(auth.WebhookTimestampHeader, strconv.FormatInt(timestamp, 10))
+		req.Header.Set(auth.WebhookSignatureHeader, strings.Join(signatures, ","))
+	} else if s.config.APIKey != "" {
+		req.Header.Set("Authorization", "ApiKey "+s.config.APIKey)
+	}
+
+	res, err := s.config.HTTPClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer res.Body.Close()
+
+	io.Copy(io.Discard, res.Body)
+
+	return res.StatusCode, nil
+}
@@ -0,0 +1,164 @@
+package polkasim_test
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Cmolloy36/Chirpy/internal/auth"
+	"github.com/Cmolloy36/Chirpy/internal/polkasim"
+	"github.com/Cmolloy36/Chirpy/internal/polkasim/polkasimtest"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+// receiver stands in for Chirpy: it verifies signatures, fails the first
+// failFirst requests for each event and records the rest.
+type receiver struct {
+	verifier  auth.WebhookVerifier
+	failFirst int
+
+	mu       sync.Mutex
+	seen     map[string]int
+	accepted []string
+}
+
+func newReceiver(t *testing.T, secret string, failFirst int) (*receiver, string) {
+	rec := &receiver{
+		verifier:  auth.WebhookVerifier{Secrets: []string{secret}, Tolerance: auth.DefaultWebhookTolerance},
+		failFirst: failFirst,
+		seen:      map[string]int{},
+	}
+
+	server := httptest.NewServer(rec)
+	t.Cleanup(server.Close)
+
+	return rec, server.URL
+}
+
+func (rec *receiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+
+	if err := rec.verifier.Verify(r.Header, body, time.Now()); err != nil {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	var event polkasim.Event
+	if err := json.Unmarshal(body, &event); err != nil || r.Header.Get("X-Polka-Event-ID") != event.ID {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+
+	rec.seen[event.ID]++
+	if rec.seen[event.ID] <= rec.failFirst {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	rec.accepted = append(rec.accepted, event.ID)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func newEvents(n int) []polkasim.Event {
+	userID := uuid.New()
+
+	events := make([]polkasim.Event, n)
+	for i := range events {
+		events[i] = polkasim.NewEvent("subscription.renewed", userID)
+	}
+
+	return events
+}
+
+func TestSendRetries(t *testing.T) {
+	rec, url := newReceiver(t, "secret", 2)
+	events := newEvents(3)
+
+	attempts := polkasimtest.NewSimulator(t, url, "secret").Send(t.Context(), events...)
+
+	polkasimtest.RequireDelivered(t, attempts)
+	assert.Len(t, attempts, 9)
+	assert.Equal(t, http.StatusInternalServerError, attempts[0].StatusCode)
+	assert.Equal(t, 3, attempts[2].Number)
+	assert.Equal(t, []string{events[0].ID, events[1].ID, events[2].ID}, rec.accepted)
+}
+
+func TestSendGivesUp(t *testing.T) {
+	rec, url := newReceiver(t, "secret", 5)
+	events := newEvents(1)
+
+	attempts := polkasimtest.NewSimulator(t, url, "secret").Send(t.Context(), events...)
+
+	assert.Len(t, attempts, polkasim.DefaultMaxAttempts)
+	assert.False(t, attempts[len(attempts)-1].Succeeded())
+	assert.Empty(t, rec.accepted)
+}
+
+func TestSendDuplicatesAndReorders(t *testing.T) {
+	rec, url := newReceiver(t, "secret", 0)
+	events := newEvents(20)
+
+	simulator := polkasimtest.NewSimulator(t, url, "secret", func(config *polkasim.Config) {
+		config.DuplicateRate = 1
+		config.OutOfOrder = true
+	})
+
+	attempts := simulator.Send(t.Context(), events...)
+	polkasimtest.RequireDelivered(t, attempts)
+
+	assert.Len(t, rec.accepted, 40)
+
+	firstSeen := map[string]int{}
+	for i, id := range rec.accepted {
+		if _, ok := firstSeen[id]; !ok {
+			firstSeen[id] = i
+		}
+	}
+
+	delivered := map[string]bool{}
+	for _, attempt := range attempts {
+		if attempt.Duplicate {
+			assert.True(t, delivered[attempt.Event.ID], "duplicate of %s sent before the original", attempt.Event.ID)
+		}
+		delivered[attempt.Event.ID] = true
+	}
+
+	inOrder := true
+	for i := 1; i < len(events); i++ {
+		if firstSeen[events[i].ID] < firstSeen[events[i-1].ID] {
+			inOrder = false
+		}
+	}
+	assert.False(t, inOrder, "expected events to be delivered out of order")
+}
+
+func TestSendRotatingSecrets(t *testing.T) {
+	rec, url := newReceiver(t, "new-secret", 0)
+
+	simulator := polkasimtest.NewSimulator(t, url, "old-secret", func(config *polkasim.Config) {
+		config.Secrets = append(config.Secrets, "new-secret")
+	})
+
+	polkasimtest.RequireDelivered(t, simulator.Send(t.Context(), newEvents(1)...))
+	assert.Len(t, rec.accepted, 1)
+}
+
+func TestSendStaleTimestamp(t *testing.T) {
+	_, url := newReceiver(t, "secret", 0)
+
+	simulator := polkasimtest.NewSimulator(t, url, "secret", func(config *polkasim.Config) {
+		config.MaxAttempts = 1
+		config.Now = func() time.Time { return time.Now().Add(-time.Hour) }
+	})
+
+	attempts := simulator.Send(t.Context(), newEvents(1)...)
+	assert.Equal(t, http.StatusUnauthorized, attempts[0].StatusCode)
+}
@@ -0,0 +1,57 @@
+// Package polkasimtest wires the Polka simulator into Go tests: deliveries
+// are repeatable and retries don't sleep.
+package polkasimtest
+
+import (
+	"hash/fnv"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/Cmolloy36/Chirpy/internal/polkasim"
+)
+
+// NewSimulator returns a simulator that signs with secret and posts to
+// webhookURL. The seed is derived from the test name, so a failing run
+// replays the same order and duplicates. configure can change the config
+// before the simulator is built, e.g. to turn on duplicates.
+func NewSimulator(t testing.TB, webhookURL, secret string, configure ...func(*polkasim.Config)) *polkasim.Simulator {
+	t.Helper()
+
+	seed := fnv.New64a()
+	seed.Write([]byte(t.Name()))
+
+	config := polkasim.Config{
+		URL:          webhookURL,
+		Secrets:      []string{secret},
+		MaxAttempts:  polkasim.DefaultMaxAttempts,
+		RetryBackoff: 0,
+		Seed:         seed.Sum64() | 1,
+		HTTPClient:   &http.Client{Timeout: 5 * time.Second},
+	}
+
+	for _, fn := range configure {
+		fn(&config)
+	}
+
+	return polkasim.New(config)
+}
+
+// RequireDelivered fails the test unless every event in attempts was
+// eventually accepted.
+func RequireDelivered(t testing.TB, attempts []polkasim.Attempt) {
+	t.Helper()
+
+	delivered := map[string]bool{}
+	for _, attempt := range attempts {
+		if attempt.Succeeded() {
+			delivered[attempt.Event.ID] = true
+		}
+	}
+
+	for _, attempt := range attempts {
+		if !delivered[attempt.Event.ID] {
+			t.Fatalf("event %s was never delivered: %s", attempt.Event.ID, attempt)
+		}
+	}
+}
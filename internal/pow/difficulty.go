@@ -0,0 +1,166 @@
+package pow
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultBaseDifficulty  = 16
+	DefaultMaxDifficulty   = 24
+	DefaultGlobalThreshold = 600
+	DefaultClientThreshold = 10
+
+	// DefaultChallengeTTL is how long a client has to solve a challenge and
+	// use it.
+	DefaultChallengeTTL = 5 * time.Minute
+
+	volumeWindow = time.Minute
+)
+
+// DifficultyPolicy decides how hard challenges are. Difficulty starts at
+// Base and goes up one bit, doubling the expected work, each time the
+// number of challenges requested in the last minute doubles past a
+// threshold: GlobalThreshold for all clients together, ClientThreshold for
+// one client. It never exceeds Max.
+type DifficultyPolicy struct {
+	Base            int
+	Max             int
+	GlobalThreshold int
+	ClientThreshold int
+}
+
+func DefaultDifficultyPolicy() DifficultyPolicy {
+	return DifficultyPolicy{
+		Base:            DefaultBaseDifficulty,
+		Max:             DefaultMaxDifficulty,
+		GlobalThreshold: DefaultGlobalThreshold,
+		ClientThreshold: DefaultClientThreshold,
+	}
+}
+
+// DifficultyPolicyFromEnv starts from DefaultDifficultyPolicy and applies
+// POW_DIFFICULTY, POW_MAX_DIFFICULTY, POW_GLOBAL_THRESHOLD and
+// POW_CLIENT_THRESHOLD. A threshold of 0 turns that adjustment off.
+func DifficultyPolicyFromEnv() (DifficultyPolicy, error) {
+	policy := DefaultDifficultyPolicy()
+
+	envInts := []struct {
+		name  string
+		value *int
+	}{
+		{"POW_DIFFICULTY", &policy.Base},
+		{"POW_MAX_DIFFICULTY", &policy.Max},
+		{"POW_GLOBAL_THRESHOLD", &policy.GlobalThreshold},
+		{"POW_CLIENT_THRESHOLD", &policy.ClientThreshold},
+	}
+
+	for _, envInt := range envInts {
+		val := os.Getenv(envInt.name)
+		if val == "" {
+			continue
+		}
+
+		n, err := strconv.Atoi(val)
+		if err != nil || n < 0 {
+			return DifficultyPolicy{}, fmt.Errorf("invalid %s %q: must be a non-negative integer", envInt.name, val)
+		}
+
+		*envInt.value = n
+	}
+
+	if policy.Max > MaxDifficulty {
+		return DifficultyPolicy{}, fmt.Errorf("POW_MAX_DIFFICULTY %d exceeds %d", policy.Max, MaxDifficulty)
+	}
+
+	if policy.Base > policy.Max {
+		return DifficultyPolicy{}, fmt.Errorf("POW_DIFFICULTY %d exceeds POW_MAX_DIFFICULTY %d", policy.Base, policy.Max)
+	}
+
+	return policy, nil
+}
+
+// Difficulty returns the difficulty for the given request volumes.
+func (p DifficultyPolicy) Difficulty(globalVolume, clientVolume int) int {
+	extra := max(extraBits(globalVolume, p.GlobalThreshold), extraBits(clientVolume, p.ClientThreshold))
+
+	return min(p.Base+extra, p.Max)
+}
+
+func extraBits(volume, threshold int) int {
+	if threshold <= 0 {
+		return 0
+	}
+
+	n := 0
+	for ; volume > threshold; volume /= 2 {
+		n++
+	}
+
+	return n
+}
+
+// Adaptive counts challenge requests and prices each new challenge with a
+// DifficultyPolicy. Counts are kept in memory per server, over a sliding
+// one-minute window.
+type Adaptive struct {
+	policy DifficultyPolicy
+
+	mu          sync.Mutex
+	windowStart time.Time
+	current     map[string]int
+	previous    map[string]int
+}
+
+func NewAdaptive(policy DifficultyPolicy) *Adaptive {
+	return &Adaptive{
+		policy:   policy,
+		current:  map[string]int{},
+		previous: map[string]int{},
+	}
+}
+
+// Next records a challenge request from client and returns the difficulty
+// to issue it at.
+func (a *Adaptive) Next(client string, now time.Time) int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.roll(now)
+
+	a.current[""]++
+
+	clientVolume := 0
+	if client != "" {
+		a.current[client]++
+		clientVolume = a.volume(client, now)
+	}
+
+	return a.policy.Difficulty(a.volume("", now), clientVolume)
+}
+
+func (a *Adaptive) roll(now time.Time) {
+	switch elapsed := now.Sub(a.windowStart); {
+	case elapsed < volumeWindow:
+		return
+	case elapsed < 2*volumeWindow:
+		a.previous = a.current
+	default:
+		a.previous = map[string]int{}
+	}
+
+	a.current = map[string]int{}
+	a.windowStart = now.Truncate(volumeWindow)
+}
+
+// volume estimates key's requests in the last minute by weighting the previous
+// window by how much of it is still inside that minute.
+func (a *Adaptive) volume(key string, now time.Time) int {
+	remaining := volumeWindow - now.Sub(a.windowStart)
+	weighted := int64(a.previous[key]) * int64(remaining) / int64(volumeWindow)
+
+	return a.current[key] + int(weighted)
+}
@@ -0,0 +1,112 @@
+package pow
+
+import (
+	"encoding/base64"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestChallenge(t *testing.T) {
+	now := time.Now()
+	issuer := NewIssuer("secret", DefaultChallengeTTL)
+
+	challenge, err := issuer.Issue(8, now)
+	assert.NoError(t, err)
+	assert.Equal(t, 8, challenge.Difficulty)
+
+	solution := Solve(challenge.Token, challenge.Difficulty)
+
+	verified, err := issuer.Verify(challenge.Token, solution, now)
+	assert.NoError(t, err)
+	assert.Equal(t, challenge.Nonce, verified.Nonce)
+	assert.Equal(t, challenge.Difficulty, verified.Difficulty)
+	assert.True(t, challenge.ExpiresAt.Equal(verified.ExpiresAt))
+
+	other, err := issuer.Issue(8, now)
+	assert.NoError(t, err)
+	assert.NotEqual(t, challenge.Nonce, other.Nonce)
+}
+
+func TestVerifyRejects(t *testing.T) {
+	now := time.Now()
+	issuer := NewIssuer("secret", DefaultChallengeTTL)
+
+	challenge, err := issuer.Issue(12, now)
+	assert.NoError(t, err)
+
+	solution := Solve(challenge.Token, challenge.Difficulty)
+
+	_, err = issuer.Verify(challenge.Token, solution, now.Add(DefaultChallengeTTL+time.Second))
+	assert.ErrorIs(t, err, ErrInvalidChallenge)
+
+	_, err = NewIssuer("other", DefaultChallengeTTL).Verify(challenge.Token, solution, now)
+	assert.ErrorIs(t, err, ErrInvalidChallenge)
+
+	// Lowering the difficulty in the payload breaks the signature.
+	encoded, sig, _ := strings.Cut(challenge.Token, ".")
+	payload, _ := base64.RawURLEncoding.DecodeString(encoded)
+	payload[16] = 0
+	tampered := base64.RawURLEncoding.EncodeToString(payload) + "." + sig
+	_, err = issuer.Verify(tampered, "0", now)
+	assert.ErrorIs(t, err, ErrInvalidChallenge)
+
+	wrong := "x"
+	for Solves(challenge.Token, wrong, challenge.Difficulty) {
+		wrong += "x"
+	}
+	_, err = issuer.Verify(challenge.Token, wrong, now)
+	assert.ErrorIs(t, err, ErrInvalidSolution)
+}
+
+func TestLeadingZeroBits(t *testing.T) {
+	assert.Equal(t, 0, leadingZeroBits([]byte{0x80}))
+	assert.Equal(t, 3, leadingZeroBits([]byte{0x10, 0xff}))
+	assert.Equal(t, 12, leadingZeroBits([]byte{0x00, 0x08}))
+	assert.Equal(t, 16, leadingZeroBits([]byte{0x00, 0x00}))
+}
+
+func TestDifficultyPolicy(t *testing.T) {
+	policy := DifficultyPolicy{Base: 16, Max: 20, GlobalThreshold: 100, ClientThreshold: 10}
+
+	assert.Equal(t, 16, policy.Difficulty(100, 10))
+	assert.Equal(t, 17, policy.Difficulty(101, 0))
+	assert.Equal(t, 18, policy.Difficulty(0, 40))
+	assert.Equal(t, 20, policy.Difficulty(1_000_000, 0))
+
+	policy.GlobalThreshold = 0
+	assert.Equal(t, 16, policy.Difficulty(1_000_000, 0))
+}
+
+func TestAdaptive(t *testing.T) {
+	start := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	adaptive := NewAdaptive(DifficultyPolicy{Base: 10, Max: 20, GlobalThreshold: 100, ClientThreshold: 2})
+
+	assert.Equal(t, 10, adaptive.Next("203.0.113.1", start))
+	assert.Equal(t, 10, adaptive.Next("203.0.113.1", start))
+	assert.Equal(t, 11, adaptive.Next("203.0.113.1", start))
+	assert.Equal(t, 10, adaptive.Next("203.0.113.2", start))
+
+	// Half a minute into the next window, half the old requests still count.
+	assert.Equal(t, 10, adaptive.Next("203.0.113.1", start.Add(90*time.Second)))
+
+	// Two minutes later everything has been forgotten.
+	assert.Equal(t, 10, adaptive.Next("203.0.113.1", start.Add(5*time.Minute)))
+}
+
+func TestDifficultyPolicyFromEnv(t *testing.T) {
+	t.Setenv("POW_DIFFICULTY", "12")
+	t.Setenv("POW_CLIENT_THRESHOLD", "0")
+
+	policy, err := DifficultyPolicyFromEnv()
+	assert.NoError(t, err)
+	assert.Equal(t, 12, policy.Base)
+	assert.Equal(t, DefaultMaxDifficulty, policy.Max)
+	assert.Equal(t, 0, policy.ClientThreshold)
+
+	t.Setenv("POW_DIFFICULTY", "30")
+	_, err = DifficultyPolicyFromEnv()
+	assert.Error(t, err)
+}
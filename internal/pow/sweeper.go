@@ -0,0 +1,41 @@
+package pow
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/Cmolloy36/Chirpy/internal/database"
+)
+
+// Sweeper deletes the nonces of spent challenges once the challenges have
+// expired, since an expired challenge is rejected anyway.
+type Sweeper struct {
+	dbQueries *database.Queries
+}
+
+func NewSweeper(dbQueries *database.Queries) *Sweeper {
+	return &Sweeper{dbQueries: dbQueries}
+}
+
+// Run deletes expired spent challenges every interval until ctx is
+// cancelled.
+func (s *Sweeper) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		deleted, err := s.dbQueries.DeleteExpiredSpentChallenges(ctx)
+		if err != nil && ctx.Err() == nil {
+			log.Printf("Error deleting expired challenges: %s", err)
+		} else if deleted > 0 {
+			log.Printf("Deleted %d expired challenges", deleted)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
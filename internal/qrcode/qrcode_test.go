@@ -0,0 +1,131 @@
+package qrcode
+
+import (
+	"bytes"
+	"image/png"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReedSolomonHelloWorld(t *testing.T) {
+	// "HELLO WORLD" at 1-M, from the ISO/IEC 18004 worked example.
+	data := []byte{32, 91, 11, 120, 209, 114, 220, 77, 67, 64, 236, 17, 236, 17, 236, 17}
+	expected := []byte{196, 35, 39, 119, 235, 215, 231, 226, 93, 23}
+
+	assert.Equal(t, expected, rsRemainder(data, rsDivisor(10)))
+}
+
+func TestFormatBits(t *testing.T) {
+	assert.Equal(t, 0b101010000010010, formatBits(0))
+	assert.Equal(t, 0b100010111111001, formatBits(4))
+}
+
+// readBack undoes Encode: it reads the format bits, removes the mask and
+// de-interleaves the data codewords.
+func readBack(t *testing.T, code *Code) []byte {
+	t.Helper()
+
+	format := 0
+	for i := 0; i <= 5; i++ {
+		if code.Modules[i][8] {
+			format |= 1 << i
+		}
+	}
+	mask := -1
+	for m := 0; m < 8; m++ {
+		if formatBits(m)&0x3F == format {
+			mask = m
+		}
+	}
+	if mask < 0 {
+		t.Fatalf("could not read mask from format bits")
+	}
+
+	ref := newCode(code.Version)
+	ref.drawFunctionPatterns()
+
+	var bits bitBuffer
+	for right := code.Size - 1; right >= 1; right -= 2 {
+		if right == 6 {
+			right = 5
+		}
+		upward := (right+1)&2 == 0
+		for vert := 0; vert < code.Size; vert++ {
+			for j := 0; j < 2; j++ {
+				x, y := right-j, vert
+				if upward {
+					y = code.Size - 1 - vert
+				}
+				if ref.isFunction[y][x] {
+					continue
+				}
+				bits = append(bits, code.Modules[y][x] != maskBit(mask, x, y))
+			}
+		}
+	}
+
+	layout := levelMBlocks[code.Version]
+	numBlocks := layout.shortBlocks + layout.longBlocks
+	blocks := make([][]byte, numBlocks)
+	pos := 0
+	for i := 0; i <= layout.shortData; i++ {
+		for b := 0; b < numBlocks; b++ {
+			if i == layout.shortData && b < layout.shortBlocks {
+				continue
+			}
+			val := byte(0)
+			for k := 0; k < 8; k++ {
+				if bits[pos] {
+					val |= 1 << (7 - k)
+				}
+				pos++
+			}
+			blocks[b] = append(blocks[b], val)
+		}
+	}
+
+	return bytes.Join(blocks, nil)
+}
+
+func TestEncodeRoundTrip(t *testing.T) {
+	inputs := []string{
+		"hi",
+		"otpauth://totp/Chirpy:saul@bettercall.com?secret=JBSWY3DPEHPK3PXP&issuer=Chirpy",
+		strings.Repeat("x", 200),
+	}
+
+	for _, input := range inputs {
+		code, err := Encode([]byte(input))
+		if err != nil {
+			t.Fatalf("error encoding %q: %v", input, err)
+		}
+
+		assert.Equal(t, encodeData(code.Version, []byte(input)), readBack(t, code))
+	}
+}
+
+func TestEncodeTooLong(t *testing.T) {
+	_, err := Encode([]byte(strings.Repeat("x", 300)))
+	assert.ErrorIs(t, err, ErrDataTooLong)
+}
+
+func TestPNG(t *testing.T) {
+	code, err := Encode([]byte("hello"))
+	if err != nil {
+		t.Fatalf("error encoding: %v", err)
+	}
+
+	dat, err := code.PNG(4)
+	if err != nil {
+		t.Fatalf("error rendering png: %v", err)
+	}
+
+	img, err := png.Decode(bytes.NewReader(dat))
+	if err != nil {
+		t.Fatalf("error decoding png: %v", err)
+	}
+
+	assert.Equal(t, (code.Size+2*quietZone)*4, img.Bounds().Dx())
+}
@@ -0,0 +1,391 @@
+// Package webauthn implements the server side of WebAuthn registration and
+// assertion ceremonies for passkeys. Only ES256 (P-256) credentials and
+// "none" attestation are supported, which covers platform passkeys.
+package webauthn
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+)
+
+const (
+	ChallengeSize    = 32
+	CeremonyTimeout  = 5 * time.Minute
+	algES256         = -7
+	coseKeyTypeEC2   = 2
+	coseCurveP256    = 1
+	flagUserPresent  = 0x01
+	flagAttestedData = 0x40
+)
+
+var (
+	ErrChallengeMismatch  = errors.New("webauthn: challenge does not match")
+	ErrOriginMismatch     = errors.New("webauthn: origin does not match")
+	ErrRPIDMismatch       = errors.New("webauthn: relying party ID does not match")
+	ErrUserNotPresent     = errors.New("webauthn: user presence flag not set")
+	ErrBadSignature       = errors.New("webauthn: signature verification failed")
+	ErrSignCountRegressed = errors.New("webauthn: signature counter did not increase, authenticator may be cloned")
+	ErrUnsupportedKey     = errors.New("webauthn: only ES256 credentials are supported")
+)
+
+// Config identifies the relying party. RPID is the registrable domain
+// (e.g. "chirpy.example") and Origin the exact web origin the browser reports.
+type Config struct {
+	RPID   string
+	RPName string
+	Origin string
+}
+
+// URLEncodedBase64 is a []byte that marshals to unpadded base64url, the
+// encoding the WebAuthn JSON serialization uses for binary fields.
+type URLEncodedBase64 []byte
+
+func (b URLEncodedBase64) MarshalJSON() ([]byte, error) {
+	return json.Marshal(base64.RawURLEncoding.EncodeToString(b))
+}
+
+func (b *URLEncodedBase64) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+
+	decoded, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(s, "="))
+	if err != nil {
+		return err
+	}
+
+	*b = decoded
+	return nil
+}
+
+func NewChallenge() ([]byte, error) {
+	b := make([]byte, ChallengeSize)
+	if _, err := rand.Read(b); err != nil {
+		return nil, err
+	}
+
+	return b, nil
+}
+
+type RelyingParty struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+type UserEntity struct {
+	ID          URLEncodedBase64 `json:"id"`
+	Name        string           `json:"name"`
+	DisplayName string           `json:"displayName"`
+}
+
+type CredentialParameter struct {
+	Type string `json:"type"`
+	Alg  int    `json:"alg"`
+}
+
+type CredentialDescriptor struct {
+	Type string           `json:"type"`
+	ID   URLEncodedBase64 `json:"id"`
+}
+
+type AuthenticatorSelection struct {
+	ResidentKey      string `json:"residentKey"`
+	UserVerification string `json:"userVerification"`
+}
+
+// CreationOptions is PublicKeyCredentialCreationOptions for
+// navigator.credentials.create().
+type CreationOptions struct {
+	Challenge              URLEncodedBase64       `json:"challenge"`
+	RP                     RelyingParty           `json:"rp"`
+	User                   UserEntity             `json:"user"`
+	PubKeyCredParams       []CredentialParameter  `json:"pubKeyCredParams"`
+	Timeout                int64                  `json:"timeout"`
+	ExcludeCredentials     []CredentialDescriptor `json:"excludeCredentials"`
+	AuthenticatorSelection AuthenticatorSelection `json:"authenticatorSelection"`
+	Attestation            string                 `json:"attestation"`
+}
+
+// RequestOptions is PublicKeyCredentialRequestOptions for
+// navigator.credentials.get().
+type RequestOptions struct {
+	Challenge        URLEncodedBase64       `json:"challenge"`
+	RPID             string                 `json:"rpId"`
+	Timeout          int64                  `json:"timeout"`
+	AllowCredentials []CredentialDescriptor `json:"allowCredentials"`
+	UserVerification string                 `json:"userVerification"`
+}
+
+func descriptors(credentialIDs [][]byte) []CredentialDescriptor {
+	out := make([]CredentialDescriptor, len(credentialIDs))
+	for i, id := range credentialIDs {
+		out[i] = CredentialDescriptor{Type: "public-key", ID: id}
+	}
+	return out
+}
+
+func (c Config) CreationOptions(challenge, userHandle []byte, userName string, existing [][]byte) CreationOptions {
+	return CreationOptions{
+		Challenge: challenge,
+		RP:        RelyingParty{ID: c.RPID, Name: c.RPName},
+		User: UserEntity{
+			ID:          userHandle,
+			Name:        userName,
+			DisplayName: userName,
+		},
+		PubKeyCredParams:   []CredentialParameter{{Type: "public-key", Alg: algES256}},
+		Timeout:            CeremonyTimeout.Milliseconds(),
+		ExcludeCredentials: descriptors(existing),
+		AuthenticatorSelection: AuthenticatorSelection{
+			ResidentKey:      "preferred",
+			UserVerification: "preferred",
+		},
+		Attestation: "none",
+	}
+}
+
+func (c Config) RequestOptions(challenge []byte, allowed [][]byte) RequestOptions {
+	return RequestOptions{
+		Challenge:        challenge,
+		RPID:             c.RPID,
+		Timeout:          CeremonyTimeout.Milliseconds(),
+		AllowCredentials: descriptors(allowed),
+		UserVerification: "preferred",
+	}
+}
+
+type clientData struct {
+	Type      string `json:"type"`
+	Challenge string `json:"challenge"`
+	Origin    string `json:"origin"`
+}
+
+func (c Config) verifyClientData(raw []byte, ceremony string, challenge []byte) error {
+	var cd clientData
+	if err := json.Unmarshal(raw, &cd); err != nil {
+		return fmt.Errorf("webauthn: invalid clientDataJSON: %w", err)
+	}
+
+	if cd.Type != ceremony {
+		return fmt.Errorf("webauthn: unexpected client data type %q", cd.Type)
+	}
+
+	got, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(cd.Challenge, "="))
+	if err != nil || subtle.ConstantTimeCompare(got, challenge) != 1 {
+		return ErrChallengeMismatch
+	}
+
+	if cd.Origin != c.Origin {
+		return ErrOriginMismatch
+	}
+
+	return nil
+}
+
+type authenticatorData struct {
+	rpIDHash     []byte
+	flags        byte
+	signCount    uint32
+	credentialID []byte
+	publicKey    []byte
+}
+
+func parseAuthenticatorData(data []byte) (authenticatorData, error) {
+	if len(data) < 37 {
+		return authenticatorData{}, errors.New("webauthn: authenticator data too short")
+	}
+
+	ad := authenticatorData{
+		rpIDHash:  data[:32],
+		flags:     data[32],
+		signCount: binary.BigEndian.Uint32(data[33:37]),
+	}
+
+	if ad.flags&flagAttestedData == 0 {
+		return ad, nil
+	}
+
+	rest := data[37:]
+	if len(rest) < 18 {
+		return authenticatorData{}, errors.New("webauthn: attested credential data too short")
+	}
+
+	idLen := int(binary.BigEndian.Uint16(rest[16:18]))
+	rest = rest[18:]
+	if len(rest) < idLen {
+		return authenticatorData{}, errors.New("webauthn: credential ID truncated")
+	}
+	ad.credentialID = rest[:idLen]
+	rest = rest[idLen:]
+
+	_, n, err := decodeCBOR(rest)
+	if err != nil {
+		return authenticatorData{}, fmt.Errorf("webauthn: invalid credential public key: %w", err)
+	}
+	ad.publicKey = rest[:n]
+
+	return ad, nil
+}
+
+func (c Config) verifyAuthenticatorData(ad authenticatorData) error {
+	rpIDHash := sha256.Sum256([]byte(c.RPID))
+	if !bytes.Equal(ad.rpIDHash, rpIDHash[:]) {
+		return ErrRPIDMismatch
+	}
+
+	if ad.flags&flagUserPresent == 0 {
+		return ErrUserNotPresent
+	}
+
+	return nil
+}
+
+// ParsePublicKey turns a COSE_Key into an ECDSA public key. Only EC2 keys on
+// P-256 used with ES256 are accepted.
+func ParsePublicKey(coseKey []byte) (*ecdsa.PublicKey, error) {
+	decoded, _, err := decodeCBOR(coseKey)
+	if err != nil {
+		return nil, err
+	}
+
+	m, ok := decoded.(map[any]any)
+	if !ok {
+		return nil, ErrUnsupportedKey
+	}
+
+	if m[int64(1)] != int64(coseKeyTypeEC2) || m[int64(3)] != int64(algES256) || m[int64(-1)] != int64(coseCurveP256) {
+		return nil, ErrUnsupportedKey
+	}
+
+	x, okX := m[int64(-2)].([]byte)
+	y, okY := m[int64(-3)].([]byte)
+	if !okX || !okY || len(x) != 32 || len(y) != 32 {
+		return nil, ErrUnsupportedKey
+	}
+
+	pub := &ecdsa.PublicKey{
+		Curve: elliptic.P256(),
+		X:     new(big.Int).SetBytes(x),
+		Y:     new(big.Int).SetBytes(y),
+	}
+	if !pub.Curve.IsOnCurve(pub.X, pub.Y) {
+		return nil, ErrUnsupportedKey
+	}
+
+	return pub, nil
+}
+
+type AttestationResponse struct {
+	ClientDataJSON    URLEncodedBase64 `json:"client_data_json"`
+	AttestationObject URLEncodedBase64 `json:"attestation_object"`
+}
+
+// Credential is what the relying party stores after registration.
+type Credential struct {
+	ID        []byte
+	PublicKey []byte // COSE_Key
+	SignCount uint32
+}
+
+// VerifyRegistration checks a navigator.credentials.create() response
+// against the challenge issued for it.
+func (c Config) VerifyRegistration(challenge []byte, resp AttestationResponse) (Credential, error) {
+	if err := c.verifyClientData(resp.ClientDataJSON, "webauthn.create", challenge); err != nil {
+		return Credential{}, err
+	}
+
+	decoded, _, err := decodeCBOR(resp.AttestationObject)
+	if err != nil {
+		return Credential{}, fmt.Errorf("webauthn: invalid attestation object: %w", err)
+	}
+
+	attObj, ok := decoded.(map[any]any)
+	if !ok {
+		return Credential{}, errors.New("webauthn: attestation object is not a map")
+	}
+
+	authDataBytes, ok := attObj["authData"].([]byte)
+	if !ok {
+		return Credential{}, errors.New("webauthn: attestation object missing authData")
+	}
+
+	ad, err := parseAuthenticatorData(authDataBytes)
+	if err != nil {
+		return Credential{}, err
+	}
+
+	if err := c.verifyAuthenticatorData(ad); err != nil {
+		return Credential{}, err
+	}
+
+	if ad.credentialID == nil {
+		return Credential{}, errors.New("webauthn: no attested credential data")
+	}
+
+	if _, err := ParsePublicKey(ad.publicKey); err != nil {
+		return Credential{}, err
+	}
+
+	return Credential{
+		ID:        ad.credentialID,
+		PublicKey: ad.publicKey,
+		SignCount: ad.signCount,
+	}, nil
+}
+
+type AssertionResponse struct {
+	ClientDataJSON    URLEncodedBase64 `json:"client_data_json"`
+	AuthenticatorData URLEncodedBase64 `json:"authenticator_data"`
+	Signature         URLEncodedBase64 `json:"signature"`
+	UserHandle        URLEncodedBase64 `json:"user_handle,omitempty"`
+}
+
+// VerifyAssertion checks a navigator.credentials.get() response signed by
+// the stored credential and returns the authenticator's new sign count.
+func (c Config) VerifyAssertion(challenge []byte, cred Credential, resp AssertionResponse) (uint32, error) {
+	if err := c.verifyClientData(resp.ClientDataJSON, "webauthn.get", challenge); err != nil {
+		return 0, err
+	}
+
+	ad, err := parseAuthenticatorData(resp.AuthenticatorData)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := c.verifyAuthenticatorData(ad); err != nil {
+		return 0, err
+	}
+
+	pub, err := ParsePublicKey(cred.PublicKey)
+	if err != nil {
+		return 0, err
+	}
+
+	clientDataHash := sha256.Sum256(resp.ClientDataJSON)
+	signed := append(append([]byte(nil), resp.AuthenticatorData...), clientDataHash[:]...)
+	digest := sha256.Sum256(signed)
+
+	if !ecdsa.VerifyASN1(pub, digest[:], resp.Signature) {
+		return 0, ErrBadSignature
+	}
+
+	// Authenticators that don't implement counters always report zero.
+	if (ad.signCount != 0 || cred.SignCount != 0) && ad.signCount <= cred.SignCount {
+		return 0, ErrSignCountRegressed
+	}
+
+	return ad.signCount, nil
+}
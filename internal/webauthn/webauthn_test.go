@@ -0,0 +1,228 @@
+package webauthn
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// encodeCBOR is the inverse of decodeCBOR for the value types it returns.
+// Map keys are emitted in a stable order.
+func encodeCBOR(v any) []byte {
+	head := func(major byte, n uint64) []byte {
+		switch {
+		case n < 24:
+			return []byte{major<<5 | byte(n)}
+		case n <= 0xff:
+			return []byte{major<<5 | 24, byte(n)}
+		case n <= 0xffff:
+			return binary.BigEndian.AppendUint16([]byte{major<<5 | 25}, uint16(n))
+		default:
+			return binary.BigEndian.AppendUint32([]byte{major<<5 | 26}, uint32(n))
+		}
+	}
+
+	switch val := v.(type) {
+	case int:
+		if val < 0 {
+			return head(1, uint64(-1-val))
+		}
+		return head(0, uint64(val))
+	case []byte:
+		return append(head(2, uint64(len(val))), val...)
+	case string:
+		return append(head(3, uint64(len(val))), val...)
+	case map[any]any:
+		keys := make([]any, 0, len(val))
+		for k := range val {
+			keys = append(keys, k)
+		}
+		sort.Slice(keys, func(i, j int) bool {
+			return string(encodeCBOR(keys[i])) < string(encodeCBOR(keys[j]))
+		})
+		out := head(5, uint64(len(val)))
+		for _, k := range keys {
+			out = append(out, encodeCBOR(k)...)
+			out = append(out, encodeCBOR(val[k])...)
+		}
+		return out
+	default:
+		panic("encodeCBOR: unsupported type")
+	}
+}
+
+// softwareAuthenticator behaves like a passkey authenticator: it holds one
+// P-256 key and signs with an incrementing counter.
+type softwareAuthenticator struct {
+	rpID         string
+	origin       string
+	credentialID []byte
+	key          *ecdsa.PrivateKey
+	signCount    uint32
+}
+
+func newSoftwareAuthenticator(t *testing.T, rpID, origin string) *softwareAuthenticator {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("error generating key: %v", err)
+	}
+
+	credentialID := make([]byte, 16)
+	rand.Read(credentialID)
+
+	return &softwareAuthenticator{rpID: rpID, origin: origin, credentialID: credentialID, key: key}
+}
+
+func (a *softwareAuthenticator) clientData(ceremony string, challenge []byte) []byte {
+	dat, _ := json.Marshal(clientData{
+		Type:      ceremony,
+		Challenge: base64.RawURLEncoding.EncodeToString(challenge),
+		Origin:    a.origin,
+	})
+	return dat
+}
+
+func (a *softwareAuthenticator) authData(flags byte, attested []byte) []byte {
+	rpIDHash := sha256.Sum256([]byte(a.rpID))
+	out := append(rpIDHash[:], flags)
+	out = binary.BigEndian.AppendUint32(out, a.signCount)
+	return append(out, attested...)
+}
+
+func (a *softwareAuthenticator) create(challenge []byte) AttestationResponse {
+	coseKey := encodeCBOR(map[any]any{
+		1:  coseKeyTypeEC2,
+		3:  algES256,
+		-1: coseCurveP256,
+		-2: a.key.X.FillBytes(make([]byte, 32)),
+		-3: a.key.Y.FillBytes(make([]byte, 32)),
+	})
+
+	attested := make([]byte, 16) // zero AAGUID
+	attested = binary.BigEndian.AppendUint16(attested, uint16(len(a.credentialID)))
+	attested = append(attested, a.credentialID...)
+	attested = append(attested, coseKey...)
+
+	attObj := encodeCBOR(map[any]any{
+		"fmt":      "none",
+		"attStmt":  map[any]any{},
+		"authData": a.authData(flagUserPresent|flagAttestedData, attested),
+	})
+
+	return AttestationResponse{
+		ClientDataJSON:    a.clientData("webauthn.create", challenge),
+		AttestationObject: attObj,
+	}
+}
+
+func (a *softwareAuthenticator) get(t *testing.T, challenge []byte) AssertionResponse {
+	t.Helper()
+
+	a.signCount++
+	authData := a.authData(flagUserPresent, nil)
+	cd := a.clientData("webauthn.get", challenge)
+
+	cdHash := sha256.Sum256(cd)
+	digest := sha256.Sum256(append(append([]byte(nil), authData...), cdHash[:]...))
+
+	sig, err := ecdsa.SignASN1(rand.Reader, a.key, digest[:])
+	if err != nil {
+		t.Fatalf("error signing assertion: %v", err)
+	}
+
+	return AssertionResponse{
+		ClientDataJSON:    cd,
+		AuthenticatorData: authData,
+		Signature:         sig,
+	}
+}
+
+var testConfig = Config{RPID: "localhost", RPName: "Chirpy", Origin: "http://localhost:8080"}
+
+func register(t *testing.T, authenticator *softwareAuthenticator) Credential {
+	t.Helper()
+
+	challenge, err := NewChallenge()
+	if err != nil {
+		t.Fatalf("error generating challenge: %v", err)
+	}
+
+	cred, err := testConfig.VerifyRegistration(challenge, authenticator.create(challenge))
+	if err != nil {
+		t.Fatalf("error verifying registration: %v", err)
+	}
+
+	return cred
+}
+
+func TestRegistrationAndAssertion(t *testing.T) {
+	authenticator := newSoftwareAuthenticator(t, testConfig.RPID, testConfig.Origin)
+	cred := register(t, authenticator)
+
+	assert.Equal(t, authenticator.credentialID, cred.ID)
+
+	challenge, _ := NewChallenge()
+	signCount, err := testConfig.VerifyAssertion(challenge, cred, authenticator.get(t, challenge))
+	assert.NoError(t, err)
+	assert.Equal(t, uint32(1), signCount)
+}
+
+func TestRegistrationWrongChallenge(t *testing.T) {
+	authenticator := newSoftwareAuthenticator(t, testConfig.RPID, testConfig.Origin)
+
+	challenge, _ := NewChallenge()
+	otherChallenge, _ := NewChallenge()
+
+	_, err := testConfig.VerifyRegistration(challenge, authenticator.create(otherChallenge))
+	assert.ErrorIs(t, err, ErrChallengeMismatch)
+}
+
+func TestAssertionWrongOrigin(t *testing.T) {
+	authenticator := newSoftwareAuthenticator(t, testConfig.RPID, "https://evil.example")
+
+	challenge, _ := NewChallenge()
+	_, err := testConfig.VerifyRegistration(challenge, authenticator.create(challenge))
+	assert.ErrorIs(t, err, ErrOriginMismatch)
+}
+
+func TestAssertionSignCountRegression(t *testing.T) {
+	authenticator := newSoftwareAuthenticator(t, testConfig.RPID, testConfig.Origin)
+	cred := register(t, authenticator)
+	cred.SignCount = 5
+
+	challenge, _ := NewChallenge()
+	_, err := testConfig.VerifyAssertion(challenge, cred, authenticator.get(t, challenge))
+	assert.ErrorIs(t, err, ErrSignCountRegressed)
+}
+
+func TestAssertionBadSignature(t *testing.T) {
+	authenticator := newSoftwareAuthenticator(t, testConfig.RPID, testConfig.Origin)
+	cred := register(t, authenticator)
+
+	challenge, _ := NewChallenge()
+	resp := authenticator.get(t, challenge)
+	resp.AuthenticatorData[len(resp.AuthenticatorData)-1] ^= 0xff
+
+	_, err := testConfig.VerifyAssertion(challenge, cred, resp)
+	assert.ErrorIs(t, err, ErrBadSignature)
+}
+
+func TestURLEncodedBase64JSON(t *testing.T) {
+	var b URLEncodedBase64
+	assert.NoError(t, json.Unmarshal([]byte(`"aGk_"`), &b))
+	assert.Equal(t, []byte("hi?"), []byte(b))
+
+	dat, err := json.Marshal(b)
+	assert.NoError(t, err)
+	assert.Equal(t, `"aGk_"`, string(dat))
+}
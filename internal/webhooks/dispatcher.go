@@ -0,0 +1,230 @@
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/Cmolloy36/Chirpy/internal/auth"
+	"github.com/Cmolloy36/Chirpy/internal/database"
+)
+
+const (
+	dispatchBatchSize = 20
+	MaxAttempts       = 8
+	baseBackoff       = 30 * time.Second
+	deliveryTimeout   = 10 * time.Second
+
+	// Only this much of a failed response is kept in the delivery log.
+	maxLoggedBody = 512
+)
+
+var errPrivateAddress = errors.New("webhook URL resolves to a private address")
+
+// nonPublicRanges are the ranges net.IP has no predicate for: "this
+// network" (0.0.0.0/8) and carrier-grade NAT (100.64.0.0/10), which can
+// reach hosts inside a cloud provider.
+var nonPublicRanges = parseCIDRs("0.0.0.0/8", "100.64.0.0/10")
+
+func parseCIDRs(cidrs ...string) []*net.IPNet {
+	ranges := make([]*net.IPNet, len(cidrs))
+	for i, cidr := range cidrs {
+		_, ipNet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(err)
+		}
+		ranges[i] = ipNet
+	}
+
+	return ranges
+}
+
+// Dispatcher delivers queued webhook events.
+type Dispatcher struct {
+	dbQueries *database.Queries
+	client    *http.Client
+}
+
+// NewDispatcher returns a Dispatcher. Unless allowPrivate is set, it
+// refuses to connect to loopback, private, link-local and carrier-grade
+// NAT addresses, so endpoints can't be used to reach Chirpy's own network.
+func NewDispatcher(dbQueries *database.Queries, allowPrivate bool) *Dispatcher {
+	return &Dispatcher{dbQueries: dbQueries, client: newClient(allowPrivate)}
+}
+
+func newClient(allowPrivate bool) *http.Client {
+	dialer := &net.Dialer{Timeout: deliveryTimeout}
+	if !allowPrivate {
+		dialer.Control = refusePrivate
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+
+	return &http.Client{
+		Transport: transport,
+		Timeout:   deliveryTimeout,
+		// A redirect could point anywhere; the endpoint has to answer
+		// itself.
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// refusePrivate runs after DNS resolution, so a public name that resolves
+// to a private address is caught too.
+func refusePrivate(network, address string, c syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+
+	ip := net.ParseIP(host)
+	if ip == nil || ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsMulticast() {
+		return errPrivateAddress
+	}
+
+	for _, ipNet := range nonPublicRanges {
+		if ipNet.Contains(ip) {
+			return errPrivateAddress
+		}
+	}
+
+	return nil
+}
+
+// Run delivers due events every interval until ctx is cancelled.
+func (d *Dispatcher) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := d.DeliverPending(ctx); err != nil && ctx.Err() == nil {
+			log.Printf("Error delivering webhooks: %s", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// DeliverPending claims a batch of due deliveries and tries each one once.
+func (d *Dispatcher) DeliverPending(ctx context.Context) error {
+	deliveries, err := d.dbQueries.ClaimDueWebhookDeliveries(ctx, dispatchBatchSize)
+	if err != nil {
+		return err
+	}
+
+	for _, delivery := range deliveries {
+		// A deleted endpoint takes its deliveries with it.
+		endpoint, err := d.dbQueries.GetWebhookEndpoint(ctx, delivery.EndpointID)
+		if errors.Is(err, sql.ErrNoRows) {
+			continue
+		} else if err != nil {
+			return err
+		}
+
+		started := time.Now()
+		statusCode, deliverErr := d.deliver(ctx, endpoint, delivery, started)
+
+		createWebhookDeliveryAttemptParams := database.CreateWebhookDeliveryAttemptParams{
+			DeliveryID: delivery.ID,
+			StatusCode: sql.NullInt32{Int32: int32(statusCode), Valid: statusCode != 0},
+			DurationMs: int32(time.Since(started).Milliseconds()),
+		}
+		if deliverErr != nil {
+			createWebhookDeliveryAttemptParams.Error = sql.NullString{String: deliverErr.Error(), Valid: true}
+		}
+
+		if err := d.dbQueries.CreateWebhookDeliveryAttempt(ctx, createWebhookDeliveryAttemptParams); err != nil {
+			return err
+		}
+
+		if deliverErr == nil {
+			markWebhookDeliveryDeliveredParams := database.MarkWebhookDeliveryDeliveredParams{
+				ID:             delivery.ID,
+				LastStatusCode: createWebhookDeliveryAttemptParams.StatusCode,
+			}
+
+			if err := d.dbQueries.MarkWebhookDeliveryDelivered(ctx, markWebhookDeliveryDeliveredParams); err != nil {
+				return err
+			}
+			continue
+		}
+
+		status := StatusPending
+		if delivery.Attempts >= MaxAttempts {
+			status = StatusFailed
+		}
+
+		markWebhookDeliveryFailedParams := database.MarkWebhookDeliveryFailedParams{
+			ID:             delivery.ID,
+			Status:         status,
+			LastStatusCode: createWebhookDeliveryAttemptParams.StatusCode,
+			LastError:      createWebhookDeliveryAttemptParams.Error,
+			NextAttemptAt:  time.Now().Add(RetryDelay(int(delivery.Attempts))),
+		}
+
+		if err := d.dbQueries.MarkWebhookDeliveryFailed(ctx, markWebhookDeliveryFailedParams); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// RetryDelay is the wait after the given number of failed attempts: 30s,
+// 1m, 2m and so on.
+func RetryDelay(attempts int) time.Duration {
+	return baseBackoff << max(attempts-1, 0)
+}
+
+// deliver POSTs the event and returns the response status. Anything other
+// than a 2xx is an error.
+func (d *Dispatcher) deliver(ctx context.Context, endpoint database.WebhookEndpoint, delivery database.WebhookDelivery, now time.Time) (int, error) {
+	body := []byte(delivery.Payload)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint.Url, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+
+	timestamp := now.Unix()
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "Chirpy-Webhooks/1.0")
+	req.Header.Set(EventHeader, delivery.EventType)
+	req.Header.Set(DeliveryHeader, delivery.ID.String())
+	req.Header.Set(TimestampHeader, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(SignatureHeader, auth.SignWebhook(endpoint.Secret, timestamp, body))
+
+	res, err := d.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode >= 200 && res.StatusCode < 300 {
+		io.Copy(io.Discard, io.LimitReader(res.Body, maxLoggedBody))
+		return res.StatusCode, nil
+	}
+
+	snippet, _ := io.ReadAll(io.LimitReader(res.Body, maxLoggedBody))
+
+	return res.StatusCode, fmt.Errorf("endpoint responded %s: %s", res.Status, bytes.TrimSpace(snippet))
+}
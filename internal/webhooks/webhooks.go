@@ -0,0 +1,120 @@
+// Package webhooks sends signed event notifications to HTTPS endpoints that
+// users register. Events are queued in the database in the same
+// transaction as the change they describe, and a Dispatcher delivers them
+// in the background, retrying failures with exponential backoff. Every
+// attempt is logged.
+package webhooks
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/url"
+	"slices"
+	"time"
+
+	"github.com/Cmolloy36/Chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+// Event types users can subscribe to.
+const (
+	EventChirpCreated   = "chirp.created"
+	EventChirpDeleted   = "chirp.deleted"
+	EventChirpMentioned = "chirp.mentioned"
+)
+
+var Events = []string{EventChirpCreated, EventChirpDeleted, EventChirpMentioned}
+
+// Delivery statuses.
+const (
+	StatusPending   = "pending"
+	StatusSending   = "sending"
+	StatusDelivered = "delivered"
+	StatusFailed    = "failed"
+)
+
+const (
+	EventHeader     = "X-Chirpy-Event"
+	DeliveryHeader  = "X-Chirpy-Delivery"
+	TimestampHeader = "X-Chirpy-Timestamp"
+	SignatureHeader = "X-Chirpy-Signature"
+
+	secretPrefix = "whsec_"
+)
+
+var (
+	ErrInsecureURL = errors.New("webhook URL must be an absolute https:// URL")
+	ErrUnknownType = errors.New("unknown webhook event type")
+)
+
+func IsValidEvent(eventType string) bool {
+	return slices.Contains(Events, eventType)
+}
+
+// ValidateURL accepts absolute https URLs. allowInsecure also accepts
+// http, for development against a local receiver.
+func ValidateURL(rawURL string, allowInsecure bool) error {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host == "" || u.User != nil {
+		return ErrInsecureURL
+	}
+
+	if u.Scheme != "https" && !(allowInsecure && u.Scheme == "http") {
+		return ErrInsecureURL
+	}
+
+	return nil
+}
+
+// MakeSecret returns a new signing secret for an endpoint. Unlike API keys
+// it is stored as is, since Chirpy needs it to sign every delivery.
+func MakeSecret() (string, error) {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return secretPrefix + hex.EncodeToString(b), nil
+}
+
+// Event is the JSON body of every delivery.
+type Event struct {
+	ID        uuid.UUID `json:"id"`
+	Type      string    `json:"type"`
+	CreatedAt time.Time `json:"created_at"`
+	Data      any       `json:"data"`
+}
+
+// Enqueue queues eventType for each of userID's endpoints that subscribe to
+// it. qtx should be the transaction making the change, so the event is
+// queued if and only if the change is committed.
+func Enqueue(ctx context.Context, qtx *database.Queries, userID uuid.UUID, eventType string, data any) error {
+	if !IsValidEvent(eventType) {
+		return ErrUnknownType
+	}
+
+	event := Event{
+		ID:        uuid.New(),
+		Type:      eventType,
+		CreatedAt: time.Now().UTC(),
+		Data:      data,
+	}
+
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	enqueueWebhookDeliveriesParams := database.EnqueueWebhookDeliveriesParams{
+		EventID:   event.ID,
+		EventType: event.Type,
+		Payload:   string(payload),
+		UserID:    userID,
+	}
+
+	_, err = qtx.EnqueueWebhookDeliveries(ctx, enqueueWebhookDeliveriesParams)
+	return err
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/Cmolloy36/Chirpy/internal/database"
+	"github.com/Cmolloy36/Chirpy/internal/mailer"
+	"github.com/google/uuid"
+)
+
+const (
+	loginMethodPassword     = "password"
+	loginMethodMagicLink    = "magic_link"
+	loginMethodPasskey      = "passkey"
+	loginMethodOIDC         = "oidc"
+	loginMethodTOTP         = "totp"
+	loginMethodRecoveryCode = "recovery_code"
+)
+
+const (
+	deviceCookie    = "chirpy_device"
+	deviceCookieTTL = 365 * 24 * time.Hour
+
+	notificationNewLogin = "new_login"
+)
+
+type LoginEvent struct {
+	ID        uuid.UUID `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	Succeeded bool      `json:"succeeded"`
+	Method    string    `json:"method"`
+	IP        string    `json:"ip"`
+	UserAgent string    `json:"user_agent"`
+}
+
+// ipRange groups addresses that most likely belong to the same network:
+// the /24 for IPv4 and the /48 for IPv6.
+func ipRange(ip string) string {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return ip
+	}
+
+	if v4 := parsed.To4(); v4 != nil {
+		return (&net.IPNet{IP: v4.Mask(net.CIDRMask(24, 32)), Mask: net.CIDRMask(24, 32)}).String()
+	}
+
+	return (&net.IPNet{IP: parsed.Mask(net.CIDRMask(48, 128)), Mask: net.CIDRMask(48, 128)}).String()
+}
+
+// recordLogin adds an attempt to the login history. A successful login from
+// a device or network the user hasn't logged in from before also notifies
+// them. Failures here never fail the login itself, so errors are only
+// logged.
+func (apiCfg *apiConfig) recordLogin(w http.ResponseWriter, r *http.Request, userID uuid.NullUUID, email, method string, succeeded bool) {
+	ip := clientIP(r, apiCfg.trustProxyHeaders)
+	userAgent := r.UserAgent()
+
+	var deviceID string
+	if cookie, err := r.Cookie(deviceCookie); err == nil {
+		deviceID = cookie.Value
+	}
+
+	if deviceID == "" && succeeded {
+		b := make([]byte, 16)
+		if _, err := rand.Read(b); err != nil {
+			log.Printf("Error creating device ID: %s", err)
+		}
+		deviceID = hex.EncodeToString(b)
+
+		http.SetCookie(w, &http.Cookie{
+			Name:     deviceCookie,
+			Value:    deviceID,
+			Path:     "/api",
+			MaxAge:   int(deviceCookieTTL.Seconds()),
+			HttpOnly: true,
+			Secure:   apiCfg.secureCookies(r),
+			SameSite: http.SameSiteLaxMode,
+		})
+	}
+
+	var familiarity database.GetLoginFamiliarityRow
+
+	if succeeded {
+		getLoginFamiliarityParams := database.GetLoginFamiliarityParams{
+			UserID:    userID,
+			DeviceID:  deviceID,
+			UserAgent: userAgent,
+			IpRange:   ipRange(ip),
+		}
+
+		var err error
+		familiarity, err = apiCfg.dbQueries.GetLoginFamiliarity(r.Context(), getLoginFamiliarityParams)
+		if err != nil {
+			log.Printf("Error reading login history: %s", err)
+		}
+	}
+
+	createLoginEventParams := database.CreateLoginEventParams{
+		UserID:    userID,
+		Email:     email,
+		Succeeded: succeeded,
+		Method:    method,
+		Ip:        ip,
+		IpRange:   ipRange(ip),
+		UserAgent: userAgent,
+		DeviceID:  deviceID,
+	}
+
+	if err := apiCfg.dbQueries.CreateLoginEvent(r.Context(), createLoginEventParams); err != nil {
+		log.Printf("Error recording login: %s", err)
+	}
+
+	// A user's very first login is new by definition and not worth an alert.
+	// A user agent alone is too common to vouch for a device, so it only
+	// counts alongside a network the user has logged in from with it.
+	newDevice := familiarity.KnownDeviceLogins == 0
+	if succeeded && familiarity.PreviousLogins > 0 && newDevice {
+		if err := apiCfg.alertNewLogin(r.Context(), userID.UUID, email, ip, userAgent, method); err != nil {
+			log.Printf("Error sending new login alert: %s", err)
+		}
+	}
+}
+
+func (apiCfg *apiConfig) alertNewLogin(ctx context.Context, userID uuid.UUID, email, ip, userAgent, method string) error {
+	if userAgent == "" {
+		userAgent = "an unknown device"
+	}
+
+	createNotificationParams := database.CreateNotificationParams{
+		UserID:  userID,
+		Kind:    notificationNewLogin,
+		Message: fmt.Sprintf("New sign-in from %s (%s) using %s.", userAgent, ip, method),
+	}
+
+	if err := apiCfg.dbQueries.CreateNotification(ctx, createNotificationParams); err != nil {
+		return err
+	}
+
+	msg := mailer.Message{
+		To:      email,
+		Subject: "New sign-in to your Chirpy account",
+		Body: fmt.Sprintf("Your Chirpy account was just signed in to from a device or network we haven't seen before.\n\nDevice: %s\nIP address: %s\nMethod: %s\nTime: %s\n\nIf this was you, you can ignore this email. If not, change your password at %s/app/reset-password and review your recent logins.\n",
+			userAgent, ip, method, time.Now().UTC().Format(time.RFC1123), apiCfg.publicBaseURL),
+	}
+
+	return apiCfg.mailer.Send(ctx, msg)
+}
+
+// handlerGetLoginHistory lists the user's most recent login attempts,
+// successful and failed.
+func (apiCfg *apiConfig) handlerGetLoginHistory(w http.ResponseWriter, r *http.Request) {
+	userID, err := userIDFromContext(r.Context())
+	if err != nil {
+		errorMessage := err.Error()
+
+		respondWithError(w, http.StatusUnauthorized, errorMessage)
+		return
+	}
+
+	getLoginEventsForUserParams := database.GetLoginEventsForUserParams{
+		UserID: uuid.NullUUID{UUID: userID, Valid: true},
+		Limit:  100,
+	}
+
+	dbEvents, err := apiCfg.dbQueries.GetLoginEventsForUser(r.Context(), getLoginEventsForUserParams)
+	if err != nil {
+		errorMessage := err.Error()
+
+		respondWithError(w, http.StatusBadRequest, errorMessage)
+		return
+	}
+
+	retSlc := make([]LoginEvent, len(dbEvents))
+	for i, dbEvent := range dbEvents {
+		retSlc[i] = LoginEvent{
+			ID:        dbEvent.ID,
+			CreatedAt: dbEvent.CreatedAt,
+			Succeeded: dbEvent.Succeeded,
+			Method:    dbEvent.Method,
+			IP:        dbEvent.Ip,
+			UserAgent: dbEvent.UserAgent,
+		}
+	}
+
+	respondwithJSON(w, http.StatusOK, retSlc)
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Cmolloy36/Chirpy/internal/auth"
+	"github.com/Cmolloy36/Chirpy/internal/database"
+	"github.com/Cmolloy36/Chirpy/internal/mailer"
+	"github.com/google/uuid"
+)
+
+const (
+	errMsgInvalidLogin = "incorrect email or password"
+	errMsgThrottled    = "too many failed login attempts, try again later"
+)
+
+type throttleKey struct {
+	key    string
+	policy auth.ThrottlePolicy
+}
+
+// Accounts are throttled by the email that was typed, not by user ID, so an
+// address behaves the same whether or not an account exists for it.
+func accountThrottleKey(email string) throttleKey {
+	return throttleKey{
+		key:    "email:" + strings.ToLower(strings.TrimSpace(email)),
+		policy: auth.AccountThrottlePolicy,
+	}
+}
+
+func ipThrottleKey(ip string) throttleKey {
+	return throttleKey{key: "ip:" + ip, policy: auth.IPThrottlePolicy}
+}
+
+func magicLinkThrottleKey(email string) throttleKey {
+	return throttleKey{
+		key:    "magic:" + strings.ToLower(strings.TrimSpace(email)),
+		policy: auth.MagicLinkThrottlePolicy,
+	}
+}
+
+func twoFactorThrottleKey(userID uuid.UUID) throttleKey {
+	return throttleKey{key: "2fa:" + userID.String(), policy: auth.AccountThrottlePolicy}
+}
+
+// loginBlockedUntil returns the time until which the latest of keys is
+// blocked, or the zero time if none are.
+func (apiCfg *apiConfig) loginBlockedUntil(ctx context.Context, keys ...throttleKey) (time.Time, error) {
+	var blockedUntil time.Time
+
+	for _, key := range keys {
+		throttle, err := apiCfg.dbQueries.GetLoginThrottle(ctx, key.key)
+		if errors.Is(err, sql.ErrNoRows) {
+			continue
+		} else if err != nil {
+			return time.Time{}, err
+		}
+
+		keyBlockedUntil := key.policy.BlockedUntil(int(throttle.Failures), throttle.LastFailureAt, throttle.LockedUntil.Time)
+		if keyBlockedUntil.After(blockedUntil) {
+			blockedUntil = keyBlockedUntil
+		}
+	}
+
+	if time.Now().After(blockedUntil) {
+		return time.Time{}, nil
+	}
+
+	return blockedUntil, nil
+}
+
+// recordLoginFailure counts a failure against every key and locks the ones
+// that reached their threshold. It returns the keys that were locked by this
+// failure, so callers can notify the account owner once per lockout.
+func (apiCfg *apiConfig) recordLoginFailure(ctx context.Context, keys ...throttleKey) ([]throttleKey, error) {
+	var newlyLocked []throttleKey
+
+	for _, key := range keys {
+		recordLoginFailureParams := database.RecordLoginFailureParams{
+			Key:           key.key,
+			LastFailureAt: time.Now().Add(-key.policy.DecayAfter),
+		}
+
+		throttle, err := apiCfg.dbQueries.RecordLoginFailure(ctx, recordLoginFailureParams)
+		if err != nil {
+			return nil, err
+		}
+
+		if !key.policy.ShouldLock(int(throttle.Failures)) {
+			continue
+		}
+
+		alreadyLocked := throttle.LockedUntil.Valid && time.Now().Before(throttle.LockedUntil.Time)
+
+		setLoginLockedUntilParams := database.SetLoginLockedUntilParams{
+			Key:         key.key,
+			LockedUntil: sql.NullTime{Time: time.Now().Add(key.policy.LockoutDuration), Valid: true},
+		}
+
+		if err := apiCfg.dbQueries.SetLoginLockedUntil(ctx, setLoginLockedUntilParams); err != nil {
+			return nil, err
+		}
+
+		if !alreadyLocked {
+			newlyLocked = append(newlyLocked, key)
+		}
+	}
+
+	return newlyLocked, nil
+}
+
+func (apiCfg *apiConfig) clearLoginThrottle(ctx context.Context, key throttleKey) error {
+	return apiCfg.dbQueries.ClearLoginThrottle(ctx, key.key)
+}
+
+func respondThrottled(w http.ResponseWriter, blockedUntil time.Time) {
+	retryAfter := int(math.Ceil(time.Until(blockedUntil).Seconds()))
+	w.Header().Set("Retry-After", fmt.Sprint(max(retryAfter, 1)))
+
+	respondWithError(w, http.StatusTooManyRequests, errMsgThrottled)
+}
+
+func (apiCfg *apiConfig) sendLockoutEmail(ctx context.Context, email, ip string, lockedFor time.Duration) error {
+	msg := mailer.Message{
+		To:      email,
+		Subject: "Your Chirpy account has been temporarily locked",
+		Body: fmt.Sprintf("We locked sign-in to your Chirpy account for %s after too many failed password attempts.\n\nThe most recent attempt came from %s.\n\nIf this wasn't you, someone may be trying to guess your password. You can choose a new one at %s/app/reset-password.\n",
+			lockedFor, ip, apiCfg.publicBaseURL),
+	}
+
+	return apiCfg.mailer.Send(ctx, msg)
+}
@@ -4,12 +4,21 @@ import (
 	"context"
 	"database/sql"
 	"fmt"
+	"log"
 	"net/http"
 	"os"
 	"sync/atomic"
 	"time"
 
+	"github.com/Cmolloy36/Chirpy/internal/auth"
+	"github.com/Cmolloy36/Chirpy/internal/billing"
 	"github.com/Cmolloy36/Chirpy/internal/database"
+	"github.com/Cmolloy36/Chirpy/internal/entitlements"
+	"github.com/Cmolloy36/Chirpy/internal/mailer"
+	"github.com/Cmolloy36/Chirpy/internal/oidc"
+	"github.com/Cmolloy36/Chirpy/internal/pow"
+	"github.com/Cmolloy36/Chirpy/internal/webauthn"
+	"github.com/Cmolloy36/Chirpy/internal/webhooks"
 	"github.com/google/uuid"
 	"github.com/joho/godotenv"
 	_ "github.com/lib/pq"
@@ -36,9 +45,121 @@ func main() {
 	apiCfg := apiConfig{}
 	apiCfg.platform = os.Getenv("PLATFORM")
 	apiCfg.fileserverHits.Store(0)
+	apiCfg.db = db
 	apiCfg.dbQueries = dbQueries
 	apiCfg.secretString = os.Getenv("SIGNING_SECRET")
 	apiCfg.polkaKey = os.Getenv("POLKA_KEY")
+	apiCfg.adminKey = os.Getenv("ADMIN_KEY")
+	apiCfg.polkaVerifier, err = auth.WebhookVerifierFromEnv()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	apiCfg.billingPolicy, err = billing.PolicyFromEnv()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	apiCfg.entitlements, err = entitlements.FromEnv()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	apiCfg.tokenAudience = os.Getenv("JWT_AUDIENCE")
+	if apiCfg.tokenAudience == "" {
+		apiCfg.tokenAudience = auth.DefaultAudience
+	}
+
+	apiCfg.tokenPolicy, err = auth.TokenPolicyFromEnv()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	passwordHashParams, err := auth.Argon2idParamsFromEnv()
+	if err != nil {
+		log.Fatal(err)
+	}
+	auth.SetPasswordHashParams(passwordHashParams)
+
+	apiCfg.passwordPolicy, err = auth.PasswordPolicyFromEnv()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	apiCfg.webauthn = webauthn.Config{
+		RPID:   os.Getenv("WEBAUTHN_RP_ID"),
+		RPName: "Chirpy",
+		Origin: os.Getenv("WEBAUTHN_ORIGIN"),
+	}
+	if apiCfg.webauthn.RPID == "" {
+		apiCfg.webauthn.RPID = "localhost"
+	}
+	if apiCfg.webauthn.Origin == "" {
+		apiCfg.webauthn.Origin = "http://localhost:8080"
+	}
+
+	apiCfg.trustProxyHeaders = os.Getenv("TRUST_PROXY_HEADERS") == "true"
+
+	apiCfg.registrationMode, err = registrationModeFromEnv()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	difficultyPolicy, err := pow.DifficultyPolicyFromEnv()
+	if err != nil {
+		log.Fatal(err)
+	}
+	apiCfg.powDifficulty = pow.NewAdaptive(difficultyPolicy)
+	apiCfg.powIssuer = pow.NewIssuer(apiCfg.secretString, pow.DefaultChallengeTTL)
+
+	apiCfg.publicBaseURL = os.Getenv("PUBLIC_BASE_URL")
+	if apiCfg.publicBaseURL == "" {
+		apiCfg.publicBaseURL = "http://localhost:8080"
+	}
+
+	// OIDC login is off unless a provider is configured.
+	if issuer := os.Getenv("OIDC_ISSUER"); issuer != "" {
+		oidcConfig := oidc.Config{
+			Issuer:       issuer,
+			ClientID:     os.Getenv("OIDC_CLIENT_ID"),
+			ClientSecret: os.Getenv("OIDC_CLIENT_SECRET"),
+			RedirectURL:  os.Getenv("OIDC_REDIRECT_URL"),
+		}
+		if oidcConfig.ClientID == "" {
+			log.Fatal("OIDC_CLIENT_ID is required when OIDC_ISSUER is set")
+		}
+		if oidcConfig.RedirectURL == "" {
+			oidcConfig.RedirectURL = apiCfg.publicBaseURL + "/api/login/oidc/callback"
+		}
+
+		apiCfg.oidc = oidc.NewProvider(oidcConfig, nil)
+	}
+
+	mailSender, err := mailer.SenderFromEnv()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	outbox := mailer.NewOutbox(dbQueries, mailSender)
+	apiCfg.mailer = outbox
+	go outbox.Run(context.Background(), 5*time.Second)
+
+	go billing.NewExpirer(dbQueries).Run(context.Background(), time.Minute)
+
+	go pow.NewSweeper(dbQueries).Run(context.Background(), pow.DefaultChallengeTTL)
+
+	// In development, endpoints may be on the local network.
+	go webhooks.NewDispatcher(dbQueries, apiCfg.platform == "dev").Run(context.Background(), 5*time.Second)
+
+	reconcileConfig, err := billing.ReconcileConfigFromEnv()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if reconcileConfig.Source != "" {
+		reconciler := billing.NewReconciler(db, dbQueries, apiCfg.billingPolicy, reconcileConfig.Source)
+		go reconciler.Run(context.Background(), reconcileConfig.Interval, reconcileConfig.Repair)
+	}
 
 	funcHandler := http.StripPrefix("/app", http.FileServer(http.Dir(".")))
 
@@ -46,32 +167,144 @@ func main() {
 
 	newServeMux.HandleFunc("GET /api/healthz", handler)
 
-	newServeMux.HandleFunc("POST /api/chirps", apiCfg.handlerPostChirp)
+	newServeMux.HandleFunc("POST /api/challenge", apiCfg.handlerPostChallenge)
+
+	newServeMux.Handle("POST /api/chirps", apiCfg.middlewareRequireScopes(apiCfg.middlewareMeterAPICalls(apiCfg.handlerPostChirp), auth.ScopeChirpsWrite))
 
-	newServeMux.HandleFunc("DELETE /api/chirps/{chirpID}", apiCfg.handlerDeleteChirp)
+	newServeMux.Handle("DELETE /api/chirps/{chirpID}", apiCfg.middlewareRequireScopes(apiCfg.middlewareMeterAPICalls(apiCfg.handlerDeleteChirp), auth.ScopeChirpsWrite))
 
 	newServeMux.HandleFunc("GET /api/chirps/{chirpID}", apiCfg.handlerGetChirp)
 
 	newServeMux.HandleFunc("GET /api/chirps", apiCfg.handlerGetChirps)
 
+	newServeMux.Handle("POST /api/keys", apiCfg.middlewareRequireScopes(middlewareRequireSession(apiCfg.handlerPostAPIKey), auth.ScopeProfileWrite))
+
+	newServeMux.Handle("GET /api/keys", apiCfg.middlewareRequireScopes(middlewareRequireSession(apiCfg.handlerGetAPIKeys), auth.ScopeProfileWrite))
+
+	newServeMux.Handle("PATCH /api/keys/{keyID}", apiCfg.middlewareRequireScopes(middlewareRequireSession(apiCfg.handlerPatchAPIKey), auth.ScopeProfileWrite))
+
+	newServeMux.Handle("DELETE /api/keys/{keyID}", apiCfg.middlewareRequireScopes(middlewareRequireSession(apiCfg.handlerDeleteAPIKey), auth.ScopeProfileWrite))
+
+	newServeMux.Handle("POST /api/invites", apiCfg.middlewareRequireScopes(middlewareRequireSession(apiCfg.handlerPostInvite), auth.ScopeProfileWrite))
+
+	newServeMux.Handle("GET /api/invites", apiCfg.middlewareRequireScopes(middlewareRequireSession(apiCfg.handlerGetInvites), auth.ScopeProfileWrite))
+
+	newServeMux.Handle("DELETE /api/invites/{inviteID}", apiCfg.middlewareRequireScopes(middlewareRequireSession(apiCfg.handlerDeleteInvite), auth.ScopeProfileWrite))
+
 	newServeMux.HandleFunc("POST /api/login", apiCfg.handlerLogin)
 
+	newServeMux.HandleFunc("POST /api/login/2fa", apiCfg.handlerLoginTwoFactor)
+
+	newServeMux.HandleFunc("POST /api/login/magic", apiCfg.handlerRequestMagicLink)
+
+	newServeMux.HandleFunc("POST /api/login/magic/redeem", apiCfg.handlerRedeemMagicLink)
+
+	newServeMux.HandleFunc("GET /api/login/oidc", apiCfg.handlerBeginOIDCLogin)
+
+	newServeMux.HandleFunc("GET /api/login/oidc/callback", apiCfg.handlerOIDCCallback)
+
+	newServeMux.HandleFunc("POST /api/login/passkey/begin", apiCfg.handlerBeginPasskeyLogin)
+
+	newServeMux.HandleFunc("POST /api/login/passkey/finish", apiCfg.handlerFinishPasskeyLogin)
+
+	newServeMux.Handle("POST /api/oauth/clients", apiCfg.middlewareRequireScopes(middlewareRequireSession(apiCfg.handlerPostOAuthClient), auth.ScopeProfileWrite))
+
+	newServeMux.Handle("GET /api/oauth/clients", apiCfg.middlewareRequireScopes(middlewareRequireSession(apiCfg.handlerGetOAuthClients), auth.ScopeProfileWrite))
+
+	newServeMux.Handle("DELETE /api/oauth/clients/{clientID}", apiCfg.middlewareRequireScopes(middlewareRequireSession(apiCfg.handlerDeleteOAuthClient), auth.ScopeProfileWrite))
+
+	newServeMux.Handle("GET /api/oauth/consents", apiCfg.middlewareRequireScopes(middlewareRequireSession(apiCfg.handlerGetOAuthConsents), auth.ScopeProfileWrite))
+
+	newServeMux.Handle("DELETE /api/oauth/consents/{clientID}", apiCfg.middlewareRequireScopes(middlewareRequireSession(apiCfg.handlerDeleteOAuthConsent), auth.ScopeProfileWrite))
+
+	newServeMux.Handle("GET /api/oauth/authorize", apiCfg.middlewareRequireScopes(middlewareRequireSession(apiCfg.handlerGetOAuthAuthorization)))
+
+	newServeMux.Handle("POST /api/oauth/authorize", apiCfg.middlewareRequireScopes(middlewareRequireSession(apiCfg.handlerPostOAuthAuthorization)))
+
+	newServeMux.Handle("GET /api/passkeys", apiCfg.middlewareRequireScopes(middlewareRequireSession(apiCfg.handlerGetPasskeys), auth.ScopeProfileWrite))
+
+	newServeMux.Handle("DELETE /api/passkeys/{passkeyID}", apiCfg.middlewareRequireScopes(middlewareRequireSession(apiCfg.handlerDeletePasskey), auth.ScopeProfileWrite))
+
+	newServeMux.Handle("POST /api/passkeys/register/begin", apiCfg.middlewareRequireScopes(middlewareRequireSession(apiCfg.handlerBeginPasskeyRegistration), auth.ScopeProfileWrite))
+
+	newServeMux.Handle("POST /api/passkeys/register/finish", apiCfg.middlewareRequireScopes(middlewareRequireSession(apiCfg.handlerFinishPasskeyRegistration), auth.ScopeProfileWrite))
+
+	newServeMux.Handle("GET /api/notifications", apiCfg.middlewareRequireScopes(apiCfg.middlewareMeterAPICalls(apiCfg.handlerGetNotifications), auth.ScopeProfileWrite))
+
+	newServeMux.Handle("POST /api/notifications/read", apiCfg.middlewareRequireScopes(apiCfg.middlewareMeterAPICalls(apiCfg.handlerReadNotifications), auth.ScopeProfileWrite))
+
+	newServeMux.Handle("GET /api/entitlements", apiCfg.middlewareRequireScopes(apiCfg.handlerGetEntitlements))
+
+	newServeMux.Handle("GET /api/usage", apiCfg.middlewareRequireScopes(apiCfg.handlerGetUsage))
+
+	newServeMux.HandleFunc("POST /api/password-reset", apiCfg.handlerRequestPasswordReset)
+
+	newServeMux.HandleFunc("POST /api/password-reset/confirm", apiCfg.handlerConfirmPasswordReset)
+
 	newServeMux.HandleFunc("POST /api/polka/webhooks", apiCfg.handlerPostPolkaWebhook)
 
+	newServeMux.Handle("POST /api/webhooks", apiCfg.middlewareRequireScopes(middlewareRequireSession(apiCfg.handlerPostWebhookEndpoint), auth.ScopeProfileWrite))
+
+	newServeMux.Handle("GET /api/webhooks", apiCfg.middlewareRequireScopes(middlewareRequireSession(apiCfg.handlerGetWebhookEndpoints), auth.ScopeProfileWrite))
+
+	newServeMux.Handle("DELETE /api/webhooks/{webhookID}", apiCfg.middlewareRequireScopes(middlewareRequireSession(apiCfg.handlerDeleteWebhookEndpoint), auth.ScopeProfileWrite))
+
+	newServeMux.Handle("GET /api/webhooks/{webhookID}/deliveries", apiCfg.middlewareRequireScopes(middlewareRequireSession(apiCfg.handlerGetWebhookDeliveries), auth.ScopeProfileWrite))
+
+	newServeMux.Handle("GET /api/webhooks/{webhookID}/deliveries/{deliveryID}", apiCfg.middlewareRequireScopes(middlewareRequireSession(apiCfg.handlerGetWebhookDelivery), auth.ScopeProfileWrite))
+
+	newServeMux.Handle("GET /api/security/logins", apiCfg.middlewareRequireScopes(apiCfg.handlerGetLoginHistory, auth.ScopeProfileWrite))
+
 	newServeMux.HandleFunc("POST /api/refresh", apiCfg.handlerRefresh)
 
 	newServeMux.HandleFunc("POST /api/revoke", apiCfg.handlerRevoke)
 
+	newServeMux.HandleFunc("GET /api/token/introspect", apiCfg.handlerIntrospectToken)
+
 	newServeMux.HandleFunc("POST /api/users", apiCfg.handlerPostUser)
 
-	newServeMux.HandleFunc("PUT /api/users", apiCfg.handlerPutUser)
+	newServeMux.Handle("PUT /api/users", apiCfg.middlewareRequireScopes(middlewareRequireSession(apiCfg.handlerPutUser), auth.ScopeProfileWrite))
 
 	newServeMux.HandleFunc("GET /api/users/{userID}", apiCfg.handlerGetUser)
 
+	newServeMux.Handle("PATCH /api/users/me", apiCfg.middlewareRequireScopes(middlewareRequireSession(apiCfg.handlerPatchUser), auth.ScopeProfileWrite))
+
+	newServeMux.HandleFunc("POST /api/users/me/email/confirm", apiCfg.handlerConfirmEmailChange)
+
+	newServeMux.HandleFunc("POST /api/users/verify-email", apiCfg.handlerVerifyEmail)
+
+	newServeMux.Handle("POST /api/users/verify-email/resend", apiCfg.middlewareRequireScopes(apiCfg.handlerResendVerificationEmail, auth.ScopeProfileWrite))
+
+	newServeMux.Handle("POST /api/users/2fa/enroll", apiCfg.middlewareRequireScopes(middlewareRequireSession(apiCfg.handlerEnrollTwoFactor), auth.ScopeProfileWrite))
+
+	newServeMux.Handle("POST /api/users/2fa/confirm", apiCfg.middlewareRequireScopes(middlewareRequireSession(apiCfg.handlerConfirmTwoFactor), auth.ScopeProfileWrite))
+
+	newServeMux.Handle("POST /api/users/2fa/disable", apiCfg.middlewareRequireScopes(middlewareRequireSession(apiCfg.handlerDisableTwoFactor), auth.ScopeProfileWrite))
+
+	newServeMux.HandleFunc("GET /oauth/authorize", apiCfg.handlerOAuthAuthorize)
+
+	newServeMux.HandleFunc("POST /oauth/token", apiCfg.handlerOAuthToken)
+
+	newServeMux.HandleFunc("POST /oauth/revoke", apiCfg.handlerOAuthRevoke)
+
+	newServeMux.HandleFunc("POST /oauth/introspect", apiCfg.handlerOAuthIntrospect)
+
 	newServeMux.HandleFunc("GET /admin/metrics", apiCfg.metricsHandler)
 
 	newServeMux.HandleFunc("POST /admin/reset", apiCfg.resetHandler)
 
+	newServeMux.HandleFunc("POST /admin/invites", apiCfg.middlewareRequireAdmin(apiCfg.handlerPostAdminInvite))
+
+	newServeMux.HandleFunc("GET /admin/waitlist", apiCfg.middlewareRequireAdmin(apiCfg.handlerGetWaitlist))
+
+	newServeMux.HandleFunc("POST /admin/waitlist/approve", apiCfg.middlewareRequireAdmin(apiCfg.handlerApproveWaitlist))
+
+	newServeMux.HandleFunc("GET /admin/webhooks/events", apiCfg.middlewareRequireAdmin(apiCfg.handlerGetWebhookEvents))
+
+	newServeMux.HandleFunc("POST /admin/webhooks/events/{eventID}/replay", apiCfg.middlewareRequireAdmin(apiCfg.handlerReplayWebhookEvent))
+
+	newServeMux.HandleFunc("GET /admin/subscriptions/{userID}/audit", apiCfg.middlewareRequireAdmin(apiCfg.handlerGetSubscriptionAudit))
+
 	newHttpServer.ListenAndServe()
 
 }
@@ -79,19 +312,40 @@ func main() {
 type apiConfig struct {
 	platform       string
 	fileserverHits atomic.Int32 // allows us to safely increment & read across multiple goroutines
+	db             *sql.DB
 	dbQueries      *database.Queries
 	secretString   string
 	polkaKey       string
+	adminKey       string
+	polkaVerifier  auth.WebhookVerifier
+	billingPolicy  billing.Policy
+	entitlements   *entitlements.Engine
+	tokenAudience  string
+	tokenPolicy    auth.TokenPolicy
+	passwordPolicy auth.PasswordPolicy
+	webauthn       webauthn.Config
+	mailer         mailer.Mailer
+	publicBaseURL  string
+	oidc           *oidc.Provider
+
+	registrationMode string
+	powIssuer        *pow.Issuer
+	powDifficulty    *pow.Adaptive
+
+	trustProxyHeaders bool
 }
 
 type User struct {
-	ID           uuid.UUID `json:"id"`
-	CreatedAt    time.Time `json:"created_at"`
-	UpdatedAt    time.Time `json:"updated_at"`
-	Email        string    `json:"email"`
-	Token        string    `json:"token,omitempty"`
-	RefreshToken string    `json:"refresh_token,omitempty"`
-	IsChirpyRed  bool      `json:"is_chirpy_red"`
+	ID            uuid.UUID `json:"id"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+	Email         string    `json:"email"`
+	EmailVerified bool      `json:"email_verified"`
+	PendingEmail  string    `json:"pending_email,omitempty"`
+	Token         string    `json:"token,omitempty"`
+	RefreshToken  string    `json:"refresh_token,omitempty"`
+	CSRFToken     string    `json:"csrf_token,omitempty"`
+	IsChirpyRed   bool      `json:"is_chirpy_red"`
 }
 
 type Chirp struct {
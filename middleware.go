@@ -0,0 +1,168 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/Cmolloy36/Chirpy/internal/auth"
+	"github.com/google/uuid"
+)
+
+type contextKey string
+
+const claimsContextKey contextKey = "claims"
+
+// middlewareRequireScopes validates the bearer access token (or personal API
+// key, or session cookie) and rejects the request unless it grants every
+// listed scope. The validated claims are stored on the request context for
+// the handler to read.
+func (apiCfg *apiConfig) middlewareRequireScopes(next http.HandlerFunc, scopes ...string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		claims, err := apiCfg.authenticate(r)
+		if err != nil {
+			errorMessage := err.Error()
+
+			respondWithError(w, http.StatusUnauthorized, errorMessage)
+			return
+		}
+
+		if err := auth.CheckCSRF(r); err != nil {
+			errorMessage := err.Error()
+
+			respondWithError(w, http.StatusForbidden, errorMessage)
+			return
+		}
+
+		if err := claims.RequireScopes(scopes...); err != nil {
+			errorMessage := err.Error()
+
+			respondWithError(w, http.StatusForbidden, errorMessage)
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), claimsContextKey, claims)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// authenticate returns the claims for the request's Authorization header,
+// which may carry either a bearer access token or an API key.
+func (apiCfg *apiConfig) authenticate(r *http.Request) (auth.Claims, error) {
+	if auth.HasAPIKey(r.Header) {
+		return apiCfg.claimsFromAPIKey(r.Context(), r.Header)
+	}
+
+	accessTokenString, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		return auth.Claims{}, err
+	}
+
+	return auth.ValidateJWT(accessTokenString, apiCfg.secretString, apiCfg.tokenAudience)
+}
+
+// middlewareRequireSession only lets through tokens from a first-party login,
+// for routes that manage credentials or account security: neither
+// third-party apps nor API keys may mint more credentials or take over the
+// account, whatever scopes they hold. It must be wrapped by
+// middlewareRequireScopes.
+func middlewareRequireSession(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		claims, ok := claimsFromContext(r.Context())
+		if !ok || !claims.IsFirstParty() || claims.IsAPIKey() {
+			errorMessage := "this endpoint requires a login session"
+
+			respondWithError(w, http.StatusForbidden, errorMessage)
+			return
+		}
+
+		next(w, r)
+	}
+}
+
+// middlewareMeterAPICalls counts the request against the api_calls quota
+// of the user it acts for. Every token carries its user as the subject,
+// client credentials tokens included (they act for the app's owner), so
+// all of them are counted. Only content routes opt in: a user who is out
+// of calls must still be able to check their usage and secure their
+// account. It must be wrapped by middlewareRequireScopes.
+func (apiCfg *apiConfig) middlewareMeterAPICalls(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		claims, _ := claimsFromContext(r.Context())
+
+		userID, err := claims.UserID()
+		if err != nil {
+			errorMessage := err.Error()
+
+			respondWithError(w, http.StatusUnauthorized, errorMessage)
+			return
+		}
+
+		if err := apiCfg.meterAPICall(w, r, userID); err != nil {
+			respondWithEntitlementError(w, err)
+			return
+		}
+
+		next(w, r)
+	}
+}
+
+// middlewareRequireAdmin guards operator endpoints with the ADMIN_KEY,
+// sent as "Authorization: ApiKey ...". They are disabled when it isn't set.
+func (apiCfg *apiConfig) middlewareRequireAdmin(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		apiKey, err := auth.GetAPIKey(r.Header)
+		if err != nil || apiCfg.adminKey == "" || subtle.ConstantTimeCompare([]byte(apiKey), []byte(apiCfg.adminKey)) != 1 {
+			errorMessage := "admin key required"
+
+			respondWithError(w, http.StatusUnauthorized, errorMessage)
+			return
+		}
+
+		next(w, r)
+	}
+}
+
+func claimsFromContext(ctx context.Context) (auth.Claims, bool) {
+	claims, ok := ctx.Value(claimsContextKey).(auth.Claims)
+	return claims, ok
+}
+
+// userIDFromContext returns the authenticated user set by middlewareRequireScopes.
+func userIDFromContext(ctx context.Context) (uuid.UUID, error) {
+	claims, ok := claimsFromContext(ctx)
+	if !ok {
+		return uuid.Nil, errors.New("request is not authenticated")
+	}
+
+	return claims.UserID()
+}
+
+// clientIP returns the address the request came from. X-Forwarded-For is
+// only honoured when Chirpy runs behind a proxy that sets it, and then only
+// its last entry: that is the one our proxy appended, while anything
+// before it came from the client and can be made up.
+func clientIP(r *http.Request, trustProxyHeaders bool) string {
+	if trustProxyHeaders {
+		if values := r.Header.Values("X-Forwarded-For"); len(values) > 0 {
+			forwarded := values[len(values)-1]
+			if i := strings.LastIndex(forwarded, ","); i >= 0 {
+				forwarded = forwarded[i+1:]
+			}
+
+			if last := strings.TrimSpace(forwarded); last != "" {
+				return last
+			}
+		}
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+
+	return host
+}
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+)
+
+// Registration modes control who may create an account, for a staged
+// rollout. They apply to POST /api/users and to first sign-in through
+// OIDC.
+const (
+	registrationOpen       = "open"
+	registrationInviteOnly = "invite_only"
+	registrationWaitlist   = "waitlist"
+)
+
+var errRegistrationClosed = errors.New("registration is not open; ask for an invite")
+
+// registrationModeFromEnv reads REGISTRATION_MODE, which defaults to open.
+func registrationModeFromEnv() (string, error) {
+	switch mode := os.Getenv("REGISTRATION_MODE"); mode {
+	case "":
+		return registrationOpen, nil
+	case registrationOpen, registrationInviteOnly, registrationWaitlist:
+		return mode, nil
+	default:
+		return "", fmt.Errorf("invalid REGISTRATION_MODE %q: must be %s, %s or %s", mode, registrationOpen, registrationInviteOnly, registrationWaitlist)
+	}
+}
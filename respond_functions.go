@@ -4,6 +4,8 @@ import (
 	"encoding/json"
 	"log"
 	"net/http"
+
+	"github.com/Cmolloy36/Chirpy/internal/oauth"
 )
 
 func respondWithError(w http.ResponseWriter, code int, msg string) {
@@ -19,6 +21,17 @@ func respondWithError(w http.ResponseWriter, code int, msg string) {
 
 }
 
+// respondWithOAuthError answers in the RFC 6749 error format that OAuth
+// client libraries expect, rather than Chirpy's usual {"error": "..."}.
+func respondWithOAuthError(w http.ResponseWriter, oauthErr *oauth.Error) {
+	w.Header().Set("Cache-Control", "no-store")
+	if oauthErr.Status() == http.StatusUnauthorized {
+		w.Header().Set("WWW-Authenticate", `Basic realm="chirpy"`)
+	}
+
+	respondwithJSON(w, oauthErr.Status(), oauthErr)
+}
+
 func respondwithJSON(w http.ResponseWriter, code int, payload interface{}) {
 	dat, err := json.Marshal(payload)
 	if err != nil {
@@ -31,3 +44,19 @@ func respondwithJSON(w http.ResponseWriter, code int, payload interface{}) {
 	w.WriteHeader(code)
 	w.Write(dat)
 }
+
+// respondWithFieldErrors reports validation problems keyed by input field,
+// e.g. {"error": "invalid input", "fields": {"password": ["..."]}}.
+func respondWithFieldErrors(w http.ResponseWriter, code int, fields map[string][]string) {
+	type errStruct struct {
+		ErrorMessage string              `json:"error"`
+		Fields       map[string][]string `json:"fields"`
+	}
+
+	errorStruct := errStruct{
+		ErrorMessage: "invalid input",
+		Fields:       fields,
+	}
+
+	respondwithJSON(w, code, errorStruct)
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Cmolloy36/Chirpy/internal/auth"
+)
+
+// respondWithTokens sends a completed login. With sessionCookies set the
+// tokens go into HttpOnly cookies instead of the body, and the body carries
+// the CSRF token the frontend must echo on state-changing requests.
+func (apiCfg *apiConfig) respondWithTokens(w http.ResponseWriter, r *http.Request, user User, expiresInSeconds int, rememberMe, sessionCookies bool) {
+	if sessionCookies {
+		csrfToken, err := auth.MakeCSRFToken()
+		if err != nil {
+			errorMessage := err.Error()
+
+			respondWithError(w, http.StatusInternalServerError, errorMessage)
+			return
+		}
+
+		refreshTTL := apiCfg.tokenPolicy.RefreshTTLFor(rememberMe)
+
+		apiCfg.setAccessTokenCookie(w, r, user.Token, apiCfg.tokenPolicy.AccessTTLFor(expiresInSeconds))
+		apiCfg.setSessionCookie(w, r, auth.RefreshTokenCookie, user.RefreshToken, "/api", refreshTTL, true)
+		// Readable by the frontend's JavaScript, which is the point: another
+		// site can't read it, so it can't copy it into the header.
+		apiCfg.setSessionCookie(w, r, auth.CSRFCookie, csrfToken, "/", refreshTTL, false)
+
+		user.Token = ""
+		user.RefreshToken = ""
+		user.CSRFToken = csrfToken
+	}
+
+	respondwithJSON(w, http.StatusOK, user)
+}
+
+func (apiCfg *apiConfig) setAccessTokenCookie(w http.ResponseWriter, r *http.Request, token string, ttl time.Duration) {
+	apiCfg.setSessionCookie(w, r, auth.AccessTokenCookie, token, "/", ttl, true)
+}
+
+func (apiCfg *apiConfig) setSessionCookie(w http.ResponseWriter, r *http.Request, name, value, path string, ttl time.Duration, httpOnly bool) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     path,
+		MaxAge:   int(ttl.Seconds()),
+		HttpOnly: httpOnly,
+		Secure:   apiCfg.secureCookies(r),
+		SameSite: http.SameSiteStrictMode,
+	})
+}
+
+func clearSessionCookies(w http.ResponseWriter) {
+	for name, path := range map[string]string{
+		auth.AccessTokenCookie:  "/",
+		auth.RefreshTokenCookie: "/api",
+		auth.CSRFCookie:         "/",
+	} {
+		http.SetCookie(w, &http.Cookie{
+			Name:   name,
+			Path:   path,
+			MaxAge: -1,
+		})
+	}
+}
+
+// secureCookies is false only for plain-HTTP local development; behind a TLS
+// terminating proxy the public URL tells us the site is served over HTTPS.
+func (apiCfg *apiConfig) secureCookies(r *http.Request) bool {
+	return r.TLS != nil || strings.HasPrefix(apiCfg.publicBaseURL, "https://")
+}
@@ -0,0 +1,35 @@
+-- name: EnqueueEmail :one
+INSERT INTO email_outbox(id, created_at, updated_at, to_address, subject, body, send_after)
+VALUES(
+    gen_random_uuid(),
+    NOW(),
+    NOW(),
+    $1,
+    $2,
+    $3,
+    NOW()
+)
+RETURNING *;
+
+-- name: ClaimPendingEmails :many
+UPDATE email_outbox
+SET status = 'sending', attempts = attempts + 1, updated_at = NOW()
+WHERE id IN (
+    SELECT id FROM email_outbox
+    WHERE (status = 'pending' AND send_after <= NOW())
+        OR (status = 'sending' AND updated_at < NOW() - INTERVAL '10 minutes')
+    ORDER BY send_after ASC
+    LIMIT $1
+    FOR UPDATE SKIP LOCKED
+)
+RETURNING *;
+
+-- name: MarkEmailSent :exec
+UPDATE email_outbox
+SET status = 'sent', sent_at = NOW(), last_error = NULL, updated_at = NOW()
+WHERE id = $1;
+
+-- name: MarkEmailFailed :exec
+UPDATE email_outbox
+SET status = $2, last_error = $3, send_after = $4, updated_at = NOW()
+WHERE id = $1;
@@ -0,0 +1,22 @@
+-- name: CreateEmailToken :one
+INSERT INTO email_tokens(id, created_at, user_id, purpose, email, expires_at)
+VALUES(
+    gen_random_uuid(),
+    NOW(),
+    $1,
+    $2,
+    $3,
+    $4
+)
+RETURNING *;
+
+-- name: UseEmailToken :one
+UPDATE email_tokens
+SET used_at = NOW()
+WHERE id = $1 AND purpose = $2 AND used_at IS NULL AND expires_at > NOW()
+RETURNING *;
+
+-- name: InvalidateEmailTokens :exec
+UPDATE email_tokens
+SET used_at = NOW()
+WHERE user_id = $1 AND purpose = $2 AND used_at IS NULL;
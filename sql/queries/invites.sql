@@ -0,0 +1,38 @@
+-- name: CountActiveInvitesForUser :one
+SELECT COUNT(*) FROM invites
+WHERE created_by = $1
+AND revoked_at IS NULL
+AND uses < max_uses
+AND (expires_at IS NULL OR expires_at > NOW());
+
+-- name: CreateInvite :one
+INSERT INTO invites(id, created_at, created_by, code_prefix, code_hash, max_uses, expires_at)
+VALUES(
+    gen_random_uuid(),
+    NOW(),
+    $1,
+    $2,
+    $3,
+    $4,
+    $5
+)
+RETURNING *;
+
+-- name: GetInvitesForUser :many
+SELECT * FROM invites
+WHERE created_by = $1 AND revoked_at IS NULL
+ORDER BY created_at;
+
+-- name: RedeemInvite :one
+UPDATE invites
+SET uses = uses + 1
+WHERE code_hash = $1
+AND revoked_at IS NULL
+AND uses < max_uses
+AND (expires_at IS NULL OR expires_at > NOW())
+RETURNING *;
+
+-- name: RevokeInvite :execrows
+UPDATE invites
+SET revoked_at = NOW()
+WHERE id = $1 AND created_by = $2 AND revoked_at IS NULL;
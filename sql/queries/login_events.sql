@@ -0,0 +1,30 @@
+-- name: CreateLoginEvent :exec
+INSERT INTO login_events(id, created_at, user_id, email, succeeded, method, ip, ip_range, user_agent, device_id)
+VALUES(
+    gen_random_uuid(),
+    NOW(),
+    $1,
+    $2,
+    $3,
+    $4,
+    $5,
+    $6,
+    $7,
+    $8
+);
+
+-- name: GetLoginEventsForUser :many
+SELECT * FROM login_events
+WHERE user_id = $1
+ORDER BY created_at DESC
+LIMIT $2;
+
+-- name: GetLoginFamiliarity :one
+SELECT
+    COUNT(*) AS previous_logins,
+    COUNT(*) FILTER (
+        WHERE (device_id <> '' AND device_id = $2)
+           OR (user_agent = $3 AND ip_range = $4)
+    ) AS known_device_logins
+FROM login_events
+WHERE user_id = $1 AND succeeded;
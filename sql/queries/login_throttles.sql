@@ -0,0 +1,26 @@
+-- name: GetLoginThrottle :one
+SELECT * FROM login_throttles
+WHERE key = $1;
+
+-- name: RecordLoginFailure :one
+INSERT INTO login_throttles(key, updated_at, failures, last_failure_at)
+VALUES(
+    $1,
+    NOW(),
+    1,
+    NOW()
+)
+ON CONFLICT (key) DO UPDATE
+SET failures = CASE WHEN login_throttles.last_failure_at < $2 THEN 1 ELSE login_throttles.failures + 1 END,
+    last_failure_at = NOW(),
+    updated_at = NOW()
+RETURNING *;
+
+-- name: SetLoginLockedUntil :exec
+UPDATE login_throttles
+SET locked_until = $2, updated_at = NOW()
+WHERE key = $1;
+
+-- name: ClearLoginThrottle :exec
+DELETE FROM login_throttles
+WHERE key = $1;
@@ -0,0 +1,22 @@
+-- name: CreateMagicLink :one
+INSERT INTO magic_links(id, created_at, user_id, email, nonce_hash, expires_at)
+VALUES(
+    gen_random_uuid(),
+    NOW(),
+    $1,
+    $2,
+    $3,
+    $4
+)
+RETURNING *;
+
+-- name: UseMagicLink :one
+UPDATE magic_links
+SET used_at = NOW()
+WHERE id = $1 AND nonce_hash = $2 AND used_at IS NULL AND expires_at > NOW()
+RETURNING *;
+
+-- name: InvalidateMagicLinks :exec
+UPDATE magic_links
+SET used_at = NOW()
+WHERE user_id = $1 AND used_at IS NULL;
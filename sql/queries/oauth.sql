@@ -0,0 +1,73 @@
+-- name: CreateOAuthClient :one
+INSERT INTO oauth_clients(id, created_at, updated_at, owner_id, name, secret_hash, redirect_uris, scope)
+VALUES(
+    gen_random_uuid(),
+    NOW(),
+    NOW(),
+    $1,
+    $2,
+    $3,
+    $4,
+    $5
+)
+RETURNING *;
+
+-- name: GetOAuthClient :one
+SELECT * FROM oauth_clients
+WHERE id = $1;
+
+-- name: GetOAuthClientsForOwner :many
+SELECT * FROM oauth_clients
+WHERE owner_id = $1
+ORDER BY created_at ASC;
+
+-- name: DeleteOAuthClient :execrows
+DELETE FROM oauth_clients
+WHERE id = $1 AND owner_id = $2;
+
+-- name: CreateOAuthCode :exec
+INSERT INTO oauth_authorization_codes(code_hash, created_at, client_id, user_id, redirect_uri, scope, code_challenge, expires_at)
+VALUES(
+    $1,
+    NOW(),
+    $2,
+    $3,
+    $4,
+    $5,
+    $6,
+    $7
+);
+
+-- name: UseOAuthCode :one
+UPDATE oauth_authorization_codes
+SET used_at = NOW()
+WHERE code_hash = $1 AND used_at IS NULL AND expires_at > NOW()
+RETURNING *;
+
+-- name: UpsertOAuthConsent :one
+INSERT INTO oauth_consents(user_id, client_id, created_at, updated_at, scope)
+VALUES(
+    $1,
+    $2,
+    NOW(),
+    NOW(),
+    $3
+)
+ON CONFLICT (user_id, client_id) DO UPDATE
+SET scope = EXCLUDED.scope, updated_at = NOW()
+RETURNING *;
+
+-- name: GetOAuthConsent :one
+SELECT * FROM oauth_consents
+WHERE user_id = $1 AND client_id = $2;
+
+-- name: GetOAuthConsentsForUser :many
+SELECT oauth_consents.*, oauth_clients.name AS client_name
+FROM oauth_consents
+JOIN oauth_clients ON oauth_clients.id = oauth_consents.client_id
+WHERE oauth_consents.user_id = $1
+ORDER BY oauth_consents.created_at ASC;
+
+-- name: DeleteOAuthConsent :execrows
+DELETE FROM oauth_consents
+WHERE user_id = $1 AND client_id = $2;
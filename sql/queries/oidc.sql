@@ -0,0 +1,36 @@
+-- name: CreateOIDCSession :one
+INSERT INTO oidc_sessions(id, created_at, state, nonce, code_verifier, expires_at)
+VALUES(
+    gen_random_uuid(),
+    NOW(),
+    $1,
+    $2,
+    $3,
+    $4
+)
+RETURNING *;
+
+-- name: ConsumeOIDCSession :one
+DELETE FROM oidc_sessions
+WHERE state = $1 AND expires_at > NOW()
+RETURNING *;
+
+-- name: DeleteExpiredOIDCSessions :exec
+DELETE FROM oidc_sessions
+WHERE expires_at < NOW();
+
+-- name: CreateUserIdentity :one
+INSERT INTO user_identities(id, created_at, user_id, issuer, subject, email)
+VALUES(
+    gen_random_uuid(),
+    NOW(),
+    $1,
+    $2,
+    $3,
+    $4
+)
+RETURNING *;
+
+-- name: GetUserIdentity :one
+SELECT * FROM user_identities
+WHERE issuer = $1 AND subject = $2;
@@ -0,0 +1,31 @@
+-- name: CreatePasskey :one
+INSERT INTO passkeys(id, created_at, updated_at, user_id, name, credential_id, public_key, sign_count)
+VALUES(
+    gen_random_uuid(),
+    NOW(),
+    NOW(),
+    $1,
+    $2,
+    $3,
+    $4,
+    $5
+)
+RETURNING *;
+
+-- name: GetPasskeysForUser :many
+SELECT * FROM passkeys
+WHERE user_id = $1
+ORDER BY created_at ASC;
+
+-- name: GetPasskeyByCredentialID :one
+SELECT * FROM passkeys
+WHERE credential_id = $1;
+
+-- name: UpdatePasskeySignCount :execrows
+UPDATE passkeys
+SET sign_count = $3, last_used_at = NOW(), updated_at = NOW()
+WHERE id = $1 AND sign_count = $2;
+
+-- name: DeletePasskey :execrows
+DELETE FROM passkeys
+WHERE id = $1 AND user_id = $2;
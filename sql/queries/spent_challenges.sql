@@ -0,0 +1,11 @@
+-- name: DeleteExpiredSpentChallenges :execrows
+DELETE FROM spent_challenges
+WHERE expires_at < NOW();
+
+-- name: SpendChallenge :execrows
+INSERT INTO spent_challenges(nonce, expires_at)
+VALUES(
+    $1,
+    $2
+)
+ON CONFLICT (nonce) DO NOTHING;
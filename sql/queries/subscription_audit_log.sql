@@ -0,0 +1,18 @@
+-- name: CreateSubscriptionAuditEntry :one
+INSERT INTO subscription_audit_log(id, created_at, user_id, source, action, detail, before, after)
+VALUES(
+    gen_random_uuid(),
+    NOW(),
+    $1,
+    $2,
+    $3,
+    $4,
+    $5,
+    $6
+)
+RETURNING *;
+
+-- name: GetSubscriptionAuditEntriesForUser :many
+SELECT * FROM subscription_audit_log
+WHERE user_id = $1
+ORDER BY created_at DESC;
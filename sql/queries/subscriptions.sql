@@ -0,0 +1,56 @@
+-- name: GetSubscriptionForUser :one
+SELECT * FROM subscriptions
+WHERE user_id = $1;
+
+-- name: GetSubscriptionForUserForUpdate :one
+SELECT * FROM subscriptions
+WHERE user_id = $1
+FOR UPDATE;
+
+-- name: UpsertSubscription :one
+INSERT INTO subscriptions(id, created_at, updated_at, user_id, plan, status, current_period_end, grace_period_ends_at, last_event_at)
+VALUES(
+    gen_random_uuid(),
+    NOW(),
+    NOW(),
+    $1,
+    $2,
+    $3,
+    $4,
+    $5,
+    $6
+)
+ON CONFLICT (user_id) DO UPDATE
+SET plan = EXCLUDED.plan,
+    status = EXCLUDED.status,
+    current_period_end = EXCLUDED.current_period_end,
+    grace_period_ends_at = EXCLUDED.grace_period_ends_at,
+    last_event_at = COALESCE(EXCLUDED.last_event_at, subscriptions.last_event_at),
+    updated_at = NOW()
+RETURNING *;
+
+-- name: SyncUserChirpyRed :exec
+UPDATE users
+SET is_chirpy_red = EXISTS(
+    SELECT 1 FROM subscriptions
+    WHERE subscriptions.user_id = users.id
+    AND subscriptions.status IN ('active', 'past_due')
+    AND subscriptions.grace_period_ends_at > NOW()
+)
+WHERE id = $1;
+
+-- name: ExpireLapsedSubscriptions :execrows
+WITH expired AS (
+    UPDATE subscriptions
+    SET status = 'expired', updated_at = NOW()
+    WHERE status IN ('active', 'past_due')
+    AND grace_period_ends_at <= NOW()
+    RETURNING user_id
+)
+UPDATE users
+SET is_chirpy_red = false
+WHERE id IN (SELECT user_id FROM expired);
+
+-- name: ListSubscriptions :many
+SELECT * FROM subscriptions
+ORDER BY user_id;
@@ -0,0 +1,30 @@
+-- name: UpsertPendingTOTP :one
+INSERT INTO user_totp(user_id, created_at, updated_at, secret)
+VALUES(
+    $1,
+    NOW(),
+    NOW(),
+    $2
+)
+ON CONFLICT (user_id) DO UPDATE
+SET secret = EXCLUDED.secret, enabled_at = NULL, last_used_step = 0, updated_at = NOW()
+RETURNING *;
+
+-- name: GetTOTP :one
+SELECT * FROM user_totp
+WHERE user_id = $1;
+
+-- name: EnableTOTP :one
+UPDATE user_totp
+SET enabled_at = NOW(), last_used_step = $2, updated_at = NOW()
+WHERE user_id = $1
+RETURNING *;
+
+-- name: SetTOTPLastUsedStep :execrows
+UPDATE user_totp
+SET last_used_step = $2, updated_at = NOW()
+WHERE user_id = $1 AND last_used_step < $2;
+
+-- name: DeleteTOTP :exec
+DELETE FROM user_totp
+WHERE user_id = $1;
@@ -0,0 +1,19 @@
+-- name: IncrementUsageCounter :one
+INSERT INTO usage_counters(user_id, metric, period, period_start, count, updated_at)
+VALUES(
+    $1,
+    $2,
+    $3,
+    $4,
+    1,
+    NOW()
+)
+ON CONFLICT (user_id, metric, period, period_start) DO UPDATE
+SET count = usage_counters.count + 1, updated_at = NOW()
+WHERE usage_counters.count < sqlc.arg(max_count)
+RETURNING count;
+
+-- name: GetUsageCounters :many
+SELECT * FROM usage_counters
+WHERE user_id = $1
+AND ((period = 'day' AND period_start = sqlc.arg(day_start)) OR (period = 'month' AND period_start = sqlc.arg(month_start)));
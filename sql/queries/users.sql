@@ -24,14 +24,24 @@ WHERE id = $1;
 SELECT hashed_password FROM users
 WHERE email = $1;
 
--- name: UpdateUserCredentials :one
+-- name: MarkEmailVerified :one
 UPDATE users
-SET email = $2, hashed_password = $3, updated_at = NOW()
+SET email_verified_at = NOW(), updated_at = NOW()
+WHERE id = $1 AND email = $2
+RETURNING *;
+
+-- name: UpdateUserPassword :one
+UPDATE users
+SET hashed_password = $2, updated_at = NOW()
 WHERE id = $1
 RETURNING *;
 
--- name: UpgradeUsertoChirpyRed :one
+-- name: ChangeUserEmail :one
 UPDATE users
-SET is_chirpy_red = true
+SET email = $2, email_verified_at = NOW(), updated_at = NOW()
 WHERE id = $1
-RETURNING *;
\ No newline at end of file
+RETURNING *;
+
+-- name: ListChirpyRedUserIDs :many
+SELECT id FROM users
+WHERE is_chirpy_red;
@@ -0,0 +1,34 @@
+-- name: CreateWaitlistEntry :exec
+INSERT INTO waitlist_entries(id, created_at, updated_at, email, hashed_password, status)
+VALUES(
+    gen_random_uuid(),
+    NOW(),
+    NOW(),
+    $1,
+    $2,
+    'pending'
+)
+ON CONFLICT (email) DO NOTHING;
+
+-- name: GetPendingWaitlistEntries :many
+SELECT * FROM waitlist_entries
+WHERE status = 'pending'
+ORDER BY created_at
+LIMIT $1
+FOR UPDATE SKIP LOCKED;
+
+-- name: GetPendingWaitlistEntry :one
+SELECT * FROM waitlist_entries
+WHERE id = $1 AND status = 'pending'
+FOR UPDATE;
+
+-- name: ListWaitlistEntries :many
+SELECT * FROM waitlist_entries
+WHERE (sqlc.arg(status)::text = '' OR status = sqlc.arg(status))
+ORDER BY created_at
+LIMIT sqlc.arg(row_limit);
+
+-- name: ResolveWaitlistEntry :exec
+UPDATE waitlist_entries
+SET status = $2, user_id = $3, decided_at = NOW(), updated_at = NOW()
+WHERE id = $1;
@@ -0,0 +1,20 @@
+-- name: CreateWebauthnSession :one
+INSERT INTO webauthn_sessions(id, created_at, user_id, ceremony, challenge, expires_at)
+VALUES(
+    gen_random_uuid(),
+    NOW(),
+    $1,
+    $2,
+    $3,
+    $4
+)
+RETURNING *;
+
+-- name: ConsumeWebauthnSession :one
+DELETE FROM webauthn_sessions
+WHERE id = $1 AND ceremony = $2
+RETURNING *;
+
+-- name: DeleteExpiredWebauthnSessions :exec
+DELETE FROM webauthn_sessions
+WHERE expires_at < NOW();
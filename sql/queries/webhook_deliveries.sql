@@ -0,0 +1,54 @@
+-- name: ClaimDueWebhookDeliveries :many
+UPDATE webhook_deliveries
+SET status = 'sending', attempts = attempts + 1, updated_at = NOW()
+WHERE id IN (
+    SELECT id FROM webhook_deliveries
+    WHERE (status = 'pending' AND next_attempt_at <= NOW())
+        OR (status = 'sending' AND updated_at < NOW() - INTERVAL '10 minutes')
+    ORDER BY next_attempt_at ASC
+    LIMIT $1
+    FOR UPDATE SKIP LOCKED
+)
+RETURNING *;
+
+-- name: CreateWebhookDeliveryAttempt :exec
+INSERT INTO webhook_delivery_attempts(id, created_at, delivery_id, status_code, error, duration_ms)
+VALUES(
+    gen_random_uuid(),
+    NOW(),
+    $1,
+    $2,
+    $3,
+    $4
+);
+
+-- name: EnqueueWebhookDeliveries :execrows
+INSERT INTO webhook_deliveries(id, created_at, updated_at, endpoint_id, event_id, event_type, payload, next_attempt_at)
+SELECT gen_random_uuid(), NOW(), NOW(), id, sqlc.arg(event_id), sqlc.arg(event_type), sqlc.arg(payload), NOW()
+FROM webhook_endpoints
+WHERE user_id = sqlc.arg(user_id) AND sqlc.arg(event_type)::text = ANY(string_to_array(events, ' '));
+
+-- name: GetWebhookDeliveriesForEndpoint :many
+SELECT * FROM webhook_deliveries
+WHERE endpoint_id = $1
+ORDER BY created_at DESC
+LIMIT $2;
+
+-- name: GetWebhookDelivery :one
+SELECT * FROM webhook_deliveries
+WHERE id = $1 AND endpoint_id = $2;
+
+-- name: GetWebhookDeliveryAttempts :many
+SELECT * FROM webhook_delivery_attempts
+WHERE delivery_id = $1
+ORDER BY created_at;
+
+-- name: MarkWebhookDeliveryDelivered :exec
+UPDATE webhook_deliveries
+SET status = 'delivered', last_status_code = $2, last_error = NULL, delivered_at = NOW(), updated_at = NOW()
+WHERE id = $1;
+
+-- name: MarkWebhookDeliveryFailed :exec
+UPDATE webhook_deliveries
+SET status = $2, last_status_code = $3, last_error = $4, next_attempt_at = $5, updated_at = NOW()
+WHERE id = $1;
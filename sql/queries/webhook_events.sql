@@ -0,0 +1,55 @@
+-- name: ClaimWebhookEvent :one
+UPDATE webhook_events
+SET status = 'processing',
+    updated_at = NOW()
+WHERE id = $1
+AND (
+    status IN ('received', 'failed')
+    OR (status = 'processing' AND updated_at < NOW() - INTERVAL '5 minutes')
+)
+RETURNING *;
+
+-- name: CreateWebhookEvent :one
+INSERT INTO webhook_events(id, created_at, updated_at, source, event_id, event_type, payload, status)
+VALUES(
+    gen_random_uuid(),
+    NOW(),
+    NOW(),
+    $1,
+    $2,
+    $3,
+    $4,
+    'received'
+)
+ON CONFLICT (source, event_id) DO NOTHING
+RETURNING *;
+
+-- name: GetWebhookEvent :one
+SELECT * FROM webhook_events
+WHERE id = $1;
+
+-- name: GetWebhookEventBySourceID :one
+SELECT * FROM webhook_events
+WHERE source = $1 AND event_id = $2;
+
+-- name: ListWebhookEvents :many
+SELECT * FROM webhook_events
+WHERE (sqlc.arg(status)::text = '' OR status = sqlc.arg(status))
+ORDER BY created_at DESC
+LIMIT sqlc.arg(row_limit);
+
+-- name: RetireWebhookEventID :exec
+UPDATE webhook_events
+SET event_id = event_id || ':' || id::text,
+    updated_at = NOW()
+WHERE source = $1 AND event_id = $2 AND created_at < NOW() - make_interval(secs => sqlc.arg(window_seconds));
+
+-- name: SetWebhookEventResult :one
+UPDATE webhook_events
+SET status = $2,
+    error = $3,
+    attempts = attempts + 1,
+    processed_at = CASE WHEN $2 = 'processed' THEN NOW() ELSE processed_at END,
+    updated_at = NOW()
+WHERE id = $1
+RETURNING *;
@@ -0,0 +1,36 @@
+-- +goose Up
+ALTER TABLE users
+ADD COLUMN email_verified_at TIMESTAMP DEFAULT(NULL);
+
+CREATE TABLE email_tokens(
+    id UUID PRIMARY KEY,
+    created_at TIMESTAMP NOT NULL,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    purpose TEXT NOT NULL,
+    email TEXT NOT NULL,
+    expires_at TIMESTAMP NOT NULL,
+    used_at TIMESTAMP DEFAULT(NULL)
+);
+
+CREATE TABLE email_outbox(
+    id UUID PRIMARY KEY,
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL,
+    to_address TEXT NOT NULL,
+    subject TEXT NOT NULL,
+    body TEXT NOT NULL,
+    status TEXT NOT NULL DEFAULT 'pending',
+    attempts INTEGER NOT NULL DEFAULT 0,
+    last_error TEXT DEFAULT(NULL),
+    send_after TIMESTAMP NOT NULL,
+    sent_at TIMESTAMP DEFAULT(NULL)
+);
+
+CREATE INDEX email_outbox_pending_idx ON email_outbox(send_after) WHERE status = 'pending';
+
+-- +goose Down
+DROP TABLE email_outbox;
+DROP TABLE email_tokens;
+
+ALTER TABLE users
+DROP COLUMN email_verified_at;
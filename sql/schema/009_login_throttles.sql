@@ -0,0 +1,11 @@
+-- +goose Up
+CREATE TABLE login_throttles(
+    key TEXT PRIMARY KEY,
+    updated_at TIMESTAMP NOT NULL,
+    failures INTEGER NOT NULL DEFAULT 0,
+    last_failure_at TIMESTAMP NOT NULL,
+    locked_until TIMESTAMP DEFAULT(NULL)
+);
+
+-- +goose Down
+DROP TABLE login_throttles;
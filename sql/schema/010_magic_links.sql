@@ -0,0 +1,13 @@
+-- +goose Up
+CREATE TABLE magic_links(
+    id UUID PRIMARY KEY,
+    created_at TIMESTAMP NOT NULL,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    email TEXT NOT NULL,
+    nonce_hash TEXT NOT NULL,
+    expires_at TIMESTAMP NOT NULL,
+    used_at TIMESTAMP DEFAULT(NULL)
+);
+
+-- +goose Down
+DROP TABLE magic_links;
@@ -0,0 +1,49 @@
+-- +goose Up
+CREATE TABLE oauth_clients(
+    id UUID PRIMARY KEY,
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL,
+    owner_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name TEXT NOT NULL,
+    secret_hash TEXT DEFAULT(NULL),
+    redirect_uris TEXT NOT NULL,
+    scope TEXT NOT NULL
+);
+
+CREATE TABLE oauth_authorization_codes(
+    code_hash TEXT PRIMARY KEY,
+    created_at TIMESTAMP NOT NULL,
+    client_id UUID NOT NULL REFERENCES oauth_clients(id) ON DELETE CASCADE,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    redirect_uri TEXT NOT NULL,
+    scope TEXT NOT NULL,
+    code_challenge TEXT NOT NULL,
+    expires_at TIMESTAMP NOT NULL,
+    used_at TIMESTAMP DEFAULT(NULL)
+);
+
+CREATE TABLE oauth_consents(
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    client_id UUID NOT NULL REFERENCES oauth_clients(id) ON DELETE CASCADE,
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL,
+    scope TEXT NOT NULL,
+    PRIMARY KEY (user_id, client_id)
+);
+
+ALTER TABLE refresh_tokens
+ADD COLUMN client_id UUID DEFAULT(NULL) REFERENCES oauth_clients(id) ON DELETE CASCADE;
+
+ALTER TABLE refresh_tokens
+ADD COLUMN scope TEXT DEFAULT(NULL);
+
+-- +goose Down
+ALTER TABLE refresh_tokens
+DROP COLUMN scope;
+
+ALTER TABLE refresh_tokens
+DROP COLUMN client_id;
+
+DROP TABLE oauth_consents;
+DROP TABLE oauth_authorization_codes;
+DROP TABLE oauth_clients;
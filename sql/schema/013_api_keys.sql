@@ -0,0 +1,16 @@
+-- +goose Up
+CREATE TABLE api_keys(
+    id UUID PRIMARY KEY,
+    created_at TIMESTAMP NOT NULL,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name TEXT NOT NULL,
+    key_prefix TEXT NOT NULL,
+    key_hash TEXT NOT NULL UNIQUE,
+    scope TEXT NOT NULL,
+    expires_at TIMESTAMP DEFAULT(NULL),
+    last_used_at TIMESTAMP DEFAULT(NULL),
+    revoked_at TIMESTAMP DEFAULT(NULL)
+);
+
+-- +goose Down
+DROP TABLE api_keys;
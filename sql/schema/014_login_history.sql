@@ -0,0 +1,28 @@
+-- +goose Up
+CREATE TABLE login_events(
+    id UUID PRIMARY KEY,
+    created_at TIMESTAMP NOT NULL,
+    user_id UUID REFERENCES users(id) ON DELETE CASCADE,
+    email TEXT NOT NULL,
+    succeeded BOOLEAN NOT NULL,
+    method TEXT NOT NULL,
+    ip TEXT NOT NULL,
+    ip_range TEXT NOT NULL,
+    user_agent TEXT NOT NULL,
+    device_id TEXT NOT NULL
+);
+
+CREATE INDEX login_events_user_id_created_at_idx ON login_events(user_id, created_at);
+
+CREATE TABLE notifications(
+    id UUID PRIMARY KEY,
+    created_at TIMESTAMP NOT NULL,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    kind TEXT NOT NULL,
+    message TEXT NOT NULL,
+    read_at TIMESTAMP DEFAULT(NULL)
+);
+
+-- +goose Down
+DROP TABLE notifications;
+DROP TABLE login_events;
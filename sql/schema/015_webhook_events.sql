@@ -0,0 +1,18 @@
+-- +goose Up
+CREATE TABLE webhook_events(
+    id UUID PRIMARY KEY,
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL,
+    source TEXT NOT NULL,
+    event_id TEXT NOT NULL,
+    event_type TEXT NOT NULL,
+    payload TEXT NOT NULL,
+    status TEXT NOT NULL,
+    error TEXT DEFAULT(NULL),
+    attempts INTEGER NOT NULL DEFAULT 0,
+    processed_at TIMESTAMP DEFAULT(NULL),
+    UNIQUE(source, event_id)
+);
+
+-- +goose Down
+DROP TABLE webhook_events;
@@ -0,0 +1,21 @@
+-- +goose Up
+CREATE TABLE subscriptions(
+    id UUID PRIMARY KEY,
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL,
+    user_id UUID NOT NULL UNIQUE REFERENCES users(id) ON DELETE CASCADE,
+    plan TEXT NOT NULL,
+    status TEXT NOT NULL,
+    current_period_end TIMESTAMP NOT NULL,
+    grace_period_ends_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX subscriptions_status_grace_period_ends_at_idx ON subscriptions(status, grace_period_ends_at);
+
+INSERT INTO subscriptions(id, created_at, updated_at, user_id, plan, status, current_period_end, grace_period_ends_at)
+SELECT gen_random_uuid(), NOW(), NOW(), id, 'chirpy_red', 'active', NOW() + INTERVAL '30 days', NOW() + INTERVAL '33 days'
+FROM users
+WHERE is_chirpy_red;
+
+-- +goose Down
+DROP TABLE subscriptions;
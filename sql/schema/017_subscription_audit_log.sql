@@ -0,0 +1,16 @@
+-- +goose Up
+CREATE TABLE subscription_audit_log(
+    id UUID PRIMARY KEY,
+    created_at TIMESTAMP NOT NULL,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    source TEXT NOT NULL,
+    action TEXT NOT NULL,
+    detail TEXT NOT NULL,
+    before TEXT DEFAULT(NULL),
+    after TEXT NOT NULL
+);
+
+CREATE INDEX subscription_audit_log_user_id_created_at_idx ON subscription_audit_log(user_id, created_at);
+
+-- +goose Down
+DROP TABLE subscription_audit_log;
@@ -0,0 +1,13 @@
+-- +goose Up
+CREATE TABLE usage_counters(
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    metric TEXT NOT NULL,
+    period TEXT NOT NULL,
+    period_start TIMESTAMP NOT NULL,
+    count INTEGER NOT NULL,
+    updated_at TIMESTAMP NOT NULL,
+    PRIMARY KEY(user_id, metric, period, period_start)
+);
+
+-- +goose Down
+DROP TABLE usage_counters;
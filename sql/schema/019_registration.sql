@@ -0,0 +1,29 @@
+-- +goose Up
+CREATE TABLE invites(
+    id UUID PRIMARY KEY,
+    created_at TIMESTAMP NOT NULL,
+    created_by UUID REFERENCES users(id) ON DELETE CASCADE,
+    code_prefix TEXT NOT NULL,
+    code_hash TEXT NOT NULL UNIQUE,
+    max_uses INTEGER NOT NULL,
+    uses INTEGER NOT NULL DEFAULT 0,
+    expires_at TIMESTAMP DEFAULT(NULL),
+    revoked_at TIMESTAMP DEFAULT(NULL)
+);
+
+CREATE TABLE waitlist_entries(
+    id UUID PRIMARY KEY,
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL,
+    email TEXT NOT NULL UNIQUE,
+    hashed_password TEXT NOT NULL,
+    status TEXT NOT NULL,
+    user_id UUID REFERENCES users(id) ON DELETE SET NULL,
+    decided_at TIMESTAMP DEFAULT(NULL)
+);
+
+CREATE INDEX waitlist_entries_status_idx ON waitlist_entries(status, created_at);
+
+-- +goose Down
+DROP TABLE waitlist_entries;
+DROP TABLE invites;
@@ -0,0 +1,8 @@
+-- +goose Up
+CREATE TABLE spent_challenges(
+    nonce TEXT PRIMARY KEY,
+    expires_at TIMESTAMP NOT NULL
+);
+
+-- +goose Down
+DROP TABLE spent_challenges;
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Cmolloy36/Chirpy/internal/database"
+	"github.com/Cmolloy36/Chirpy/internal/entitlements"
+	"github.com/google/uuid"
+)
+
+const quotaRemainingHeader = "X-Quota-Remaining"
+
+type usageWindow struct {
+	name  string
+	start time.Time
+	end   time.Time
+}
+
+// usageWindows are the current calendar day and month in UTC.
+func usageWindows(now time.Time) []usageWindow {
+	now = now.UTC()
+	day := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	month := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+
+	return []usageWindow{
+		{name: entitlements.WindowDay, start: day, end: day.AddDate(0, 0, 1)},
+		{name: entitlements.WindowMonth, start: month, end: month.AddDate(0, 1, 0)},
+	}
+}
+
+// consumeQuota counts one use of metric against the user's daily and
+// monthly quotas. Each counter is only incremented while it is under its
+// limit, so concurrent requests can't overshoot. qtx must be in a
+// transaction that is rolled back on error; otherwise the daily counter
+// keeps an increment when the monthly one is full. It returns the uses
+// left in the tighter window, or entitlements.Unlimited.
+func (apiCfg *apiConfig) consumeQuota(ctx context.Context, qtx *database.Queries, userID uuid.UUID, plan, metric string) (int, error) {
+	quota := apiCfg.entitlements.Quota(plan, metric)
+	remaining := entitlements.Unlimited
+
+	for _, window := range usageWindows(time.Now()) {
+		limit := quota.For(window.name)
+		if limit == 0 {
+			return 0, apiCfg.entitlements.QuotaExceeded(plan, metric, window.name, window.end)
+		}
+
+		// Unlimited use is still counted so GET /api/usage can report it.
+		maxCount := int32(math.MaxInt32)
+		if limit != entitlements.Unlimited {
+			maxCount = int32(min(limit, math.MaxInt32))
+		}
+
+		incrementUsageCounterParams := database.IncrementUsageCounterParams{
+			UserID:      userID,
+			Metric:      metric,
+			Period:      window.name,
+			PeriodStart: window.start,
+			MaxCount:    maxCount,
+		}
+
+		count, err := qtx.IncrementUsageCounter(ctx, incrementUsageCounterParams)
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, apiCfg.entitlements.QuotaExceeded(plan, metric, window.name, window.end)
+		} else if err != nil {
+			return 0, err
+		}
+
+		if limit == entitlements.Unlimited {
+			continue
+		}
+
+		left := limit - int(count)
+		if remaining == entitlements.Unlimited || left < remaining {
+			remaining = left
+		}
+	}
+
+	return remaining, nil
+}
+
+// setQuotaRemaining adds e.g. "X-Quota-Remaining: chirps=41". Unlimited
+// metrics are left out.
+func setQuotaRemaining(w http.ResponseWriter, metric string, remaining int) {
+	if remaining == entitlements.Unlimited {
+		return
+	}
+
+	w.Header().Add(quotaRemainingHeader, metric+"="+strconv.Itoa(remaining))
+}
+
+// meterAPICall counts an authenticated request against the api_calls
+// quota.
+func (apiCfg *apiConfig) meterAPICall(w http.ResponseWriter, r *http.Request, userID uuid.UUID) error {
+	plan, err := apiCfg.planForUser(r.Context(), userID)
+	if err != nil {
+		return err
+	}
+
+	tx, err := apiCfg.db.BeginTx(r.Context(), nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	remaining, err := apiCfg.consumeQuota(r.Context(), apiCfg.dbQueries.WithTx(tx), userID, plan, entitlements.MetricAPICalls)
+	if err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	setQuotaRemaining(w, entitlements.MetricAPICalls, remaining)
+	return nil
+}
+
+type Usage struct {
+	Metric    string    `json:"metric"`
+	Window    string    `json:"window"`
+	Used      int       `json:"used"`
+	Limit     int       `json:"limit"`
+	Remaining int       `json:"remaining"`
+	ResetsAt  time.Time `json:"resets_at"`
+}
+
+type UsageReport struct {
+	Plan  string  `json:"plan"`
+	Usage []Usage `json:"usage"`
+}
+
+// handlerGetUsage reports consumption of every metric in the current day
+// and month. A limit and remaining of -1 mean unlimited.
+func (apiCfg *apiConfig) handlerGetUsage(w http.ResponseWriter, r *http.Request) {
+	userID, err := userIDFromContext(r.Context())
+	if err != nil {
+		errorMessage := err.Error()
+
+		respondWithError(w, http.StatusUnauthorized, errorMessage)
+		return
+	}
+
+	plan, err := apiCfg.planForUser(r.Context(), userID)
+	if err != nil {
+		errorMessage := err.Error()
+
+		respondWithError(w, http.StatusBadRequest, errorMessage)
+		return
+	}
+
+	windows := usageWindows(time.Now())
+
+	getUsageCountersParams := database.GetUsageCountersParams{
+		UserID:     userID,
+		DayStart:   windows[0].start,
+		MonthStart: windows[1].start,
+	}
+
+	dbCounters, err := apiCfg.dbQueries.GetUsageCounters(r.Context(), getUsageCountersParams)
+	if err != nil {
+		errorMessage := err.Error()
+
+		respondWithError(w, http.StatusBadRequest, errorMessage)
+		return
+	}
+
+	used := map[string]int{}
+	for _, dbCounter := range dbCounters {
+		used[dbCounter.Metric+"/"+dbCounter.Period] = int(dbCounter.Count)
+	}
+
+	retUsage := UsageReport{Plan: plan}
+	for _, metric := range []string{entitlements.MetricChirps, entitlements.MetricMedia, entitlements.MetricAPICalls} {
+		quota := apiCfg.entitlements.Quota(plan, metric)
+
+		for _, window := range windows {
+			usage := Usage{
+				Metric:    metric,
+				Window:    window.name,
+				Used:      used[metric+"/"+window.name],
+				Limit:     quota.For(window.name),
+				Remaining: entitlements.Unlimited,
+				ResetsAt:  window.end,
+			}
+
+			if usage.Limit != entitlements.Unlimited {
+				usage.Remaining = max(usage.Limit-usage.Used, 0)
+			}
+
+			retUsage.Usage = append(retUsage.Usage, usage)
+		}
+	}
+
+	respondwithJSON(w, http.StatusOK, retUsage)
+}